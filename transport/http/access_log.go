@@ -0,0 +1,318 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AccessLogOption sets an optional parameter for ServerAccessLog.
+type AccessLogOption func(*accessLog)
+
+type accessLog struct {
+	logger          log.Logger
+	sampleRate      float64
+	slow            time.Duration
+	requestHeaders  []string
+	responseHeaders []string
+	requestBody     int
+	responseBody    int
+	redactHeaders   []string
+	redactPaths     []string
+	redactor        redactor
+}
+
+// AccessLogSampleRate logs only a fraction rate of the requests, between 0
+// and 1. Requests answered with a 5xx status code, and slow requests, are
+// always logged. By default every request is logged.
+func AccessLogSampleRate(rate float64) AccessLogOption {
+	return func(a *accessLog) { a.sampleRate = rate }
+}
+
+// AccessLogSlowThreshold marks the requests taking longer than d with
+// slow=true, and logs them regardless of sampling.
+func AccessLogSlowThreshold(d time.Duration) AccessLogOption {
+	return func(a *accessLog) { a.slow = d }
+}
+
+// AccessLogRequestHeaders logs the values of the request headers names, under
+// keys request_header.<name>.
+func AccessLogRequestHeaders(names ...string) AccessLogOption {
+	return func(a *accessLog) { a.requestHeaders = append(a.requestHeaders, names...) }
+}
+
+// AccessLogResponseHeaders logs the values of the response headers names,
+// under keys response_header.<name>.
+func AccessLogResponseHeaders(names ...string) AccessLogOption {
+	return func(a *accessLog) { a.responseHeaders = append(a.responseHeaders, names...) }
+}
+
+// AccessLogRequestBody logs up to max bytes of the bodies read from requests,
+// under the key request_body.
+func AccessLogRequestBody(max int) AccessLogOption {
+	return func(a *accessLog) { a.requestBody = max }
+}
+
+// AccessLogResponseBody logs up to max bytes of the bodies of responses,
+// under the key response_body.
+func AccessLogResponseBody(max int) AccessLogOption {
+	return func(a *accessLog) { a.responseBody = max }
+}
+
+// AccessLogRedactHeaders sets the headers whose values are logged as
+// Redacted. By default they are DefaultRedactedHeaders.
+func AccessLogRedactHeaders(names ...string) AccessLogOption {
+	return func(a *accessLog) { a.redactHeaders = names }
+}
+
+// AccessLogRedactJSON adds paths of fields of JSON bodies logged as Redacted.
+// Paths are dot-separated field names or array indexes, where * matches any
+// field or element, such as "password" or "users.*.token". Truncated JSON
+// bodies are not logged when paths are set, since they can not be redacted.
+func AccessLogRedactJSON(paths ...string) AccessLogOption {
+	return func(a *accessLog) { a.redactPaths = append(a.redactPaths, paths...) }
+}
+
+// ServerAccessLog logs a line to logger once every request is answered, with
+// the keys time, method, route, uri, proto, status, latency_ms, bytes,
+// remote_addr, forwarded_for, request_id, trace_id, principal, referer and
+// user_agent. Create logger with NewAccessLogger to choose the format of the
+// lines.
+//
+// remote_addr is the address of the peer of the connection. forwarded_for is
+// the client address gin reads from the X-Forwarded-For and X-Real-Ip
+// headers, if it differs from remote_addr, and is empty otherwise. It can
+// only be trusted once the proxies allowed to set these headers are
+// restricted with the SetTrustedProxies method of the gin engine, since gin
+// trusts every proxy by default.
+//
+// The latency is measured from before the other ServerBefore functions, so
+// that requests they reject are logged as well. Response bodies are captured
+// as written by the encoder, before ServerCompression compresses them.
+func ServerAccessLog(logger log.Logger, options ...AccessLogOption) ServerOption {
+	return func(s *Server) {
+		a := &accessLog{
+			logger:        logger,
+			sampleRate:    1,
+			redactHeaders: DefaultRedactedHeaders,
+		}
+		for _, option := range options {
+			option(a)
+		}
+		a.redactor = newRedactor(a.redactHeaders, a.redactPaths)
+
+		s.before = append([]RequestFunc{a.start}, s.before...)
+		if a.responseBody > 0 {
+			s.interceptors = append(s.interceptors, a.captureResponse)
+		}
+		s.finalizer = append(s.finalizer, a.log)
+	}
+}
+
+type accessLogStateKey struct{}
+
+// accessLogState holds what ServerAccessLog captures of a request while it
+// is served.
+type accessLogState struct {
+	begin        time.Time
+	requestBody  *captureBuffer
+	responseBody *captureBuffer
+}
+
+func (a *accessLog) start(ctx context.Context, gCtx *gin.Context) context.Context {
+	st := &accessLogState{begin: time.Now()}
+	if r := gCtx.Request; a.requestBody > 0 && r.Body != nil && r.Body != http.NoBody {
+		st.requestBody = &captureBuffer{max: a.requestBody}
+		r.Body = teeReadCloser{Reader: io.TeeReader(r.Body, st.requestBody), Closer: r.Body}
+	}
+	return context.WithValue(ctx, accessLogStateKey{}, st)
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func (a *accessLog) captureResponse(next handlerFunc) handlerFunc {
+	return func(ctx context.Context, gCtx *gin.Context) context.Context {
+		st, ok := ctx.Value(accessLogStateKey{}).(*accessLogState)
+		if !ok {
+			return next(ctx, gCtx)
+		}
+		st.responseBody = &captureBuffer{max: a.responseBody}
+		w := &captureWriter{ResponseWriter: gCtx.Writer, capture: st.responseBody}
+		gCtx.Writer = w
+		defer func() { gCtx.Writer = w.ResponseWriter }()
+		return next(ctx, gCtx)
+	}
+}
+
+// captureWriter copies the body of a response to a captureBuffer.
+type captureWriter struct {
+	gin.ResponseWriter
+	capture *captureBuffer
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.capture.Write(p[:n])
+	return n, err
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (a *accessLog) log(ctx context.Context, code int, gCtx *gin.Context) {
+	st, ok := ctx.Value(accessLogStateKey{}).(*accessLogState)
+	if !ok {
+		return
+	}
+	latency := time.Since(st.begin)
+	slow := a.slow > 0 && latency > a.slow
+	if code < http.StatusInternalServerError && !slow && a.sampleRate < 1 && rand.Float64() >= a.sampleRate {
+		return
+	}
+
+	r := gCtx.Request
+	size, _ := ctx.Value(ContextKeyResponseSize).(int64)
+	requestID := gCtx.Writer.Header().Get(RequestIDHeader)
+	if requestID == "" {
+		requestID = r.Header.Get(RequestIDHeader)
+	}
+	var traceID string
+	if sc := trace.SpanFromContext(ctx).SpanContext(); sc.IsValid() {
+		traceID = sc.TraceID().String()
+	}
+	principal, _ := PrincipalFromContext(ctx)
+	remoteAddr, _, err := net.SplitHostPort(strings.TrimSpace(r.RemoteAddr))
+	if err != nil {
+		remoteAddr = r.RemoteAddr
+	}
+	forwardedFor := gCtx.ClientIP()
+	if forwardedFor == remoteAddr {
+		forwardedFor = ""
+	}
+
+	keyvals := []interface{}{
+		"time", st.begin.Format(time.RFC3339Nano),
+		"method", r.Method,
+		"route", gCtx.FullPath(),
+		"uri", r.RequestURI,
+		"proto", r.Proto,
+		"status", code,
+		"latency_ms", float64(latency) / float64(time.Millisecond),
+		"bytes", size,
+		"remote_addr", remoteAddr,
+		"forwarded_for", forwardedFor,
+		"request_id", requestID,
+		"trace_id", traceID,
+		"principal", principal.Subject,
+		"referer", r.Referer(),
+		"user_agent", r.UserAgent(),
+	}
+	if slow {
+		keyvals = append(keyvals, "slow", true)
+	}
+	for _, name := range a.requestHeaders {
+		keyvals = append(keyvals, "request_header."+strings.ToLower(name), a.redactor.header(r.Header, name))
+	}
+	for _, name := range a.responseHeaders {
+		keyvals = append(keyvals, "response_header."+strings.ToLower(name), a.redactor.header(gCtx.Writer.Header(), name))
+	}
+	if st.requestBody != nil {
+		keyvals = append(keyvals, "request_body", a.redactor.body(st.requestBody.buf.Bytes(), st.requestBody.size))
+	}
+	if st.responseBody != nil {
+		keyvals = append(keyvals, "response_body", a.redactor.body(st.responseBody.buf.Bytes(), st.responseBody.size))
+	}
+	a.logger.Log(keyvals...)
+}
+
+// AccessLogFormat is the format of the lines written by the loggers returned
+// by NewAccessLogger.
+type AccessLogFormat int
+
+const (
+	// AccessLogLogfmt writes lines in logfmt.
+	AccessLogLogfmt AccessLogFormat = iota
+	// AccessLogJSON writes lines as JSON objects.
+	AccessLogJSON
+	// AccessLogCombined writes lines in the Apache combined log format,
+	// from the keys logged by ServerAccessLog. Other keys are ignored.
+	AccessLogCombined
+)
+
+// NewAccessLogger returns a logger writing the lines of ServerAccessLog to w
+// in format. It is safe for concurrent use.
+func NewAccessLogger(w io.Writer, format AccessLogFormat) log.Logger {
+	w = log.NewSyncWriter(w)
+	switch format {
+	case AccessLogJSON:
+		return log.NewJSONLogger(w)
+	case AccessLogCombined:
+		return combinedLogger{w: w}
+	default:
+		return log.NewLogfmtLogger(w)
+	}
+}
+
+// combinedLogger writes the keys of ServerAccessLog in the Apache combined
+// log format.
+type combinedLogger struct {
+	w io.Writer
+}
+
+func (l combinedLogger) Log(keyvals ...interface{}) error {
+	values := make(map[string]string, len(keyvals)/2)
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		values[fmt.Sprint(keyvals[i])] = fmt.Sprint(keyvals[i+1])
+	}
+	field := func(key string) string {
+		if v := values[key]; v != "" {
+			return v
+		}
+		return "-"
+	}
+	quoted := func(key string) string {
+		v := values[key]
+		if v == "" {
+			return "-"
+		}
+		q := strconv.Quote(v)
+		return q[1 : len(q)-1]
+	}
+	at := time.Now()
+	if t, err := time.Parse(time.RFC3339Nano, values["time"]); err == nil {
+		at = t
+	}
+	bytesSent := field("bytes")
+	if bytesSent == "0" {
+		bytesSent = "-"
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s - %s [%s] \"%s %s %s\" %s %s \"%s\" \"%s\"\n",
+		field("remote_addr"),
+		field("principal"),
+		at.Format("02/Jan/2006:15:04:05 -0700"),
+		quoted("method"), quoted("uri"), quoted("proto"),
+		field("status"),
+		bytesSent,
+		quoted("referer"),
+		quoted("user_agent"),
+	)
+	_, err := l.w.Write(b.Bytes())
+	return err
+}
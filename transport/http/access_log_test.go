@@ -0,0 +1,140 @@
+package http_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/gin-gonic/gin"
+)
+
+func newAccessLogServer(options ...httptransport.ServerOption) *httptest.Server {
+	handler := httptransport.NewServer(
+		func(_ context.Context, request interface{}) (interface{}, error) {
+			body := request.(string)
+			if strings.HasPrefix(body, "sleep") {
+				time.Sleep(20 * time.Millisecond)
+			}
+			if body == "fail" {
+				return nil, httptransport.NewStatusError(http.StatusInternalServerError, "failed")
+			}
+			return body, nil
+		},
+		readBodyDecoder,
+		encodeString,
+		options...,
+	)
+	r := gin.New()
+	r.POST("/echo/:id", handler.ServeHTTP)
+	return httptest.NewServer(r)
+}
+
+func TestServerAccessLogJSON(t *testing.T) {
+	var buf bytes.Buffer
+	server := newAccessLogServer(httptransport.ServerAccessLog(
+		httptransport.NewAccessLogger(&buf, httptransport.AccessLogJSON),
+		httptransport.AccessLogRequestHeaders("Authorization", "X-Tenant"),
+		httptransport.AccessLogRequestBody(1024),
+		httptransport.AccessLogResponseBody(1024),
+		httptransport.AccessLogRedactJSON("password", "cards.*.number"),
+	))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/echo/1?x=y", strings.NewReader(`{"user":"ann","password":"secret","cards":[{"number":"4111"}]}`))
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("X-Tenant", "acme")
+	req.Header.Set("X-Request-Id", "req-1")
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("%v: %s", err, buf.String())
+	}
+	for key, want := range map[string]interface{}{
+		"method":                       "POST",
+		"route":                        "/echo/:id",
+		"uri":                          "/echo/1?x=y",
+		"status":                       float64(200),
+		"bytes":                        float64(62),
+		"remote_addr":                  "127.0.0.1",
+		"forwarded_for":                "203.0.113.7",
+		"request_id":                   "req-1",
+		"request_header.authorization": httptransport.Redacted,
+		"request_header.x-tenant":      "acme",
+		"request_body":                 `{"cards":[{"number":"[REDACTED]"}],"password":"[REDACTED]","user":"ann"}`,
+		"response_body":                `{"cards":[{"number":"[REDACTED]"}],"password":"[REDACTED]","user":"ann"}`,
+	} {
+		if have := line[key]; want != have {
+			t.Errorf("%s: want %v, have %v", key, want, have)
+		}
+	}
+	if _, ok := line["latency_ms"].(float64); !ok {
+		t.Errorf("latency_ms: have %v", line["latency_ms"])
+	}
+	if _, ok := line["slow"]; ok {
+		t.Errorf("fast request logged as slow")
+	}
+}
+
+func TestServerAccessLogSampling(t *testing.T) {
+	var buf bytes.Buffer
+	server := newAccessLogServer(httptransport.ServerAccessLog(
+		httptransport.NewAccessLogger(&buf, httptransport.AccessLogLogfmt),
+		httptransport.AccessLogSampleRate(0),
+		httptransport.AccessLogSlowThreshold(10*time.Millisecond),
+	))
+	defer server.Close()
+
+	for _, body := range []string{"ok", "fail", "sleep"} {
+		resp, err := http.Post(server.URL+"/echo/"+body, "text/plain", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if want, have := 2, len(lines); want != have {
+		t.Fatalf("want %d lines, have %d:\n%s", want, have, buf.String())
+	}
+	if !strings.Contains(lines[0], "uri=/echo/fail") || !strings.Contains(lines[0], "status=500") {
+		t.Errorf("want failed request, have %s", lines[0])
+	}
+	if !strings.Contains(lines[1], "uri=/echo/sleep") || !strings.Contains(lines[1], "slow=true") {
+		t.Errorf("want slow request, have %s", lines[1])
+	}
+}
+
+func TestServerAccessLogCombined(t *testing.T) {
+	var buf bytes.Buffer
+	server := newAccessLogServer(httptransport.ServerAccessLog(
+		httptransport.NewAccessLogger(&buf, httptransport.AccessLogCombined),
+	))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/echo/1", strings.NewReader("hello"))
+	req.Header.Set("User-Agent", `test "agent"`)
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	want := regexp.MustCompile(`^127\.0\.0\.1 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "POST /echo/1 HTTP/1\.1" 200 5 "-" "test \\"agent\\""\n$`)
+	if have := buf.String(); !want.MatchString(have) {
+		t.Errorf("want %s, have %q", want, have)
+	}
+}
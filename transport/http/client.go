@@ -17,11 +17,17 @@ type Client struct {
 	client *resty.Client
 }
 
+// Endpoint returns an endpoint sending the request described by url. Every
+// call builds its own resty.Request, so that calls may run concurrently and
+// the headers set by the RequestOptions of one call are not sent by another.
 func (c *Client) Endpoint(url ReqOption, enc RestyEncodeRequestFunc, dec RestyDecodeResponseFunc, options ...RequestOption) endpoint.Endpoint {
-	r := c.client.R()
-	url(r)
+	newRequest := func() *resty.Request {
+		r := c.client.R()
+		url(r)
+		return r
+	}
 	request := &Request{
-		req:            makeCreateRequestFunc(r, enc),
+		req:            makeCreateRequestFunc(newRequest, enc),
 		dec:            dec,
 		before:         make([]RestyRequestFunc, 0),
 		after:          make([]RestyResponseFunc, 0),
@@ -196,7 +202,7 @@ func DecodeJSONResponse(i interface{}) RestyDecodeResponseFunc {
 		}
 
 		dataResult := gjson.GetBytes(resp.Body(), "data")
-		err := json.Unmarshal(resp.Body()[dataResult.Index:result.Index+len(result.Raw)], i)
+		err := json.Unmarshal([]byte(dataResult.Raw), i)
 		if err != nil {
 			err = errors.Wrap(err, "unmarshal response data")
 			return resp.String(), err
@@ -206,8 +212,9 @@ func DecodeJSONResponse(i interface{}) RestyDecodeResponseFunc {
 	}
 }
 
-func makeCreateRequestFunc(req *resty.Request, enc RestyEncodeRequestFunc) RestyCreateRequestFunc {
+func makeCreateRequestFunc(newRequest func() *resty.Request, enc RestyEncodeRequestFunc) RestyCreateRequestFunc {
 	return func(ctx context.Context, i interface{}) (*resty.Request, error) {
+		req := newRequest()
 		err := enc(ctx, req, i)
 		if err != nil {
 			return nil, err
@@ -0,0 +1,227 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/pkg/errors"
+)
+
+// TokenSource supplies the bearer tokens of outgoing requests.
+type TokenSource interface {
+	// Token returns a valid token, fetching a new one if needed.
+	Token(ctx context.Context) (string, error)
+	// Invalidate discards token if it is the current one, so that the next
+	// call to Token fetches a new one.
+	Invalidate(token string)
+}
+
+// NewClientCredentialsTokenSource returns a TokenSource that fetches tokens
+// from the token endpoint at tokenURL with the OAuth2 client credentials
+// grant. Tokens are cached until shortly before they expire, and concurrent
+// callers share a single fetch.
+func NewClientCredentialsTokenSource(tokenURL, clientID, clientSecret string, scopes ...string) TokenSource {
+	return &clientCredentialsTokenSource{
+		client:       resty.New(),
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		scopes:       scopes,
+	}
+}
+
+type clientCredentialsTokenSource struct {
+	client       *resty.Client
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scopes       []string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func (s *clientCredentialsTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Now().Before(s.expires) {
+		return s.token, nil
+	}
+
+	form := map[string]string{"grant_type": "client_credentials"}
+	if len(s.scopes) > 0 {
+		form["scope"] = strings.Join(s.scopes, " ")
+	}
+	var result struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	resp, err := s.client.R().
+		SetContext(ctx).
+		SetBasicAuth(s.clientID, s.clientSecret).
+		SetFormData(form).
+		SetResult(&result).
+		Post(s.tokenURL)
+	if err != nil {
+		return "", errors.Wrap(err, "fetch token")
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return "", errors.Errorf("fetch token: unexpected status code %d", resp.StatusCode())
+	}
+	if result.AccessToken == "" {
+		return "", errors.New("fetch token: empty access_token")
+	}
+
+	s.token = result.AccessToken
+	s.expires = time.Now().Add(time.Hour)
+	if result.ExpiresIn > 0 {
+		// Refresh a little early, so that tokens do not expire in flight.
+		lifetime := time.Duration(result.ExpiresIn) * time.Second
+		s.expires = time.Now().Add(lifetime - lifetime/10)
+	}
+	return s.token, nil
+}
+
+func (s *clientCredentialsTokenSource) Invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == token {
+		s.token = ""
+	}
+}
+
+// wrapTransport wraps the transport of the client with f. Options replacing
+// the transport, such as WithClientTrace, must be applied before.
+func wrapTransport(c *Client, f func(http.RoundTripper) http.RoundTripper) {
+	t := c.client.GetClient().Transport
+	if t == nil {
+		t = http.DefaultTransport
+	}
+	c.client.SetTransport(f(t))
+}
+
+// WithClientBearerToken sets the Authorization header of requests to a
+// bearer token of ts. When a request is answered with 401, the token is
+// invalidated and the request is sent once more with a new token, unless its
+// body can not be replayed.
+func WithClientBearerToken(ts TokenSource) ClientOption {
+	return func(client *Client) {
+		wrapTransport(client, func(next http.RoundTripper) http.RoundTripper {
+			return &bearerTransport{next: next, source: ts}
+		})
+	}
+}
+
+type bearerTransport struct {
+	next   http.RoundTripper
+	source TokenSource
+}
+
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.source.Token(req.Context())
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	resp, err := t.send(req, req.Body, token)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+
+	t.source.Invalidate(token)
+	fresh, err := t.source.Token(req.Context())
+	if err != nil || fresh == token {
+		return resp, nil
+	}
+	var body io.ReadCloser
+	if req.GetBody != nil {
+		if body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return t.send(req, body, fresh)
+}
+
+func (t *bearerTransport) send(req *http.Request, body io.ReadCloser, token string) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.Body = body
+	r.Header.Set("Authorization", "Bearer "+token)
+	return t.next.RoundTrip(r)
+}
+
+// WithClientHMACSigning signs requests with the secret of keyID, as described
+// by HMACScheme, so that servers can authenticate them with
+// HMACAuthenticator. Bodies are read in memory to be signed.
+func WithClientHMACSigning(keyID string, secret []byte) ClientOption {
+	return func(client *Client) {
+		wrapTransport(client, func(next http.RoundTripper) http.RoundTripper {
+			return &hmacTransport{next: next, keyID: keyID, secret: secret}
+		})
+	}
+}
+
+type hmacTransport struct {
+	next   http.RoundTripper
+	keyID  string
+	secret []byte
+}
+
+func (t *hmacTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "read body to sign")
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	nonce, timestamp := hex.EncodeToString(b), time.Now().Unix()
+	signature := hmacSignature(t.secret, r.Method, r.URL.RequestURI(), timestamp, nonce, body)
+	r.Header.Set("Authorization", hmacAuthorization(t.keyID, timestamp, nonce, signature))
+	return t.next.RoundTrip(r)
+}
+
+// WithRequestAuthorization forwards the Authorization header of the inbound
+// request a Server is serving to the outgoing request, so that downstream
+// services act on behalf of the same caller. The header is taken from the
+// context under ContextKeyRequestAuthorization, so the Server must populate
+// it with PopulateRequestContext. It is only forwarded when this option is
+// given, since it hands the caller's credentials to the downstream service.
+// Calls whose context holds no Authorization keep the one set with
+// WithReqHeader, if any.
+func WithRequestAuthorization() RequestOption {
+	return func(request *Request) {
+		request.before = append(request.before, func(ctx context.Context, req *resty.Request) context.Context {
+			if auth, _ := ctx.Value(ContextKeyRequestAuthorization).(string); auth != "" {
+				req.SetHeader("Authorization", auth)
+			}
+			return ctx
+		})
+	}
+}
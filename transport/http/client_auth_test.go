@@ -0,0 +1,195 @@
+package http_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/gin-gonic/gin"
+	"github.com/go-resty/resty/v2"
+)
+
+func TestClientBearerToken(t *testing.T) {
+	var (
+		fetches int32
+		current atomic.Value
+	)
+	r := gin.New()
+	r.POST("/token", func(c *gin.Context) {
+		if id, secret, ok := c.Request.BasicAuth(); !ok || id != "svc" || secret != "pw" {
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		if want, have := "client_credentials", c.PostForm("grant_type"); want != have {
+			t.Errorf("grant_type: want %q, have %q", want, have)
+		}
+		token := fmt.Sprintf("tok-%d", atomic.AddInt32(&fetches, 1))
+		current.Store(token)
+		c.JSON(http.StatusOK, gin.H{"access_token": token, "token_type": "Bearer", "expires_in": 3600})
+	})
+	r.POST("/echo", func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "Bearer "+current.Load().(string) {
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		b, _ := ioutil.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(b))
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	ts := httptransport.NewClientCredentialsTokenSource(server.URL+"/token", "svc", "pw", "orders")
+	client := httptransport.NewClient(resty.New(), httptransport.WithClientHost(server.URL), httptransport.WithClientBearerToken(ts))
+	call := func() string {
+		var body string
+		e := client.Endpoint(httptransport.Req(http.MethodPost, "/echo"), httptransport.EncodeJSONRequest, httptransport.DecodeJSONResponse(&body))
+		if _, err := e(context.Background(), "hello"); err != nil {
+			t.Error(err)
+		}
+		return body
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() { defer wg.Done(); call() }()
+	}
+	wg.Wait()
+	if want, have := int32(1), atomic.LoadInt32(&fetches); want != have {
+		t.Errorf("concurrent fetches: want %d, have %d", want, have)
+	}
+
+	// The token is revoked: the request is retried once with a new one.
+	current.Store("revoked")
+	if want, have := "hello", call(); want != have {
+		t.Errorf("after revocation: want %s, have %s", want, have)
+	}
+	if want, have := int32(2), atomic.LoadInt32(&fetches); want != have {
+		t.Errorf("fetches: want %d, have %d", want, have)
+	}
+}
+
+func TestClientHMACSigning(t *testing.T) {
+	secret := []byte("hmac-secret")
+	handler := httptransport.NewServer(
+		func(ctx context.Context, request interface{}) (interface{}, error) {
+			p, _ := httptransport.PrincipalFromContext(ctx)
+			return map[string]string{"subject": p.Subject, "body": request.(string)}, nil
+		},
+		func(_ context.Context, gCtx *gin.Context) (interface{}, error) {
+			b, err := ioutil.ReadAll(gCtx.Request.Body)
+			return string(b), err
+		},
+		httptransport.EncodeJSONResponse,
+		httptransport.ServerBefore(httptransport.HMACAuthenticator(func(_ context.Context, keyID string) ([]byte, httptransport.Principal, error) {
+			return secret, httptransport.Principal{}, nil
+		})),
+	)
+	r := gin.New()
+	r.POST("/orders/:id", handler.ServeHTTP)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	client := httptransport.NewClient(resty.New(), httptransport.WithClientHost(server.URL), httptransport.WithClientHMACSigning("svc", secret))
+	var resp map[string]string
+	e := client.Endpoint(
+		httptransport.Req(http.MethodPost, "/orders/{id}", httptransport.WithReqPathParam("id", "7"), httptransport.WithReqQueryParam("dry", "1")),
+		httptransport.EncodeJSONRequest,
+		httptransport.DecodeJSONResponse(&resp),
+	)
+	for i := 0; i < 2; i++ {
+		if _, err := e(context.Background(), map[string]int{"qty": 2}); err != nil {
+			t.Fatal(err)
+		}
+		if want, have := (map[string]string{"subject": "svc", "body": `{"qty":2}`}), resp; fmt.Sprint(want) != fmt.Sprint(have) {
+			t.Errorf("%d: want %v, have %v", i, want, have)
+		}
+	}
+}
+
+func TestWithRequestAuthorization(t *testing.T) {
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("Authorization"))
+	}))
+	defer downstream.Close()
+
+	client := httptransport.NewClient(resty.New(), httptransport.WithClientHost(downstream.URL))
+	var forwarded string
+	call := client.Endpoint(httptransport.Req(http.MethodGet, "/"), httptransport.EncodeJSONRequest, httptransport.DecodeJSONResponse(&forwarded), httptransport.WithRequestAuthorization())
+
+	handler := httptransport.NewServer(
+		func(ctx context.Context, _ interface{}) (interface{}, error) {
+			if _, err := call(ctx, nil); err != nil {
+				return nil, err
+			}
+			return forwarded, nil
+		},
+		httptransport.NopRequestDecoder,
+		httptransport.EncodeJSONResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	)
+	r := gin.New()
+	r.GET("/", handler.ServeHTTP)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	for _, auth := range []string{"Bearer abc", ""} {
+		_, body := getWithHeader(t, server.URL, "Authorization", auth)
+		if want, have := fmt.Sprintf("%q", auth), body; want != have {
+			t.Errorf("want %s, have %s", want, have)
+		}
+	}
+}
+
+// decodeBody is a RestyDecodeResponseFunc returning the body of the response,
+// for endpoints called concurrently.
+func decodeBody(_ context.Context, resp *resty.Response) (interface{}, error) {
+	return resp.String(), nil
+}
+
+func TestWithRequestAuthorizationConcurrent(t *testing.T) {
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("Authorization"))
+	}))
+	defer downstream.Close()
+
+	client := httptransport.NewClient(resty.New(), httptransport.WithClientHost(downstream.URL))
+	call := client.Endpoint(httptransport.Req(http.MethodGet, "/"), httptransport.EncodeJSONRequest, decodeBody, httptransport.WithRequestAuthorization())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(auth string) {
+			defer wg.Done()
+			ctx := context.WithValue(context.Background(), httptransport.ContextKeyRequestAuthorization, auth)
+			forwarded, err := call(ctx, nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if auth != forwarded {
+				t.Errorf("want %q, have %q", auth, forwarded)
+			}
+		}(fmt.Sprintf("Bearer %d", i))
+	}
+	wg.Wait()
+
+	// Calls without an inbound Authorization keep the one set on purpose.
+	fixed := client.Endpoint(httptransport.Req(http.MethodGet, "/", httptransport.WithReqHeader("Authorization", "Bearer fixed")), httptransport.EncodeJSONRequest, decodeBody, httptransport.WithRequestAuthorization())
+	for _, auth := range []string{"Bearer caller", ""} {
+		want := auth
+		if want == "" {
+			want = "Bearer fixed"
+		}
+		ctx := context.WithValue(context.Background(), httptransport.ContextKeyRequestAuthorization, auth)
+		if have, err := fixed(ctx, nil); err != nil || want != have {
+			t.Errorf("want %q, have %q (%v)", want, have, err)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package http
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Cassette holds the requests sent by a Client and the responses it
+// received, as recorded by WithClientCassette.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a request recorded in a Cassette, and its response.
+type Interaction struct {
+	Request  RequestInfo  `json:"request"`
+	Response ResponseInfo `json:"response"`
+}
+
+// LoadCassette reads the Cassette stored at path.
+func LoadCassette(path string) (*Cassette, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read cassette")
+	}
+	var c Cassette
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, errors.Wrap(err, "decode cassette")
+	}
+	return &c, nil
+}
+
+// Save writes c to path, replacing the file.
+func (c *Cassette) Save(path string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encode cassette")
+	}
+	return errors.Wrap(ioutil.WriteFile(path, b, 0o644), "write cassette")
+}
+
+// CassetteMode tells whether WithClientCassette records or replays.
+type CassetteMode int
+
+const (
+	// CassetteReplay serves the responses of requests from the cassette,
+	// without sending them.
+	CassetteReplay CassetteMode = iota
+	// CassetteRecord sends requests, and stores them in the cassette along
+	// with their responses, replacing its content.
+	CassetteRecord
+)
+
+// CassetteMatcher reports whether a request, whose body has been read, is the
+// one recorded in an Interaction.
+type CassetteMatcher func(r *http.Request, body []byte, recorded RequestInfo) bool
+
+// MatchMethod matches requests with the same method.
+func MatchMethod(r *http.Request, _ []byte, recorded RequestInfo) bool {
+	return r.Method == recorded.Method
+}
+
+// MatchPath matches requests with the same path, regardless of their host.
+func MatchPath(r *http.Request, _ []byte, recorded RequestInfo) bool {
+	u, err := url.Parse(recorded.Url)
+	return err == nil && r.URL.Path == u.Path
+}
+
+// MatchQuery matches requests with the same query parameters, in any order.
+func MatchQuery(r *http.Request, _ []byte, recorded RequestInfo) bool {
+	query, err := url.ParseQuery(recorded.QueryParam)
+	return err == nil && reflect.DeepEqual(r.URL.Query(), query)
+}
+
+// MatchBody matches requests with the same body. JSON bodies match if they
+// hold the same values, regardless of their formatting and field order.
+func MatchBody(_ *http.Request, body []byte, recorded RequestInfo) bool {
+	want, err := recordedBody(recorded.Body, recorded.BodyEncoding)
+	if err != nil {
+		return false
+	}
+	if bytes.Equal(body, want) {
+		return true
+	}
+	var have, wantValue interface{}
+	return json.Unmarshal(body, &have) == nil && json.Unmarshal(want, &wantValue) == nil &&
+		reflect.DeepEqual(have, wantValue)
+}
+
+// CassetteOption sets an optional parameter for WithClientCassette.
+type CassetteOption func(*cassetteTransport)
+
+// CassetteMatchers sets how replayed requests are matched with recorded
+// ones. By default they are matched with MatchMethod, MatchPath and
+// MatchQuery.
+func CassetteMatchers(matchers ...CassetteMatcher) CassetteOption {
+	return func(t *cassetteTransport) { t.matchers = matchers }
+}
+
+// CassetteAllowRepeats lets replayed requests match interactions that have
+// already been replayed. By default each interaction is replayed once, in the
+// order they were recorded, so that a sequence of identical requests gets the
+// sequence of recorded responses.
+func CassetteAllowRepeats() CassetteOption {
+	return func(t *cassetteTransport) { t.repeats = true }
+}
+
+// CassetteRedactHeaders sets the headers whose values are recorded as
+// Redacted, so that cassettes can be committed. By default they are
+// DefaultRedactedHeaders.
+func CassetteRedactHeaders(names ...string) CassetteOption {
+	return func(t *cassetteTransport) { t.redactor = newRedactor(names, nil) }
+}
+
+// WithClientCassette records the requests sent by the Client, and their
+// responses, to the cassette file at path, or replays them from it, so that
+// code calling other services can be tested without them. In replay mode,
+// requests matching no interaction of the cassette fail, as do all requests
+// if the cassette can not be read. In record mode, the cassette is written
+// after every request.
+//
+// Give it before the other options wrapping the transport of the Client, so
+// that it records the requests they send.
+func WithClientCassette(path string, mode CassetteMode, options ...CassetteOption) ClientOption {
+	return func(client *Client) {
+		t := &cassetteTransport{
+			path:     path,
+			mode:     mode,
+			matchers: []CassetteMatcher{MatchMethod, MatchPath, MatchQuery},
+			redactor: newRedactor(DefaultRedactedHeaders, nil),
+			cassette: &Cassette{},
+		}
+		for _, option := range options {
+			option(t)
+		}
+		if mode == CassetteReplay {
+			t.cassette, t.err = LoadCassette(path)
+			if t.err == nil {
+				t.played = make([]bool, len(t.cassette.Interactions))
+			}
+		}
+		wrapTransport(client, func(next http.RoundTripper) http.RoundTripper {
+			t.next = next
+			return t
+		})
+	}
+}
+
+type cassetteTransport struct {
+	next     http.RoundTripper
+	path     string
+	mode     CassetteMode
+	matchers []CassetteMatcher
+	repeats  bool
+	redactor redactor
+
+	mu       sync.Mutex
+	cassette *Cassette
+	played   []bool
+	err      error
+}
+
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "read body")
+		}
+	}
+	if t.mode == CassetteReplay {
+		return t.replay(req, body)
+	}
+	return t.record(req, body)
+}
+
+func (t *cassetteTransport) replay(req *http.Request, body []byte) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil {
+		return nil, t.err
+	}
+	for i, interaction := range t.cassette.Interactions {
+		if t.played[i] && !t.repeats || !t.matches(req, body, interaction.Request) {
+			continue
+		}
+		t.played[i] = true
+		return replayResponse(req, interaction.Response)
+	}
+	return nil, errors.Errorf("cassette %s: no interaction matches %s %s", t.path, req.Method, req.URL)
+}
+
+func (t *cassetteTransport) matches(req *http.Request, body []byte, recorded RequestInfo) bool {
+	for _, match := range t.matchers {
+		if !match(req, body, recorded) {
+			return false
+		}
+	}
+	return true
+}
+
+func replayResponse(req *http.Request, recorded ResponseInfo) (*http.Response, error) {
+	body, err := recordedBody(recorded.Body, recorded.BodyEncoding)
+	if err != nil {
+		return nil, err
+	}
+	header := recorded.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	proto := recorded.Proto
+	major, minor, ok := http.ParseHTTPVersion(proto)
+	if !ok {
+		proto, major, minor = "HTTP/1.1", 1, 1
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(recorded.StatusCode) + " " + http.StatusText(recorded.StatusCode),
+		StatusCode:    recorded.StatusCode,
+		Proto:         proto,
+		ProtoMajor:    major,
+		ProtoMinor:    minor,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func (t *cassetteTransport) record(req *http.Request, body []byte) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	if req.Body != nil {
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	resp, err := t.next.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "read response body")
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	interaction := Interaction{
+		Request: RequestInfo{
+			Url:        req.URL.String(),
+			Method:     req.Method,
+			QueryParam: req.URL.Query().Encode(),
+			Header:     redactHeader(req.Header, t.redactor),
+		},
+		Response: ResponseInfo{
+			StatusCode: resp.StatusCode,
+			Header:     redactHeader(resp.Header, t.redactor),
+			Proto:      resp.Proto,
+			ReceivedAt: time.Now().String(),
+		},
+	}
+	interaction.Request.Body, interaction.Request.BodyEncoding = cassetteBody(body)
+	interaction.Response.Body, interaction.Response.BodyEncoding = cassetteBody(respBody)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cassette.Interactions = append(t.cassette.Interactions, interaction)
+	if err := t.cassette.Save(t.path); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// cassetteBody returns b as stored in a cassette: as a string if it is
+// text, and encoded in base64 otherwise.
+func cassetteBody(b []byte) (interface{}, string) {
+	if utf8.Valid(b) {
+		return string(b), ""
+	}
+	return base64.StdEncoding.EncodeToString(b), "base64"
+}
+
+func recordedBody(body interface{}, encoding string) ([]byte, error) {
+	var s string
+	switch body := body.(type) {
+	case nil:
+	case string:
+		s = body
+	default:
+		// Bodies edited by hand may hold JSON values rather than strings.
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "encode recorded body")
+		}
+		s = string(b)
+	}
+	switch encoding {
+	case "":
+		return []byte(s), nil
+	case "base64":
+		b, err := base64.StdEncoding.DecodeString(s)
+		return b, errors.Wrap(err, "decode recorded body")
+	default:
+		return nil, fmt.Errorf("unknown body encoding %q", encoding)
+	}
+}
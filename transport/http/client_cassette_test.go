@@ -0,0 +1,120 @@
+package http_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/gin-gonic/gin"
+	"github.com/go-resty/resty/v2"
+)
+
+func TestWithClientCassette(t *testing.T) {
+	r := gin.New()
+	r.GET("/users", func(gCtx *gin.Context) {
+		gCtx.JSON(http.StatusOK, map[string]string{"page": gCtx.Query("page")})
+	})
+	r.POST("/users", func(gCtx *gin.Context) {
+		b, _ := ioutil.ReadAll(gCtx.Request.Body)
+		gCtx.Data(http.StatusOK, "application/json", b)
+	})
+	r.GET("/image", func(gCtx *gin.Context) {
+		gCtx.Data(http.StatusOK, "image/png", []byte{0x89, 'P', 'N', 'G', 0xff})
+	})
+	server := httptest.NewServer(r)
+	path := filepath.Join(t.TempDir(), "users.json")
+
+	call := func(client *httptransport.Client, method, path string, req interface{}) (json.RawMessage, error) {
+		var body json.RawMessage
+		_, err := client.Endpoint(httptransport.Req(method, path), httptransport.EncodeJSONRequest, httptransport.DecodeJSONResponse(&body))(context.Background(), req)
+		return body, err
+	}
+
+	recorder := httptransport.NewClient(resty.New().SetHeader("Authorization", "Bearer secret"),
+		httptransport.WithClientCassette(path, httptransport.CassetteRecord),
+		httptransport.WithClientHost(server.URL))
+	for _, tt := range []struct {
+		method, path string
+		req          interface{}
+	}{
+		{http.MethodGet, "/users?page=1", nil},
+		{http.MethodGet, "/users?page=2", nil},
+		{http.MethodPost, "/users", map[string]string{"name": "ann"}},
+	} {
+		if _, err := call(recorder, tt.method, tt.path, tt.req); err != nil {
+			t.Fatalf("record %s %s: %v", tt.method, tt.path, err)
+		}
+	}
+	var image string
+	if _, err := recorder.Endpoint(httptransport.Req(http.MethodGet, "/image"), httptransport.EncodeJSONRequest, httptransport.DecodeJSONResponse(&image))(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "secret") {
+		t.Errorf("secret recorded: %s", b)
+	}
+	cassette, err := httptransport.LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 4, len(cassette.Interactions); want != have {
+		t.Fatalf("want %d interactions, have %d", want, have)
+	}
+	if want, have := "base64", cassette.Interactions[3].Response.BodyEncoding; want != have {
+		t.Errorf("binary body encoding: want %q, have %q", want, have)
+	}
+
+	replayer := httptransport.NewClient(resty.New(),
+		httptransport.WithClientCassette(path, httptransport.CassetteReplay,
+			httptransport.CassetteMatchers(httptransport.MatchMethod, httptransport.MatchPath, httptransport.MatchQuery, httptransport.MatchBody)),
+		httptransport.WithClientHost("http://offline.invalid"))
+	body, err := call(replayer, http.MethodGet, "/users?page=2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := `{"page":"2"}`, string(body); want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+	body, err = call(replayer, http.MethodPost, "/users", map[string]string{"name": "ann"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := `{"name":"ann"}`, string(body); want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+
+	for _, tt := range []struct {
+		method, path string
+		req          interface{}
+	}{
+		{http.MethodGet, "/users?page=3", nil},
+		{http.MethodPost, "/users", map[string]string{"name": "bob"}},
+		// Interactions are replayed once.
+		{http.MethodGet, "/users?page=2", nil},
+	} {
+		if _, err := call(replayer, tt.method, tt.path, tt.req); err == nil || !strings.Contains(err.Error(), "no interaction matches") {
+			t.Errorf("%s %s: want unmatched error, have %v", tt.method, tt.path, err)
+		}
+	}
+}
+
+func TestWithClientCassetteMissing(t *testing.T) {
+	client := httptransport.NewClient(resty.New(),
+		httptransport.WithClientCassette(filepath.Join(t.TempDir(), "missing.json"), httptransport.CassetteReplay),
+		httptransport.WithClientHost("http://offline.invalid"))
+	var body json.RawMessage
+	if _, err := client.Endpoint(httptransport.Req(http.MethodGet, "/"), httptransport.EncodeJSONRequest, httptransport.DecodeJSONResponse(&body))(context.Background(), nil); err == nil {
+		t.Error("want error, have none")
+	}
+}
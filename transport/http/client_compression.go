@@ -0,0 +1,66 @@
+package http
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// WithClientCompression compresses the bodies of requests with encoding, one
+// of "gzip", "deflate" or "zstd", and sets their Content-Encoding. Only use
+// it with servers that decode compressed requests, such as Servers with
+// ServerDecompression. Bodies are compressed in memory, so that they can be
+// replayed.
+func WithClientCompression(encoding string) ClientOption {
+	return func(client *Client) {
+		wrapTransport(client, func(next http.RoundTripper) http.RoundTripper {
+			return &compressTransport{next: next, encoding: encoding}
+		})
+	}
+}
+
+type compressTransport struct {
+	next     http.RoundTripper
+	encoding string
+}
+
+func (t *compressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Body == http.NoBody || req.Header.Get("Content-Encoding") != "" {
+		return t.next.RoundTrip(req)
+	}
+
+	body, err := t.compress(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r := req.Clone(req.Context())
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	r.ContentLength = int64(len(body))
+	r.Header.Set("Content-Encoding", t.encoding)
+	r.Header.Del("Content-Length")
+	return t.next.RoundTrip(r)
+}
+
+func (t *compressTransport) compress(r io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	c := getCompressor(t.encoding, &buf)
+	if c == nil {
+		return nil, errors.Errorf("unsupported Content-Encoding %q", t.encoding)
+	}
+	defer putCompressor(t.encoding, c)
+	if _, err := io.Copy(c, r); err != nil {
+		c.Close()
+		return nil, errors.Wrap(err, "compress body")
+	}
+	if err := c.Close(); err != nil {
+		return nil, errors.Wrap(err, "compress body")
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,42 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// WithClientDeadlinePropagation sends the time remaining until the deadline
+// of each request in the TimeoutHeader, so that Servers with ServerDeadline
+// stop working on it once the Client has given up. The deadline is the
+// earliest of the deadline of the context and the timeout set by
+// WithClientTimeout. Retries send the time remaining when they are made.
+// Requests whose deadline has passed fail without being sent.
+func WithClientDeadlinePropagation() ClientOption {
+	return func(client *Client) {
+		wrapTransport(client, func(next http.RoundTripper) http.RoundTripper {
+			return &deadlineTransport{next: next}
+		})
+	}
+}
+
+type deadlineTransport struct {
+	next http.RoundTripper
+}
+
+func (t *deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	deadline, ok := req.Context().Deadline()
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, context.DeadlineExceeded
+	}
+	r := req.Clone(req.Context())
+	r.Header.Set(TimeoutHeader, encodeTimeout(remaining))
+	return t.next.RoundTrip(r)
+}
@@ -0,0 +1,46 @@
+package http
+
+import (
+	"net/url"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/pkg/errors"
+)
+
+// WithClientFaults injects the faults of f into the requests of the Client,
+// with ClientFaults.
+func WithClientFaults(f *FaultInjector) ClientOption {
+	return func(client *Client) {
+		client.client.OnBeforeRequest(ClientFaults(f))
+	}
+}
+
+// ClientFaults returns a resty middleware injecting the faults of f into
+// requests before they are sent. Rules match the path of the requests as
+// their route. Requests are delayed, and then failed with a StatusError for
+// rules with a Status, and with ErrInjectedFault, annotated with the Error of
+// the rule, for rules with an Error or Abort.
+func ClientFaults(f *FaultInjector) resty.RequestMiddleware {
+	return func(_ *resty.Client, req *resty.Request) error {
+		path := req.URL
+		if u, err := url.Parse(req.URL); err == nil {
+			path = u.Path
+		}
+		r, ok := f.fault(req.Method, path, path, req.Header)
+		if !ok {
+			return nil
+		}
+		if !wait(req.Context(), r.Delay) {
+			return req.Context().Err()
+		}
+		switch {
+		case r.Status != 0:
+			return NewStatusError(r.Status, ErrInjectedFault.Error())
+		case r.Error != "":
+			return errors.Wrap(ErrInjectedFault, r.Error)
+		case r.Abort:
+			return errors.Wrap(ErrInjectedFault, "connection aborted")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,74 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WithClientMetrics records every request sent by the Client with m, labelled
+// by its method and the host it is sent to. Each attempt of a retried request
+// is recorded. A request is in flight until the body of its response is read
+// or closed, when it is observed with the size of the body read.
+func WithClientMetrics(m Metrics) ClientOption {
+	return func(client *Client) {
+		wrapTransport(client, func(next http.RoundTripper) http.RoundTripper {
+			return &metricsTransport{next: next, metrics: m}
+		})
+	}
+}
+
+type metricsTransport struct {
+	next    http.RoundTripper
+	metrics Metrics
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	o := ClientObservation{Method: req.Method, Host: req.URL.Host}
+	if req.ContentLength > 0 {
+		o.RequestSize = req.ContentLength
+	}
+	t.metrics.ClientInFlight(o.Host, 1)
+	begin := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	o.Latency = time.Since(begin)
+	if err != nil {
+		o.Outcome = ClientOutcomeError
+		t.metrics.ClientInFlight(o.Host, -1)
+		t.metrics.ObserveClient(o)
+		return nil, err
+	}
+
+	o.Code, o.Outcome = resp.StatusCode, clientOutcome(resp.StatusCode)
+	resp.Body = &observedBody{ReadCloser: resp.Body, done: func(n int64) {
+		o.ResponseSize = n
+		t.metrics.ClientInFlight(o.Host, -1)
+		t.metrics.ObserveClient(o)
+	}}
+	return resp, nil
+}
+
+// observedBody calls done with the number of bytes read once the body is
+// read to its end or closed.
+type observedBody struct {
+	io.ReadCloser
+	n    int64
+	once sync.Once
+	done func(n int64)
+}
+
+func (b *observedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if err == io.EOF {
+		b.once.Do(func() { b.done(b.n) })
+	}
+	return n, err
+}
+
+func (b *observedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.done(b.n) })
+	return err
+}
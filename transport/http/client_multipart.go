@@ -0,0 +1,321 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/pkg/errors"
+)
+
+// MultipartFile describes a single file part of a multipart request body.
+// Exactly one of Path, Reader or Data should be set. Files given by Path are
+// opened when the body is sent and streamed from disk, so they are never
+// loaded into memory.
+type MultipartFile struct {
+	// Name is the file name reported in the Content-Disposition header. It
+	// defaults to the base name of Path, or to the form field name.
+	Name string
+	// ContentType of the part. It defaults to application/octet-stream.
+	ContentType string
+
+	Path   string
+	Reader io.Reader
+	Data   []byte
+}
+
+// EncodeMultipartRequest is a RestyEncodeRequestFunc that encodes a struct as
+// a multipart/form-data body. Fields are named by their `form` tag, the same
+// tag gin uses to bind multipart forms on the server side; untagged fields
+// are skipped. MultipartFile, *MultipartFile, []MultipartFile, io.Reader and
+// []byte fields become file parts, every other field is written as a plain
+// form value.
+//
+// The body is streamed to the connection rather than buffered. It is also
+// replayable, so it can be used together with WithClientRetry: paths are
+// reopened, io.Seekers are rewound and the bytes of any other io.Reader are
+// kept while the first attempt reads them.
+func EncodeMultipartRequest(c context.Context, r *resty.Request, request interface{}) error {
+	parts, err := multipartParts(request)
+	if err != nil {
+		return err
+	}
+
+	boundary, err := multipartBoundary()
+	if err != nil {
+		return err
+	}
+
+	r.SetHeader("Content-Type", "multipart/form-data; boundary="+boundary)
+	r.SetBody(&multipartBody{parts: parts, boundary: boundary})
+	r.SetContext(c)
+	return nil
+}
+
+type multipartPart struct {
+	field string
+	value string
+	file  *MultipartFile
+	// spool keeps the bytes of a non seekable reader that have been read.
+	spool *bytes.Buffer
+}
+
+func multipartParts(request interface{}) ([]*multipartPart, error) {
+	v := reflect.ValueOf(request)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, errors.New("multipart request is nil")
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("multipart request must be a struct, got %s", v.Kind())
+	}
+
+	parts := make([]*multipartPart, 0, v.NumField())
+	err := appendMultipartParts(&parts, v)
+	return parts, err
+}
+
+var (
+	multipartFileType = reflect.TypeOf(MultipartFile{})
+	readerType        = reflect.TypeOf((*io.Reader)(nil)).Elem()
+	bytesType         = reflect.TypeOf([]byte(nil))
+)
+
+func appendMultipartParts(parts *[]*multipartPart, v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		tf := v.Type().Field(i)
+		fv := v.Field(i)
+
+		if tf.Anonymous {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				if err := appendMultipartParts(parts, fv); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		name := strings.Split(tf.Tag.Get("form"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		if err := appendMultipartField(parts, name, fv); err != nil {
+			return errors.Wrapf(err, "multipart field %s", name)
+		}
+	}
+	return nil
+}
+
+func appendMultipartField(parts *[]*multipartPart, name string, fv reflect.Value) error {
+	switch {
+	case fv.Type() == multipartFileType:
+		f := fv.Interface().(MultipartFile)
+		*parts = append(*parts, &multipartPart{field: name, file: &f})
+		return nil
+	case fv.Type() == reflect.PtrTo(multipartFileType):
+		if fv.IsNil() {
+			return nil
+		}
+		f := *fv.Interface().(*MultipartFile)
+		*parts = append(*parts, &multipartPart{field: name, file: &f})
+		return nil
+	case fv.Type() == bytesType:
+		if fv.IsNil() {
+			return nil
+		}
+		*parts = append(*parts, &multipartPart{field: name, file: &MultipartFile{Data: fv.Bytes()}})
+		return nil
+	case fv.Type().Implements(readerType):
+		if fv.Kind() == reflect.Interface || fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				return nil
+			}
+		}
+		*parts = append(*parts, &multipartPart{field: name, file: &MultipartFile{Reader: fv.Interface().(io.Reader)}})
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if fv.IsNil() {
+			return nil
+		}
+		return appendMultipartField(parts, name, fv.Elem())
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < fv.Len(); i++ {
+			if err := appendMultipartField(parts, name, fv.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Struct, reflect.Map, reflect.Func, reflect.Chan:
+		if s, ok := fv.Interface().(fmt.Stringer); ok {
+			*parts = append(*parts, &multipartPart{field: name, value: s.String()})
+			return nil
+		}
+		return fmt.Errorf("unsupported type %s", fv.Type())
+	}
+
+	*parts = append(*parts, &multipartPart{field: name, value: fmt.Sprint(fv.Interface())})
+	return nil
+}
+
+func multipartBoundary() (string, error) {
+	var buf [30]byte
+	if _, err := io.ReadFull(rand.Reader, buf[:]); err != nil {
+		return "", errors.Wrap(err, "multipart boundary")
+	}
+	return fmt.Sprintf("%x", buf[:]), nil
+}
+
+// multipartBody streams the multipart encoding of its parts through a pipe.
+// The transport closes the request body once an attempt is over, so Close
+// arms the body to start from the first part again, which makes the body
+// replayable by retries.
+type multipartBody struct {
+	parts    []*multipartPart
+	boundary string
+
+	mu   sync.Mutex
+	pr   *io.PipeReader
+	done chan struct{}
+}
+
+func (b *multipartBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	if b.pr == nil {
+		pr, pw := io.Pipe()
+		prev, done := b.done, make(chan struct{})
+		b.pr, b.done = pr, done
+		go func() {
+			defer close(done)
+			// the writer of an abandoned attempt may still be unwinding.
+			if prev != nil {
+				<-prev
+			}
+			pw.CloseWithError(b.writeTo(pw))
+		}()
+	}
+	pr := b.pr
+	b.mu.Unlock()
+
+	return pr.Read(p)
+}
+
+func (b *multipartBody) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pr != nil {
+		b.pr.Close()
+		b.pr = nil
+	}
+	return nil
+}
+
+func (b *multipartBody) writeTo(w io.Writer) error {
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(b.boundary); err != nil {
+		return err
+	}
+
+	for _, part := range b.parts {
+		if part.file == nil {
+			if err := mw.WriteField(part.field, part.value); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := part.writeFile(mw); err != nil {
+			return errors.Wrapf(err, "multipart file %s", part.field)
+		}
+	}
+	return mw.Close()
+}
+
+func (p *multipartPart) writeFile(mw *multipart.Writer) error {
+	f := p.file
+
+	fileName := f.Name
+	if fileName == "" && f.Path != "" {
+		fileName = filepath.Base(f.Path)
+	}
+	if fileName == "" {
+		fileName = p.field
+	}
+	contentType := f.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(p.field), escapeQuotes(fileName)))
+	h.Set("Content-Type", contentType)
+	w, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case f.Path != "":
+		file, err := os.Open(f.Path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(w, file)
+		return err
+	case f.Data != nil:
+		_, err = w.Write(f.Data)
+		return err
+	case f.Reader != nil:
+		return p.copyReader(w)
+	}
+	return nil
+}
+
+// copyReader writes the reader of the part, rewinding it if it is an
+// io.Seeker. Any other reader is spooled while it is read, so a later attempt
+// replays what was already consumed before reading on.
+func (p *multipartPart) copyReader(w io.Writer) error {
+	if s, ok := p.file.Reader.(io.Seeker); ok {
+		if _, err := s.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		_, err := io.Copy(w, p.file.Reader)
+		return err
+	}
+
+	if p.spool == nil {
+		p.spool = new(bytes.Buffer)
+	}
+	if _, err := w.Write(p.spool.Bytes()); err != nil {
+		return err
+	}
+	_, err := io.Copy(w, io.TeeReader(p.file.Reader, p.spool))
+	return err
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
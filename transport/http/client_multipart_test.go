@@ -0,0 +1,120 @@
+package http_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/gin-gonic/gin"
+	"github.com/go-resty/resty/v2"
+)
+
+type uploadRequest struct {
+	Title  string                       `form:"title"`
+	Tags   []string                     `form:"tag"`
+	Avatar httptransport.MultipartFile  `form:"avatar"`
+	Doc    *httptransport.MultipartFile `form:"doc"`
+	Raw    []byte                       `form:"raw"`
+	Stream io.Reader                    `form:"stream"`
+	Skip   string
+}
+
+func TestEncodeMultipartRequestRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "doc.txt")
+	if err := ioutil.WriteFile(path, []byte("document"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var attempts int32
+	r := gin.New()
+	r.POST("/upload", func(c *gin.Context) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			ioutil.ReadAll(c.Request.Body)
+			c.Status(http.StatusServiceUnavailable)
+			return
+		}
+
+		form, err := c.MultipartForm()
+		if err != nil {
+			t.Error(err)
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		if want, have := "hello", form.Value["title"][0]; want != have {
+			t.Errorf("title: want %q, have %q", want, have)
+		}
+		if want, have := "a,b", strings.Join(form.Value["tag"], ","); want != have {
+			t.Errorf("tag: want %q, have %q", want, have)
+		}
+		if _, ok := form.Value["Skip"]; ok {
+			t.Error("untagged field was encoded")
+		}
+		for field, want := range map[string]string{
+			"avatar": "avatar.png:image/png:png bytes",
+			"doc":    "doc.txt:application/octet-stream:document",
+			"raw":    "raw:application/octet-stream:raw bytes",
+			"stream": "stream:application/octet-stream:streamed bytes",
+		} {
+			fh := form.File[field][0]
+			f, _ := fh.Open()
+			b, _ := ioutil.ReadAll(f)
+			f.Close()
+			if have := fh.Filename + ":" + fh.Header.Get("Content-Type") + ":" + string(b); want != have {
+				t.Errorf("%s: want %q, have %q", field, want, have)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{})
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	client := httptransport.NewClient(
+		resty.New().AddRetryCondition(func(r *resty.Response, err error) bool {
+			return r != nil && r.StatusCode() == http.StatusServiceUnavailable
+		}),
+		httptransport.WithClientHost(server.URL),
+		httptransport.WithClientRetry(1, time.Millisecond, time.Millisecond),
+	)
+	var out struct{}
+	e := client.Endpoint(
+		httptransport.Req(http.MethodPost, "/upload"),
+		httptransport.EncodeMultipartRequest,
+		httptransport.DecodeJSONResponse(&out),
+	)
+
+	_, err = e(context.Background(), uploadRequest{
+		Title:  "hello",
+		Tags:   []string{"a", "b"},
+		Avatar: httptransport.MultipartFile{Name: "avatar.png", ContentType: "image/png", Reader: strings.NewReader("png bytes")},
+		Doc:    &httptransport.MultipartFile{Path: path},
+		Raw:    []byte("raw bytes"),
+		Stream: io.MultiReader(strings.NewReader("streamed "), strings.NewReader("bytes")),
+		Skip:   "skip",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := int32(2), atomic.LoadInt32(&attempts); want != have {
+		t.Errorf("attempts: want %d, have %d", want, have)
+	}
+}
+
+func TestEncodeMultipartRequestNotStruct(t *testing.T) {
+	if err := httptransport.EncodeMultipartRequest(context.Background(), resty.New().R(), "x"); err == nil {
+		t.Error("want error for non struct request")
+	}
+}
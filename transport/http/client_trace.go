@@ -3,6 +3,7 @@ package http
 import (
 	"github.com/go-resty/resty/v2"
 	"net"
+	"net/http"
 	"time"
 )
 
@@ -18,14 +19,22 @@ type RequestInfo struct {
 	Url        string      `json:"url"`
 	Method     string      `json:"method"`
 	QueryParam string      `json:"query_param"`
+	Header     http.Header `json:"header,omitempty"`
 	Body       interface{} `json:"body"`
+	// BodyEncoding is "base64" when Body holds binary data encoded in
+	// base64, as in cassettes.
+	BodyEncoding string `json:"body_encoding,omitempty"`
 }
 
 type ResponseInfo struct {
 	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
 	Body       interface{} `json:"body"`
 	Proto      string      `json:"proto"`
 	ReceivedAt string      `json:"received_at"`
+	// BodyEncoding is "base64" when Body holds binary data encoded in
+	// base64, as in cassettes.
+	BodyEncoding string `json:"body_encoding,omitempty"`
 }
 
 type Info struct {
@@ -0,0 +1,132 @@
+package http
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressor is implemented by the writers of the supported content codings.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+var compressors = map[string]*sync.Pool{
+	"gzip": {New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}},
+	"deflate": {New: func() interface{} {
+		return zlib.NewWriter(nil)
+	}},
+	"zstd": {New: func() interface{} {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return w
+	}},
+}
+
+// getCompressor returns a compressor of encoding writing to w, or nil if
+// encoding is not supported. It must be released with putCompressor once
+// closed.
+func getCompressor(encoding string, w io.Writer) compressor {
+	pool, ok := compressors[encoding]
+	if !ok {
+		return nil
+	}
+	c := pool.Get().(compressor)
+	c.Reset(w)
+	return c
+}
+
+func putCompressor(encoding string, c compressor) {
+	compressors[encoding].Put(c)
+}
+
+// newDecompressor returns a reader decoding r with encoding, or nil if
+// encoding is not supported. Closing it closes r. zstd frames whose window is
+// larger than maxBytes fail with ErrRequestBodyTooLarge, so that decoding
+// them does not allocate more than the body may hold.
+func newDecompressor(encoding string, r io.ReadCloser, maxBytes int64) (io.ReadCloser, error) {
+	var (
+		d   io.ReadCloser
+		err error
+	)
+	switch encoding {
+	case "gzip", "x-gzip":
+		d, err = gzip.NewReader(r)
+	case "deflate":
+		d, err = zlib.NewReader(r)
+	case "zstd":
+		var z *zstd.Decoder
+		window := uint64(zstd.MaxWindowSize)
+		if maxBytes < zstd.MaxWindowSize {
+			window = uint64(maxBytes)
+		}
+		if window < zstdMinWindow {
+			window = zstdMinWindow
+		}
+		if z, err = zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true), zstd.WithDecoderMaxWindow(window)); err == nil {
+			d = zstdBody{z.IOReadCloser()}
+		}
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &decompressor{ReadCloser: d, body: r}, nil
+}
+
+// zstdMinWindow is the smallest window zstd frames may have.
+const zstdMinWindow = 1 << 10
+
+// zstdBody reports frames too large for the limit of the decoder as
+// ErrRequestBodyTooLarge.
+type zstdBody struct {
+	io.ReadCloser
+}
+
+func (b zstdBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if errors.Is(err, zstd.ErrWindowSizeExceeded) || errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+		err = ErrRequestBodyTooLarge
+	}
+	return n, err
+}
+
+type decompressor struct {
+	io.ReadCloser
+	body io.Closer
+}
+
+func (d *decompressor) Close() error {
+	d.ReadCloser.Close()
+	return d.body.Close()
+}
+
+// limitedBody fails reads with ErrRequestBodyTooLarge once more than n bytes
+// have been read.
+type limitedBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.n < 0 {
+		return 0, ErrRequestBodyTooLarge
+	}
+	if int64(len(p)) > b.n+1 {
+		p = p[:b.n+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.n -= int64(n)
+	if b.n < 0 {
+		return n + int(b.n), ErrRequestBodyTooLarge
+	}
+	return n, err
+}
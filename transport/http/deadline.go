@@ -0,0 +1,58 @@
+package http
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// TimeoutHeader is the header the remaining time of the deadline of a request
+// is sent in, in the format of the grpc-timeout header: at most 8 digits,
+// followed by one of the units H, M, S, m, u or n.
+const TimeoutHeader = "X-Request-Timeout"
+
+var timeoutUnits = []struct {
+	unit byte
+	d    time.Duration
+}{
+	{'n', time.Nanosecond},
+	{'u', time.Microsecond},
+	{'m', time.Millisecond},
+	{'S', time.Second},
+	{'M', time.Minute},
+	{'H', time.Hour},
+}
+
+// encodeTimeout formats d with the finest unit it fits in, rounding up so
+// that the receiver does not give up before the sender.
+func encodeTimeout(d time.Duration) string {
+	const max = 99999999
+	if d <= 0 {
+		return "0n"
+	}
+	for _, u := range timeoutUnits {
+		if v := (d + u.d - 1) / u.d; v <= max {
+			return strconv.FormatInt(int64(v), 10) + string(u.unit)
+		}
+	}
+	return strconv.Itoa(max) + "H"
+}
+
+func decodeTimeout(s string) (time.Duration, error) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, errors.New("invalid timeout " + strconv.Quote(s))
+	}
+	v, err := strconv.ParseUint(s[:len(s)-1], 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid timeout " + strconv.Quote(s))
+	}
+	for _, u := range timeoutUnits {
+		if u.unit == s[len(s)-1] {
+			if u.d > time.Nanosecond && time.Duration(v) > time.Duration(1<<63-1)/u.d {
+				return 1<<63 - 1, nil
+			}
+			return time.Duration(v) * u.d, nil
+		}
+	}
+	return 0, errors.New("invalid timeout unit " + strconv.Quote(s))
+}
@@ -0,0 +1,61 @@
+package http
+
+import "net/http"
+
+// StatusError is an error that carries the HTTP status code, and optionally
+// the headers, it should be encoded with. It implements StatusCoder and
+// Headerer, so DefaultErrorEncoder writes it as intended.
+type StatusError struct {
+	Code    int
+	Message string
+	Header  http.Header
+}
+
+// NewStatusError returns a StatusError with the given code and message.
+func NewStatusError(code int, message string) *StatusError {
+	return &StatusError{Code: code, Message: message}
+}
+
+// Error implements error.
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return http.StatusText(e.Code)
+}
+
+// StatusCode implements StatusCoder.
+func (e *StatusError) StatusCode() int {
+	return e.Code
+}
+
+// Headers implements Headerer.
+func (e *StatusError) Headers() http.Header {
+	return e.Header
+}
+
+var (
+	// ErrPreconditionFailed is returned when an If-Match or
+	// If-Unmodified-Since precondition of a request does not hold.
+	ErrPreconditionFailed = NewStatusError(http.StatusPreconditionFailed, "precondition failed")
+
+	// ErrRequestBodyTooLarge is returned by reads of a request body exceeding
+	// the limit of a Server.
+	ErrRequestBodyTooLarge = NewStatusError(http.StatusRequestEntityTooLarge, "request body too large")
+
+	// ErrUnsupportedContentEncoding is returned when a request body is sent
+	// with a Content-Encoding the Server can not decode.
+	ErrUnsupportedContentEncoding = NewStatusError(http.StatusUnsupportedMediaType, "unsupported Content-Encoding")
+
+	// ErrRequestTimeout is returned when a request body is read slower than
+	// a Server allows.
+	ErrRequestTimeout = NewStatusError(http.StatusRequestTimeout, "request body read too slowly")
+
+	// ErrHandlerTimeout is returned when an endpoint does not return within
+	// the timeout of a Server.
+	ErrHandlerTimeout = NewStatusError(http.StatusServiceUnavailable, "handler timeout")
+
+	// ErrDeadlineExceeded is returned when the deadline a caller propagated
+	// to a Server passes before the request is served.
+	ErrDeadlineExceeded = NewStatusError(http.StatusGatewayTimeout, "deadline exceeded")
+)
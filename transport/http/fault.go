@@ -0,0 +1,270 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+)
+
+// ErrInjectedFault is the error of the requests failed by a FaultInjector.
+var ErrInjectedFault = errors.New("injected fault")
+
+// FaultRule describes the fault injected into the requests it matches. A
+// request matches the first rule of a FaultInjector whose conditions all
+// hold, and the fault is then injected into Percent percent of them.
+type FaultRule struct {
+	// Route is the gin route pattern, such as "/users/:id", or the path of
+	// the requests. It matches every request if empty.
+	Route string `json:"route,omitempty"`
+	// Method matches every method if empty.
+	Method string `json:"method,omitempty"`
+	// Header holds the values headers of the requests must have.
+	Header map[string]string `json:"header,omitempty"`
+	// Percent is the percentage of the matching requests the fault is
+	// injected into, from 0 to 100.
+	Percent float64 `json:"percent"`
+
+	// Delay is waited before the request is served or sent, or until it is
+	// canceled. In JSON it is a duration string, such as "250ms".
+	Delay time.Duration `json:"delay,omitempty"`
+	// Status answers the request with this code. Clients fail the request
+	// with a StatusError of this code rather than sending it.
+	Status int `json:"status,omitempty"`
+	// Abort closes the connection of the request without answering it.
+	// Clients fail the request rather than sending it.
+	Abort bool `json:"abort,omitempty"`
+	// Error is the message of the error Clients fail the request with.
+	Error string `json:"error,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, reading Delay as a duration
+// string.
+func (r *FaultRule) UnmarshalJSON(b []byte) error {
+	type rule FaultRule
+	v := struct {
+		*rule
+		Delay string `json:"delay,omitempty"`
+	}{rule: (*rule)(r)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	r.Delay = 0
+	if v.Delay != "" {
+		d, err := time.ParseDuration(v.Delay)
+		if err != nil {
+			return errors.Wrap(err, "fault delay")
+		}
+		r.Delay = d
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, writing Delay as a duration string.
+func (r FaultRule) MarshalJSON() ([]byte, error) {
+	type rule FaultRule
+	v := struct {
+		rule
+		Delay string `json:"delay,omitempty"`
+	}{rule: rule(r)}
+	if r.Delay > 0 {
+		v.Delay = r.Delay.String()
+	}
+	return json.Marshal(v)
+}
+
+func (r FaultRule) matches(method, route, path string, header http.Header) bool {
+	if r.Method != "" && r.Method != method {
+		return false
+	}
+	if r.Route != "" && r.Route != route && r.Route != path {
+		return false
+	}
+	for name, value := range r.Header {
+		if header.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// FaultConfig is the content of the files a FaultInjector loads its rules
+// from, such as:
+//
+//	{
+//	  "enabled": true,
+//	  "rules": [
+//	    {"route": "/users/:id", "percent": 10, "delay": "2s"},
+//	    {"header": {"X-Fault": "abort"}, "percent": 100, "abort": true}
+//	  ]
+//	}
+type FaultConfig struct {
+	Enabled bool        `json:"enabled"`
+	Rules   []FaultRule `json:"rules"`
+}
+
+// FaultInjector injects faults into the requests of the Servers given
+// ServerFaults, and of the Clients given WithClientFaults, for resilience
+// testing. It is disabled until it is enabled with SetEnabled or by the
+// file it loads, so that it can be built into services and only turned on
+// where needed.
+type FaultInjector struct {
+	mu      sync.RWMutex
+	enabled bool
+	rules   []FaultRule
+	random  func() float64
+}
+
+// NewFaultInjector returns a disabled FaultInjector with rules.
+func NewFaultInjector(rules ...FaultRule) *FaultInjector {
+	return &FaultInjector{rules: rules, random: rand.Float64}
+}
+
+// SetEnabled enables or disables f.
+func (f *FaultInjector) SetEnabled(enabled bool) {
+	f.mu.Lock()
+	f.enabled = enabled
+	f.mu.Unlock()
+}
+
+// SetRules replaces the rules of f.
+func (f *FaultInjector) SetRules(rules []FaultRule) {
+	f.mu.Lock()
+	f.rules = append([]FaultRule(nil), rules...)
+	f.mu.Unlock()
+}
+
+// Config returns whether f is enabled and its rules.
+func (f *FaultInjector) Config() FaultConfig {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return FaultConfig{Enabled: f.enabled, Rules: append([]FaultRule(nil), f.rules...)}
+}
+
+// Load replaces the configuration of f with the FaultConfig in the JSON file
+// at path.
+func (f *FaultInjector) Load(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "read fault config")
+	}
+	var c FaultConfig
+	if err := json.Unmarshal(b, &c); err != nil {
+		return errors.Wrap(err, "decode fault config")
+	}
+	f.mu.Lock()
+	f.enabled, f.rules = c.Enabled, c.Rules
+	f.mu.Unlock()
+	return nil
+}
+
+// Watch loads the file at path, and reloads it whenever its modification
+// time or size changes, checking every interval until ctx is done. Errors are
+// logged to logger, and leave the configuration unchanged, so that a file
+// being edited does not disable faults by mistake. It returns the error of
+// the first load, without watching, if the file can not be loaded.
+func (f *FaultInjector) Watch(ctx context.Context, path string, interval time.Duration, logger log.Logger) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.Wrap(err, "stat fault config")
+	}
+	if err := f.Load(path); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			latest, err := os.Stat(path)
+			if err != nil {
+				logger.Log("msg", "fault config not reloaded", "path", path, "err", err)
+				continue
+			}
+			if latest.ModTime().Equal(info.ModTime()) && latest.Size() == info.Size() {
+				continue
+			}
+			if err := f.Load(path); err != nil {
+				logger.Log("msg", "fault config not reloaded", "path", path, "err", err)
+				continue
+			}
+			info = latest
+			logger.Log("msg", "fault config reloaded", "path", path, "enabled", f.Config().Enabled)
+		}
+	}()
+	return nil
+}
+
+// fault returns the rule matching a request, if f is enabled and the fault
+// is to be injected.
+func (f *FaultInjector) fault(method, route, path string, header http.Header) (FaultRule, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if !f.enabled {
+		return FaultRule{}, false
+	}
+	for _, r := range f.rules {
+		if r.matches(method, route, path, header) {
+			return r, f.random()*100 < r.Percent
+		}
+	}
+	return FaultRule{}, false
+}
+
+// wait waits for d, and reports whether it elapsed before ctx was done.
+func wait(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// ServerFaults injects the faults of f into the requests of the Server,
+// before the ServerBefore functions given before it: they are delayed,
+// answered with a StatusError, whose message is ErrInjectedFault, through the
+// error handler and encoder, or have their connection closed.
+func ServerFaults(f *FaultInjector) ServerOption {
+	return func(s *Server) {
+		s.before = append([]RequestFunc{f.inject}, s.before...)
+	}
+}
+
+func (f *FaultInjector) inject(ctx context.Context, gCtx *gin.Context) context.Context {
+	r, ok := f.fault(gCtx.Request.Method, gCtx.FullPath(), gCtx.Request.URL.Path, gCtx.Request.Header)
+	if !ok {
+		return ctx
+	}
+	if !wait(ctx, r.Delay) {
+		Abort(gCtx, ctx.Err())
+		return ctx
+	}
+	switch {
+	case r.Abort:
+		if conn, _, err := gCtx.Writer.Hijack(); err == nil {
+			conn.Close()
+		}
+		gCtx.Abort()
+	case r.Status != 0:
+		Abort(gCtx, NewStatusError(r.Status, ErrInjectedFault.Error()))
+	}
+	return ctx
+}
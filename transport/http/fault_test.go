@@ -0,0 +1,136 @@
+package http_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/fitan/gink/transport/http/httptest"
+	"github.com/go-kit/log"
+	"github.com/go-resty/resty/v2"
+)
+
+func TestServerFaults(t *testing.T) {
+	faults := httptransport.NewFaultInjector(
+		httptransport.FaultRule{Route: "/users/:id", Header: map[string]string{"X-Fault": "status"}, Percent: 100, Status: http.StatusServiceUnavailable},
+		httptransport.FaultRule{Route: "/users/:id", Header: map[string]string{"X-Fault": "never"}, Percent: 0, Status: http.StatusServiceUnavailable},
+		httptransport.FaultRule{Method: http.MethodDelete, Percent: 100, Delay: 50 * time.Millisecond},
+		httptransport.FaultRule{Header: map[string]string{"X-Fault": "abort"}, Percent: 100, Abort: true},
+	)
+	h := httptest.New(t)
+	handler := httptransport.NewServer(
+		func(context.Context, interface{}) (interface{}, error) { return "ok", nil },
+		httptransport.NopRequestDecoder,
+		encodeString,
+		httptransport.ServerFaults(faults),
+		h.Capture(),
+	)
+	h.Mount(http.MethodGet, "/users/:id", handler).Mount(http.MethodDelete, "/users/:id", handler)
+
+	// Faults are disabled by default.
+	h.GET("/users/1").Header("X-Fault", "status").Do().Status(http.StatusOK).NoErrors()
+
+	faults.SetEnabled(true)
+	h.GET("/users/1").Header("X-Fault", "status").Do().
+		Status(http.StatusServiceUnavailable).
+		BodyEquals(httptransport.ErrInjectedFault.Error()).
+		Finalizes(http.StatusServiceUnavailable).
+		HandlesError(httptransport.ErrInjectedFault.Error())
+	h.GET("/users/1").Header("X-Fault", "never").Do().Status(http.StatusOK)
+	h.GET("/users/1").Do().Status(http.StatusOK)
+
+	start := time.Now()
+	h.DELETE("/users/1").Do().Status(http.StatusOK)
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("want a delay of 50ms, have %s", elapsed)
+	}
+
+	server := h.Start()
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/users/1", nil)
+	req.Header.Set("X-Fault", "abort")
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		resp.Body.Close()
+		t.Errorf("want connection aborted, have %s", resp.Status)
+	}
+}
+
+func TestClientFaults(t *testing.T) {
+	upstream := httptest.NewUpstream(t)
+	upstream.On(http.MethodGet, "/users/ann").Reply(httptest.JSON(http.StatusOK, `"ann"`)).Times(1)
+
+	faults := httptransport.NewFaultInjector(
+		httptransport.FaultRule{Route: "/users/ann", Percent: 100, Error: "boom"},
+		httptransport.FaultRule{Route: "/users/bob", Percent: 100, Status: http.StatusTooManyRequests},
+	)
+	faults.SetEnabled(true)
+	client := httptransport.NewClient(resty.New(), httptransport.WithClientHost(upstream.URL()), httptransport.WithClientFaults(faults))
+	get := func(path string) error {
+		var body json.RawMessage
+		_, err := client.Endpoint(httptransport.Req(http.MethodGet, path), httptransport.EncodeJSONRequest, httptransport.DecodeJSONResponse(&body))(context.Background(), nil)
+		return err
+	}
+
+	if err := get("/users/ann"); !errors.Is(err, httptransport.ErrInjectedFault) {
+		t.Errorf("want ErrInjectedFault, have %v", err)
+	}
+	var statusErr *httptransport.StatusError
+	if err := get("/users/bob"); !errors.As(err, &statusErr) || statusErr.Code != http.StatusTooManyRequests {
+		t.Errorf("want status error 429, have %v", err)
+	}
+
+	faults.SetEnabled(false)
+	if err := get("/users/ann"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFaultInjectorWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "faults.json")
+	write := func(c httptransport.FaultConfig) {
+		b, err := json.Marshal(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(httptransport.FaultConfig{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	faults := httptransport.NewFaultInjector()
+	if err := faults.Watch(ctx, path, 5*time.Millisecond, log.NewNopLogger()); err != nil {
+		t.Fatal(err)
+	}
+	if faults.Config().Enabled {
+		t.Fatal("want disabled")
+	}
+
+	want := httptransport.FaultRule{Route: "/users/:id", Method: http.MethodGet, Percent: 25, Delay: 1500 * time.Millisecond, Status: http.StatusBadGateway}
+	write(httptransport.FaultConfig{Enabled: true, Rules: []httptransport.FaultRule{want}})
+	deadline := time.Now().Add(2 * time.Second)
+	for !faults.Config().Enabled {
+		if time.Now().After(deadline) {
+			t.Fatal("config not reloaded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	rules := faults.Config().Rules
+	if len(rules) != 1 || rules[0].Route != want.Route || rules[0].Delay != want.Delay || rules[0].Status != want.Status || rules[0].Percent != want.Percent {
+		t.Errorf("want %+v, have %+v", want, rules)
+	}
+
+	// Invalid configurations are not loaded.
+	ioutil.WriteFile(path, []byte(`{"enabled": false, "rules": [{"delay": "soon"}]}`), 0o644)
+	time.Sleep(50 * time.Millisecond)
+	if !faults.Config().Enabled {
+		t.Error("invalid config loaded")
+	}
+}
@@ -0,0 +1,319 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/kit/sd"
+	"github.com/pkg/errors"
+)
+
+// HealthCheck reports whether a dependency of the service is healthy. It
+// should return once ctx is done.
+type HealthCheck func(ctx context.Context) error
+
+// Statuses of HealthReport and CheckResult.
+const (
+	HealthStatusOK   = "ok"
+	HealthStatusFail = "fail"
+)
+
+// HealthReport is the result of the checks of a Health, as written by its
+// handlers.
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// CheckResult is the result of a single HealthCheck.
+type CheckResult struct {
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// Health runs named checks and serves their results on /healthz and /readyz.
+// Liveness checks tell whether the process works at all, and should only
+// check the process itself; readiness checks tell whether it can serve
+// requests, and may check its dependencies.
+type Health struct {
+	ttl     time.Duration
+	timeout time.Duration
+	runner  *Runner
+
+	mu        sync.Mutex
+	liveness  []namedCheck
+	readiness []namedCheck
+	live      cachedReport
+	ready     cachedReport
+}
+
+type namedCheck struct {
+	name    string
+	timeout time.Duration
+	check   HealthCheck
+}
+
+type cachedReport struct {
+	mu      sync.Mutex
+	report  HealthReport
+	at      time.Time
+	running chan struct{}
+}
+
+// HealthOption sets an optional parameter for Health.
+type HealthOption func(*Health)
+
+// HealthCacheTTL sets how long results are reused, so that frequent probes
+// do not run the checks on every request. By default it is one second.
+func HealthCacheTTL(d time.Duration) HealthOption {
+	return func(h *Health) { h.ttl = d }
+}
+
+// HealthCheckTimeout sets the timeout of the checks added without one, so
+// that a check that never returns can not hang the probes. By default it is
+// five seconds.
+func HealthCheckTimeout(d time.Duration) HealthOption {
+	return func(h *Health) { h.timeout = d }
+}
+
+// HealthRunner makes readiness fail once r shuts down, so that load
+// balancers stop sending requests while it drains.
+func HealthRunner(r *Runner) HealthOption {
+	return func(h *Health) { h.runner = r }
+}
+
+// NewHealth returns a Health without checks.
+func NewHealth(options ...HealthOption) *Health {
+	h := &Health{ttl: time.Second, timeout: 5 * time.Second}
+	for _, option := range options {
+		option(h)
+	}
+	return h
+}
+
+// AddLivenessCheck adds a check run by /healthz and /readyz, failing if it
+// does not return within timeout. A timeout of 0 or less uses the one set
+// with HealthCheckTimeout.
+func (h *Health) AddLivenessCheck(name string, timeout time.Duration, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.liveness = append(h.liveness, h.namedCheck(name, timeout, check))
+}
+
+// AddReadinessCheck adds a check run by /readyz, failing if it does not
+// return within timeout. A timeout of 0 or less uses the one set with
+// HealthCheckTimeout.
+func (h *Health) AddReadinessCheck(name string, timeout time.Duration, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.readiness = append(h.readiness, h.namedCheck(name, timeout, check))
+}
+
+func (h *Health) namedCheck(name string, timeout time.Duration, check HealthCheck) namedCheck {
+	if timeout <= 0 {
+		timeout = h.timeout
+	}
+	return namedCheck{name, timeout, check}
+}
+
+// Register serves LivenessHandler on /healthz and ReadinessHandler on
+// /readyz of routes.
+func (h *Health) Register(routes gin.IRoutes) {
+	routes.GET("/healthz", h.LivenessHandler)
+	routes.HEAD("/healthz", h.LivenessHandler)
+	routes.GET("/readyz", h.ReadinessHandler)
+	routes.HEAD("/readyz", h.ReadinessHandler)
+}
+
+// LivenessHandler writes the report of the liveness checks, with status 200
+// if they pass and 503 otherwise.
+func (h *Health) LivenessHandler(gCtx *gin.Context) {
+	writeHealthReport(gCtx, h.Liveness(gCtx.Request.Context()))
+}
+
+// ReadinessHandler writes the report of the liveness and readiness checks,
+// with status 200 if they pass and 503 otherwise.
+func (h *Health) ReadinessHandler(gCtx *gin.Context) {
+	writeHealthReport(gCtx, h.Readiness(gCtx.Request.Context()))
+}
+
+func writeHealthReport(gCtx *gin.Context, report HealthReport) {
+	code := http.StatusOK
+	if report.Status != HealthStatusOK {
+		code = http.StatusServiceUnavailable
+	}
+	gCtx.Header("Cache-Control", "no-store")
+	gCtx.JSON(code, report)
+}
+
+// Liveness runs the liveness checks, or returns their cached results.
+func (h *Health) Liveness(ctx context.Context) HealthReport {
+	h.mu.Lock()
+	checks := h.liveness
+	h.mu.Unlock()
+	return h.live.get(ctx, h.ttl, checks)
+}
+
+// Readiness runs the liveness and readiness checks, or returns their cached
+// results. The state of the Runner set with HealthRunner is never cached, and
+// is reported as the "shutdown" check.
+func (h *Health) Readiness(ctx context.Context) HealthReport {
+	h.mu.Lock()
+	checks := append(append([]namedCheck(nil), h.liveness...), h.readiness...)
+	h.mu.Unlock()
+	report := h.ready.get(ctx, h.ttl, checks)
+	if h.runner == nil {
+		return report
+	}
+
+	result := CheckResult{Status: HealthStatusOK}
+	if !h.runner.Ready() {
+		result = CheckResult{Status: HealthStatusFail, Error: "shutting down"}
+		report.Status = HealthStatusFail
+	}
+	results := make(map[string]CheckResult, len(report.Checks)+1)
+	for name, r := range report.Checks {
+		results[name] = r
+	}
+	results["shutdown"] = result
+	report.Checks = results
+	return report
+}
+
+// get returns the cached report if it is fresh, and runs checks otherwise.
+// Concurrent callers wait for a single run, which is not canceled with the
+// request of the caller starting it, since its result is shared. Callers
+// whose ctx is done before the run ends get a failing report.
+func (c *cachedReport) get(ctx context.Context, ttl time.Duration, checks []namedCheck) HealthReport {
+	c.mu.Lock()
+	if !c.at.IsZero() && time.Since(c.at) < ttl {
+		report := c.report
+		c.mu.Unlock()
+		return report
+	}
+	running := c.running
+	if running == nil {
+		running = make(chan struct{})
+		c.running = running
+		go func() {
+			report := runChecks(detachedContext{ctx}, checks)
+			c.mu.Lock()
+			c.report, c.at, c.running = report, time.Now(), nil
+			c.mu.Unlock()
+			close(running)
+		}()
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-running:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.report
+	case <-ctx.Done():
+		return HealthReport{Status: HealthStatusFail}
+	}
+}
+
+func runChecks(ctx context.Context, checks []namedCheck) HealthReport {
+	var (
+		report = HealthReport{Status: HealthStatusOK, Checks: make(map[string]CheckResult, len(checks))}
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+	)
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c namedCheck) {
+			defer wg.Done()
+			begin := time.Now()
+			err := c.run(ctx)
+			result := CheckResult{Status: HealthStatusOK, LatencyMS: float64(time.Since(begin)) / float64(time.Millisecond)}
+			if err != nil {
+				result.Status, result.Error = HealthStatusFail, err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[c.name] = result
+			if err != nil {
+				report.Status = HealthStatusFail
+			}
+		}(c)
+	}
+	wg.Wait()
+	return report
+}
+
+// run runs the check, failing once its timeout has passed even if the check
+// does not return.
+func (c namedCheck) run(ctx context.Context) error {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- c.check(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "check did not return")
+	}
+}
+
+// InstancerCheck is a HealthCheck failing when instancer reports an error or
+// no instances, such as the Instancer of a Client created with
+// WithClientKitLb.
+func InstancerCheck(instancer sd.Instancer) HealthCheck {
+	return func(ctx context.Context) error {
+		// Instancers send their state on registration, and block until it is
+		// received: keep receiving until the channel is deregistered.
+		events := make(chan sd.Event, 1)
+		instancer.Register(events)
+		var (
+			event    sd.Event
+			received bool
+		)
+		select {
+		case event = <-events:
+			received = true
+		case <-ctx.Done():
+		}
+		done := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-events:
+				case <-done:
+					return
+				}
+			}
+		}()
+		instancer.Deregister(events)
+		close(done)
+
+		if !received {
+			return ctx.Err()
+		}
+		if event.Err != nil {
+			return event.Err
+		}
+		if len(event.Instances) == 0 {
+			return errors.New("no instances")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,212 @@
+package http_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/kit/sd"
+)
+
+func getHealth(t *testing.T, url string) (int, httptransport.HealthReport) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var report httptransport.HealthReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, report
+}
+
+func TestHealth(t *testing.T) {
+	var (
+		runs    int32
+		healthy atomic.Value
+	)
+	healthy.Store(true)
+	h := httptransport.NewHealth(httptransport.HealthCacheTTL(100 * time.Millisecond))
+	h.AddLivenessCheck("goroutines", time.Second, func(context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	})
+	h.AddReadinessCheck("db", time.Second, func(context.Context) error {
+		if !healthy.Load().(bool) {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	h.AddReadinessCheck("slow", 20*time.Millisecond, func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	h.AddReadinessCheck("panics", time.Second, func(context.Context) error { panic("boom") })
+
+	r := gin.New()
+	h.Register(r.Group("/internal"))
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	code, report := getHealth(t, server.URL+"/internal/healthz")
+	if want, have := http.StatusOK, code; want != have {
+		t.Errorf("healthz: want %d, have %d", want, have)
+	}
+	if want, have := httptransport.HealthStatusOK, report.Checks["goroutines"].Status; want != have || len(report.Checks) != 1 {
+		t.Errorf("healthz: want %s, have %+v", want, report.Checks)
+	}
+
+	begin := time.Now()
+	code, report = getHealth(t, server.URL+"/internal/readyz")
+	if elapsed := time.Since(begin); elapsed > 500*time.Millisecond {
+		t.Errorf("readyz took %s despite check timeouts", elapsed)
+	}
+	if want, have := http.StatusServiceUnavailable, code; want != have {
+		t.Errorf("readyz: want %d, have %d", want, have)
+	}
+	for name, want := range map[string]string{
+		"goroutines": httptransport.HealthStatusOK,
+		"db":         httptransport.HealthStatusOK,
+		"slow":       httptransport.HealthStatusFail,
+		"panics":     httptransport.HealthStatusFail,
+	} {
+		if have := report.Checks[name]; want != have.Status {
+			t.Errorf("readyz: %s: want %s, have %+v", name, want, have)
+		}
+	}
+	if latency := report.Checks["slow"].LatencyMS; latency < 20 {
+		t.Errorf("slow: latency %.1fms", latency)
+	}
+
+	// Results are cached: probes within the TTL do not run the checks.
+	for i := 0; i < 5; i++ {
+		getHealth(t, server.URL+"/internal/healthz")
+	}
+	if want, have := int32(2), atomic.LoadInt32(&runs); want != have {
+		t.Errorf("runs: want %d, have %d", want, have)
+	}
+	healthy.Store(false)
+	time.Sleep(150 * time.Millisecond)
+	_, report = getHealth(t, server.URL+"/internal/readyz")
+	if want, have := "connection refused", report.Checks["db"].Error; want != have {
+		t.Errorf("db: want %q, have %q", want, have)
+	}
+}
+
+func TestHealthHangingCheck(t *testing.T) {
+	hang := make(chan struct{})
+	defer close(hang)
+	h := httptransport.NewHealth(
+		httptransport.HealthCheckTimeout(200*time.Millisecond),
+		httptransport.HealthCacheTTL(0),
+	)
+	// The check ignores its context, and was added without a timeout.
+	h.AddLivenessCheck("hangs", 0, func(context.Context) error {
+		<-hang
+		return nil
+	})
+
+	done := make(chan httptransport.HealthReport, 1)
+	begin := time.Now()
+	go func() { done <- h.Liveness(context.Background()) }()
+
+	// Probes do not wait for the run in progress past their own deadline.
+	time.Sleep(20 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	probe := time.Now()
+	report := h.Liveness(ctx)
+	if elapsed := time.Since(probe); elapsed > 100*time.Millisecond {
+		t.Errorf("probe took %s while checks were running", elapsed)
+	}
+	if want, have := httptransport.HealthStatusFail, report.Status; want != have {
+		t.Errorf("probe: want %s, have %s", want, have)
+	}
+
+	select {
+	case report = <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("check without a timeout hangs the probes")
+	}
+	if elapsed := time.Since(begin); elapsed < 200*time.Millisecond {
+		t.Errorf("check failed after %s, before the default timeout", elapsed)
+	}
+	if want, have := httptransport.HealthStatusFail, report.Checks["hangs"].Status; want != have {
+		t.Errorf("hangs: want %s, have %+v", want, report.Checks["hangs"])
+	}
+}
+
+func TestHealthRunner(t *testing.T) {
+	r := gin.New()
+	runner := httptransport.NewRunner("127.0.0.1:0", r, httptransport.RunnerSignals())
+	h := httptransport.NewHealth(httptransport.HealthRunner(runner))
+	h.Register(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	// The runner is not serving yet.
+	code, report := getHealth(t, server.URL+"/readyz")
+	if want, have := http.StatusServiceUnavailable, code; want != have {
+		t.Errorf("before Run: want %d, have %d", want, have)
+	}
+	if want, have := "shutting down", report.Checks["shutdown"].Error; want != have {
+		t.Errorf("before Run: want %q, have %q", want, have)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- runner.Run(ctx) }()
+	for i := 0; !runner.Ready() && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if code, _ := getHealth(t, server.URL+"/readyz"); code != http.StatusOK {
+		t.Errorf("running: want %d, have %d", http.StatusOK, code)
+	}
+	cancel()
+	<-done
+	if code, _ := getHealth(t, server.URL+"/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("shut down: want %d, have %d", http.StatusServiceUnavailable, code)
+	}
+	if code, _ := getHealth(t, server.URL+"/healthz"); code != http.StatusOK {
+		t.Errorf("liveness after shutdown: want %d, have %d", http.StatusOK, code)
+	}
+}
+
+type errInstancer struct{ err error }
+
+func (i errInstancer) Register(ch chan<- sd.Event) { ch <- sd.Event{Err: i.err} }
+func (errInstancer) Deregister(chan<- sd.Event)    {}
+func (errInstancer) Stop()                         {}
+
+func TestInstancerCheck(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		instancer sd.Instancer
+		err       string
+	}{
+		{"instances", sd.FixedInstancer{"a:80", "b:80"}, ""},
+		{"empty", sd.FixedInstancer{}, "no instances"},
+		{"error", errInstancer{errors.New("consul unreachable")}, "consul unreachable"},
+	} {
+		err := httptransport.InstancerCheck(tt.instancer)(context.Background())
+		if have := errString(err); tt.err != have {
+			t.Errorf("%s: want %q, have %q", tt.name, tt.err, have)
+		}
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,376 @@
+// Package httptest provides utilities for testing the http transport: a
+// Harness mounting Servers on an in-memory gin engine, with requests built
+// fluently and assertions on their responses, and an Upstream faking the
+// services called by Clients.
+package httptest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	stdhttptest "net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/kit/transport"
+	"github.com/tidwall/gjson"
+)
+
+// Harness mounts Servers on an in-memory gin engine, serves requests built
+// with its Request method, and captures the finalizer and error handler calls
+// of the Servers given its Capture option.
+type Harness struct {
+	t      testing.TB
+	engine *gin.Engine
+
+	mu        sync.Mutex
+	finalized []Finalized
+	errors    []HandledError
+}
+
+// New returns a Harness reporting failed assertions to t.
+func New(t testing.TB) *Harness {
+	return &Harness{t: t, engine: gin.New()}
+}
+
+// Engine returns the gin engine of h, to mount other handlers or middleware.
+func (h *Harness) Engine() *gin.Engine {
+	return h.engine
+}
+
+// Mount mounts s on method and path, a gin route pattern. It returns h so
+// that Servers can be mounted in a chain.
+func (h *Harness) Mount(method, path string, s *httptransport.Server) *Harness {
+	h.engine.Handle(method, path, s.ServeHTTP)
+	return h
+}
+
+// Start serves the engine of h on a loopback address, for tests that need a
+// real connection, such as tests of a Client. The server is closed when the
+// test ends.
+func (h *Harness) Start() *stdhttptest.Server {
+	server := stdhttptest.NewServer(h.engine)
+	h.t.Cleanup(server.Close)
+	return server
+}
+
+// Finalized is a call of a ServerFinalizerFunc captured by a Harness.
+type Finalized struct {
+	Ctx    context.Context
+	Method string
+	Path   string
+	Code   int
+	Header http.Header
+	Size   int64
+}
+
+// HandledError is a call of the error handler of a Server captured by a
+// Harness.
+type HandledError struct {
+	Ctx context.Context
+	Err error
+}
+
+// Capture returns a ServerOption capturing the finalizer and error handler
+// calls of a Server. It replaces the error handler of the Server, so give it
+// after ServerErrorHandler.
+func (h *Harness) Capture() httptransport.ServerOption {
+	return func(s *httptransport.Server) {
+		httptransport.ServerFinalizer(h.finalize)(s)
+		httptransport.ServerErrorHandler(transport.ErrorHandlerFunc(h.handleError))(s)
+	}
+}
+
+func (h *Harness) finalize(ctx context.Context, code int, gCtx *gin.Context) {
+	f := Finalized{Ctx: ctx, Method: gCtx.Request.Method, Path: gCtx.Request.URL.Path, Code: code}
+	f.Header, _ = ctx.Value(httptransport.ContextKeyResponseHeaders).(http.Header)
+	f.Size, _ = ctx.Value(httptransport.ContextKeyResponseSize).(int64)
+	h.mu.Lock()
+	h.finalized = append(h.finalized, f)
+	h.mu.Unlock()
+}
+
+func (h *Harness) handleError(ctx context.Context, err error) {
+	h.mu.Lock()
+	h.errors = append(h.errors, HandledError{Ctx: ctx, Err: err})
+	h.mu.Unlock()
+}
+
+// Finalized returns the finalizer calls captured so far.
+func (h *Harness) Finalized() []Finalized {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Finalized(nil), h.finalized...)
+}
+
+// Errors returns the error handler calls captured so far.
+func (h *Harness) Errors() []HandledError {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]HandledError(nil), h.errors...)
+}
+
+// Request starts building a request to path, which may hold a query.
+func (h *Harness) Request(method, path string) *Request {
+	return &Request{h: h, method: method, path: path, header: make(http.Header), query: make(url.Values)}
+}
+
+// GET starts building a GET request to path.
+func (h *Harness) GET(path string) *Request { return h.Request(http.MethodGet, path) }
+
+// POST starts building a POST request to path.
+func (h *Harness) POST(path string) *Request { return h.Request(http.MethodPost, path) }
+
+// PUT starts building a PUT request to path.
+func (h *Harness) PUT(path string) *Request { return h.Request(http.MethodPut, path) }
+
+// DELETE starts building a DELETE request to path.
+func (h *Harness) DELETE(path string) *Request { return h.Request(http.MethodDelete, path) }
+
+// Request is a request being built for a Harness. Send it with Do.
+type Request struct {
+	h      *Harness
+	ctx    context.Context
+	method string
+	path   string
+	header http.Header
+	query  url.Values
+	body   io.Reader
+}
+
+// Context sets the context the request is served with.
+func (r *Request) Context(ctx context.Context) *Request {
+	r.ctx = ctx
+	return r
+}
+
+// Header adds a header to the request.
+func (r *Request) Header(name, value string) *Request {
+	r.header.Add(name, value)
+	return r
+}
+
+// Query adds a query parameter to the request.
+func (r *Request) Query(name, value string) *Request {
+	r.query.Add(name, value)
+	return r
+}
+
+// Body sets the body of the request.
+func (r *Request) Body(body io.Reader) *Request {
+	r.body = body
+	return r
+}
+
+// JSON sets the body of the request to v encoded as JSON, and its
+// Content-Type to application/json. A string or []byte is sent as is.
+func (r *Request) JSON(v interface{}) *Request {
+	var b []byte
+	switch v := v.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		var err error
+		if b, err = json.Marshal(v); err != nil {
+			r.h.t.Fatalf("encode request body: %v", err)
+		}
+	}
+	r.header.Set("Content-Type", "application/json")
+	return r.Body(bytes.NewReader(b))
+}
+
+// Do serves the request and returns its response.
+func (r *Request) Do() *Response {
+	r.h.t.Helper()
+	target := r.path
+	if len(r.query) > 0 {
+		sep := "?"
+		if strings.Contains(target, "?") {
+			sep = "&"
+		}
+		target += sep + r.query.Encode()
+	}
+	req := stdhttptest.NewRequest(r.method, target, r.body)
+	if r.ctx != nil {
+		req = req.WithContext(r.ctx)
+	}
+	for name, values := range r.header {
+		req.Header[name] = values
+	}
+
+	finalized, errors := len(r.h.Finalized()), len(r.h.Errors())
+	rec := stdhttptest.NewRecorder()
+	r.h.engine.ServeHTTP(rec, req)
+	return &Response{
+		ResponseRecorder: rec,
+		t:                r.h.t,
+		finalized:        r.h.Finalized()[finalized:],
+		errors:           r.h.Errors()[errors:],
+	}
+}
+
+// Response is the response to a Request. Its assertion methods report
+// failures to the test of the Harness, and return the Response so that they
+// can be chained.
+type Response struct {
+	*stdhttptest.ResponseRecorder
+	t         testing.TB
+	finalized []Finalized
+	errors    []HandledError
+}
+
+// Finalized returns the finalizer calls captured while serving the request.
+func (r *Response) Finalized() []Finalized {
+	return r.finalized
+}
+
+// Errors returns the error handler calls captured while serving the request.
+func (r *Response) Errors() []HandledError {
+	return r.errors
+}
+
+// Status asserts the status code of the response.
+func (r *Response) Status(want int) *Response {
+	r.t.Helper()
+	if have := r.Code; want != have {
+		r.t.Errorf("status: want %d, have %d: %s", want, have, r.Body)
+	}
+	return r
+}
+
+// HasHeader asserts the value of a header of the response.
+func (r *Response) HasHeader(name, want string) *Response {
+	r.t.Helper()
+	if have := r.Header().Get(name); want != have {
+		r.t.Errorf("header %s: want %q, have %q", name, want, have)
+	}
+	return r
+}
+
+// NoHeader asserts that the response has no header name.
+func (r *Response) NoHeader(name string) *Response {
+	r.t.Helper()
+	if have, ok := r.Header()[http.CanonicalHeaderKey(name)]; ok {
+		r.t.Errorf("header %s: want none, have %q", name, have)
+	}
+	return r
+}
+
+// BodyEquals asserts the body of the response.
+func (r *Response) BodyEquals(want string) *Response {
+	r.t.Helper()
+	if have := r.Body.String(); want != have {
+		r.t.Errorf("body: want %q, have %q", want, have)
+	}
+	return r
+}
+
+// JSON asserts the value at path, in gjson syntax, of the JSON body of the
+// response. Values are compared as decoded from JSON, so that want may be of
+// any type encoding to the expected value, such as an int for a number.
+func (r *Response) JSON(path string, want interface{}) *Response {
+	r.t.Helper()
+	result := gjson.GetBytes(r.Body.Bytes(), path)
+	if !result.Exists() {
+		r.t.Errorf("JSON %s: want %v, have none in %s", path, want, r.Body)
+		return r
+	}
+	b, err := json.Marshal(want)
+	if err != nil {
+		r.t.Fatalf("JSON %s: encode %v: %v", path, want, err)
+	}
+	var wantValue interface{}
+	json.Unmarshal(b, &wantValue)
+	if have := result.Value(); !reflect.DeepEqual(wantValue, have) {
+		r.t.Errorf("JSON %s: want %s, have %s", path, b, result.Raw)
+	}
+	return r
+}
+
+// NoJSON asserts that the JSON body of the response has no value at path.
+func (r *Response) NoJSON(path string) *Response {
+	r.t.Helper()
+	if result := gjson.GetBytes(r.Body.Bytes(), path); result.Exists() {
+		r.t.Errorf("JSON %s: want none, have %s", path, result.Raw)
+	}
+	return r
+}
+
+// Decode decodes the JSON body of the response into v.
+func (r *Response) Decode(v interface{}) *Response {
+	r.t.Helper()
+	if err := json.Unmarshal(r.Body.Bytes(), v); err != nil {
+		r.t.Errorf("decode body: %v: %s", err, r.Body)
+	}
+	return r
+}
+
+// EnvelopeCode asserts the code field of a response written by
+// EncodeJSONFormatResponse.
+func (r *Response) EnvelopeCode(want int) *Response {
+	r.t.Helper()
+	return r.JSON("code", want)
+}
+
+// EnvelopeData asserts the value at path, in gjson syntax, of the data field
+// of a response written by EncodeJSONFormatResponse. An empty path asserts
+// the whole data field.
+func (r *Response) EnvelopeData(path string, want interface{}) *Response {
+	r.t.Helper()
+	if path == "" {
+		return r.JSON("data", want)
+	}
+	return r.JSON("data."+path, want)
+}
+
+// EnvelopeErr asserts the err field of an error response in the envelope of
+// EncodeJSONFormatResponse, as read by DecodeJSONResponse.
+func (r *Response) EnvelopeErr(want string) *Response {
+	r.t.Helper()
+	return r.JSON("err", want)
+}
+
+// Finalizes asserts that the request was finalized once, with code.
+func (r *Response) Finalizes(code int) *Response {
+	r.t.Helper()
+	if len(r.finalized) != 1 {
+		r.t.Errorf("finalizer: want 1 call, have %d", len(r.finalized))
+		return r
+	}
+	if have := r.finalized[0].Code; code != have {
+		r.t.Errorf("finalizer code: want %d, have %d", code, have)
+	}
+	return r
+}
+
+// HandlesError asserts that the error handler was called once, with an error
+// whose message contains want.
+func (r *Response) HandlesError(want string) *Response {
+	r.t.Helper()
+	if len(r.errors) != 1 {
+		r.t.Errorf("error handler: want 1 call, have %d", len(r.errors))
+		return r
+	}
+	if have := r.errors[0].Err.Error(); !strings.Contains(have, want) {
+		r.t.Errorf("error handler: want %q, have %q", want, have)
+	}
+	return r
+}
+
+// NoErrors asserts that the error handler was not called.
+func (r *Response) NoErrors() *Response {
+	r.t.Helper()
+	for _, e := range r.errors {
+		r.t.Errorf("error handler: want no call, have %v", e.Err)
+	}
+	return r
+}
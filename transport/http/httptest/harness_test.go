@@ -0,0 +1,112 @@
+package httptest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/fitan/gink/transport/http/httptest"
+	"github.com/gin-gonic/gin"
+)
+
+type user struct {
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+}
+
+func decodeUser(_ context.Context, gCtx *gin.Context) (interface{}, error) {
+	var u user
+	if err := gCtx.ShouldBindJSON(&u); err != nil {
+		return nil, httptransport.NewStatusError(http.StatusBadRequest, "invalid user")
+	}
+	return u, nil
+}
+
+func TestHarness(t *testing.T) {
+	h := httptest.New(t)
+	h.Mount(http.MethodPost, "/users", httptransport.NewServer(
+		func(_ context.Context, request interface{}) (interface{}, error) {
+			return request, nil
+		},
+		decodeUser,
+		httptransport.EncodeJSONFormatResponse,
+		h.Capture(),
+	)).Mount(http.MethodGet, "/users/:name", httptransport.NewServer(
+		func(ctx context.Context, _ interface{}) (interface{}, error) {
+			return nil, errors.New("not found")
+		},
+		httptransport.NopRequestDecoder,
+		httptransport.EncodeJSONResponse,
+		h.Capture(),
+	))
+
+	h.POST("/users").
+		JSON(user{Name: "ann", Roles: []string{"admin"}}).
+		Do().
+		Status(http.StatusOK).
+		HasHeader("Content-Type", "application/json; charset=utf-8").
+		EnvelopeCode(http.StatusOK).
+		EnvelopeData("name", "ann").
+		EnvelopeData("roles", []string{"admin"}).
+		NoJSON("err").
+		Finalizes(http.StatusOK).
+		NoErrors()
+
+	h.POST("/users").
+		JSON("{").
+		Do().
+		Status(http.StatusBadRequest).
+		BodyEquals("invalid user").
+		Finalizes(http.StatusBadRequest).
+		HandlesError("invalid user")
+
+	res := h.GET("/users/bob").Query("verbose", "1").Do().
+		Status(http.StatusInternalServerError).
+		HandlesError("not found")
+	if want, have := "/users/bob", res.Finalized()[0].Path; want != have {
+		t.Errorf("finalized path: want %q, have %q", want, have)
+	}
+	if want, have := int64(len("not found")), res.Finalized()[0].Size; want != have {
+		t.Errorf("finalized size: want %d, have %d", want, have)
+	}
+	if want, have := 3, len(h.Finalized()); want != have {
+		t.Errorf("want %d finalizer calls, have %d", want, have)
+	}
+	if want, have := 2, len(h.Errors()); want != have {
+		t.Errorf("want %d error handler calls, have %d", want, have)
+	}
+}
+
+// recorder is a testing.TB recording failures rather than failing the test.
+type recorder struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, format)
+}
+
+func TestResponseAssertionsFail(t *testing.T) {
+	rec := &recorder{TB: t}
+	h := httptest.New(rec)
+	h.Mount(http.MethodGet, "/", httptransport.NewServer(
+		func(context.Context, interface{}) (interface{}, error) { return user{Name: "ann"}, nil },
+		httptransport.NopRequestDecoder,
+		httptransport.EncodeJSONResponse,
+	))
+	h.GET("/").Do().
+		Status(http.StatusCreated).
+		HasHeader("X-Missing", "1").
+		JSON("name", "bob").
+		JSON("missing", 1).
+		NoJSON("name").
+		Finalizes(http.StatusOK)
+	if want, have := 6, len(rec.failures); want != have {
+		t.Errorf("want %d failures, have %d: %q", want, have, rec.failures)
+	}
+}
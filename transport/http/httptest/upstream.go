@@ -0,0 +1,371 @@
+package httptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	stdhttptest "net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Upstream is a fake service for testing Clients. Its routes answer the
+// requests they expect with scripted replies, and it reports the requests no
+// route expects, and the routes not called as expected, when the test ends.
+// Point a Client at it with WithClientHost(u.URL()), or balance a Client over
+// several of them with WithClientKitLb and the Host of each.
+type Upstream struct {
+	t      testing.TB
+	server *stdhttptest.Server
+
+	mu         sync.Mutex
+	routes     []*Route
+	calls      []Call
+	unexpected []string
+}
+
+// NewUpstream starts an Upstream on a loopback address. It is closed, and
+// verified, when the test ends.
+func NewUpstream(t testing.TB) *Upstream {
+	u := &Upstream{t: t}
+	u.server = stdhttptest.NewServer(http.HandlerFunc(u.serve))
+	t.Cleanup(func() {
+		u.server.Close()
+		u.Verify()
+	})
+	return u
+}
+
+// URL returns the base URL of u, such as "http://127.0.0.1:51234".
+func (u *Upstream) URL() string {
+	return u.server.URL
+}
+
+// Host returns the address of u, such as "127.0.0.1:51234", as used by the
+// instances of WithClientKitLb.
+func (u *Upstream) Host() string {
+	return u.server.Listener.Addr().String()
+}
+
+// Call is a request received by an Upstream.
+type Call struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// String returns the method, path, query and body of c.
+func (c Call) String() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s", c.Method, c.Path)
+	if len(c.Query) > 0 {
+		b.WriteString("?" + c.Query.Encode())
+	}
+	if len(c.Body) > 0 {
+		b.WriteString(" " + strings.TrimSpace(string(c.Body)))
+	}
+	return b.String()
+}
+
+// Calls returns the requests received by u so far, in order.
+func (u *Upstream) Calls() []Call {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]Call(nil), u.calls...)
+}
+
+// On adds a route expecting requests with method and path. By default it is
+// expected to be called at least once, and answers 200 with no body.
+// Routes are tried in the order they were added.
+func (u *Upstream) On(method, path string) *Route {
+	r := &Route{method: method, path: path, times: -1}
+	u.mu.Lock()
+	u.routes = append(u.routes, r)
+	u.mu.Unlock()
+	return r
+}
+
+// Verify reports the requests no route expected, and the routes not called
+// as expected, to the test. It is called when the test ends.
+func (u *Upstream) Verify() {
+	u.t.Helper()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, request := range u.unexpected {
+		u.t.Errorf("upstream: unexpected request %s", request)
+	}
+	u.unexpected = nil
+	for _, r := range u.routes {
+		switch {
+		case r.times < 0 && r.calls == 0:
+			u.t.Errorf("upstream: %s %s: want at least 1 call, have none", r.method, r.path)
+		case r.times >= 0 && r.calls != r.times:
+			u.t.Errorf("upstream: %s %s: want %d calls, have %d", r.method, r.path, r.times, r.calls)
+		}
+	}
+}
+
+func (u *Upstream) serve(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	call := Call{Method: req.Method, Path: req.URL.Path, Query: req.URL.Query(), Header: req.Header, Body: body}
+
+	u.mu.Lock()
+	u.calls = append(u.calls, call)
+	var reply Reply
+	matched := false
+	for _, r := range u.routes {
+		if r.matches(call) {
+			reply, matched = r.next(), true
+			break
+		}
+	}
+	if !matched {
+		u.unexpected = append(u.unexpected, call.String())
+	}
+	u.mu.Unlock()
+
+	if !matched {
+		http.Error(w, "no route expects "+req.Method+" "+req.URL.RequestURI(), http.StatusNotImplemented)
+		return
+	}
+	reply.write(w, req)
+}
+
+// Route is a route of an Upstream, answering the requests it expects with
+// its replies in sequence.
+type Route struct {
+	method string
+	path   string
+	header http.Header
+	query  url.Values
+	body   interface{}
+
+	replies []Reply
+	times   int
+	calls   int
+}
+
+// WithHeader makes r only expect requests with header name set to value.
+func (r *Route) WithHeader(name, value string) *Route {
+	if r.header == nil {
+		r.header = make(http.Header)
+	}
+	r.header.Add(name, value)
+	return r
+}
+
+// WithQuery makes r only expect requests with query parameter name set to
+// value.
+func (r *Route) WithQuery(name, value string) *Route {
+	if r.query == nil {
+		r.query = make(url.Values)
+	}
+	r.query.Add(name, value)
+	return r
+}
+
+// WithJSON makes r only expect requests whose JSON body holds the same
+// values as v encoded as JSON.
+func (r *Route) WithJSON(v interface{}) *Route {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("encode expected body: %v", err))
+	}
+	json.Unmarshal(b, &r.body)
+	return r
+}
+
+// Times sets the number of calls r expects.
+func (r *Route) Times(n int) *Route {
+	r.times = n
+	return r
+}
+
+// Reply adds replies to the sequence of r. The n-th call of r is answered
+// with its n-th reply, and the calls after the last reply with the last one.
+func (r *Route) Reply(replies ...Reply) *Route {
+	r.replies = append(r.replies, replies...)
+	return r
+}
+
+func (r *Route) matches(call Call) bool {
+	if call.Method != r.method || call.Path != r.path {
+		return false
+	}
+	for name, values := range r.header {
+		for _, v := range values {
+			if !contains(call.Header.Values(name), v) {
+				return false
+			}
+		}
+	}
+	for name, values := range r.query {
+		for _, v := range values {
+			if !contains(call.Query[name], v) {
+				return false
+			}
+		}
+	}
+	if r.body != nil {
+		var body interface{}
+		if json.Unmarshal(call.Body, &body) != nil || !reflect.DeepEqual(r.body, body) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Route) next() Reply {
+	r.calls++
+	switch {
+	case len(r.replies) == 0:
+		return Status(http.StatusOK)
+	case r.calls > len(r.replies):
+		return r.replies[len(r.replies)-1]
+	default:
+		return r.replies[r.calls-1]
+	}
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Reply is the answer of a Route to a request.
+type Reply struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	// Delay is waited before answering, or until the request is canceled.
+	Delay time.Duration
+	// Reset closes the connection without answering.
+	Reset bool
+}
+
+// Status returns a Reply with code and no body.
+func Status(code int) Reply {
+	return Reply{Status: code}
+}
+
+// Text returns a Reply with code and a text body.
+func Text(code int, body string) Reply {
+	return Reply{
+		Status: code,
+		Header: http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+		Body:   []byte(body),
+	}
+}
+
+// JSON returns a Reply with code and v encoded as JSON. A string or []byte is
+// sent as is.
+func JSON(code int, v interface{}) Reply {
+	var b []byte
+	switch v := v.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		var err error
+		if b, err = json.Marshal(v); err != nil {
+			panic(fmt.Sprintf("encode reply: %v", err))
+		}
+	}
+	return Reply{
+		Status: code,
+		Header: http.Header{"Content-Type": {"application/json; charset=utf-8"}},
+		Body:   b,
+	}
+}
+
+// Envelope returns a Reply with data in the envelope of
+// EncodeJSONFormatResponse.
+func Envelope(data interface{}) Reply {
+	return JSON(http.StatusOK, map[string]interface{}{"code": http.StatusOK, "data": data})
+}
+
+// EnvelopeError returns a Reply with an error in the envelope read by
+// DecodeJSONResponse: a status of 200, and code and message in the body.
+func EnvelopeError(code int, message string) Reply {
+	return JSON(http.StatusOK, map[string]interface{}{"code": code, "err": message})
+}
+
+// MalformedJSON returns a Reply with a truncated JSON body.
+func MalformedJSON() Reply {
+	return JSON(http.StatusOK, `{"code":200,"data":{"name":`)
+}
+
+// ConnectionReset returns a Reply closing the connection without answering.
+func ConnectionReset() Reply {
+	return Reply{Reset: true}
+}
+
+// Burst returns n copies of reply, to answer n calls in a row with it, such
+// as Burst(3, Status(http.StatusServiceUnavailable)).
+func Burst(n int, reply Reply) []Reply {
+	replies := make([]Reply, n)
+	for i := range replies {
+		replies[i] = reply
+	}
+	return replies
+}
+
+// After returns a copy of r answering after d.
+func (r Reply) After(d time.Duration) Reply {
+	r.Delay = d
+	return r
+}
+
+func (r Reply) write(w http.ResponseWriter, req *http.Request) {
+	if r.Delay > 0 {
+		timer := time.NewTimer(r.Delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			return
+		}
+	}
+	if r.Reset {
+		reset(w)
+		return
+	}
+	for name, values := range r.Header {
+		w.Header()[name] = values
+	}
+	if len(r.Body) > 0 {
+		w.Header().Set("Content-Length", fmt.Sprint(len(r.Body)))
+	}
+	w.WriteHeader(r.Status)
+	w.Write(r.Body)
+}
+
+// reset closes the connection of w, with a TCP reset where possible.
+func reset(w http.ResponseWriter) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		panic("upstream: connection can not be hijacked")
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	conn.Close()
+}
@@ -0,0 +1,121 @@
+package httptest_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/fitan/gink/transport/http/httptest"
+	"github.com/go-kit/kit/sd"
+	"github.com/go-resty/resty/v2"
+)
+
+func getUser(client *httptransport.Client) (user, error) {
+	var u user
+	_, err := client.Endpoint(httptransport.Req(http.MethodGet, "/users/ann"), httptransport.EncodeJSONRequest, httptransport.DecodeJSONResponse(&u))(context.Background(), nil)
+	return u, err
+}
+
+func TestUpstreamRetry(t *testing.T) {
+	upstream := httptest.NewUpstream(t)
+	upstream.On(http.MethodGet, "/users/ann").
+		Reply(httptest.Burst(2, httptest.Status(http.StatusServiceUnavailable))...).
+		Reply(httptest.ConnectionReset()).
+		Reply(httptest.Envelope(user{Name: "ann"})).
+		Times(4)
+
+	client := httptransport.NewClient(
+		resty.New().AddRetryCondition(func(r *resty.Response, err error) bool {
+			return r.StatusCode() >= http.StatusInternalServerError
+		}),
+		httptransport.WithClientHost(upstream.URL()),
+		httptransport.WithClientRetry(3, time.Millisecond, time.Millisecond),
+	)
+	u, err := getUser(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "ann", u.Name; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestUpstreamFaults(t *testing.T) {
+	upstream := httptest.NewUpstream(t)
+	// The reset comes first: net/http retries requests whose reused
+	// connection is reset.
+	upstream.On(http.MethodGet, "/users/ann").
+		Reply(httptest.ConnectionReset()).
+		Reply(httptest.EnvelopeError(http.StatusNotFound, "no such user")).
+		Reply(httptest.MalformedJSON()).
+		Reply(httptest.Text(http.StatusBadGateway, "bad gateway")).
+		Reply(httptest.Envelope(user{Name: "ann"}).After(time.Second)).
+		Times(5)
+
+	client := httptransport.NewClient(resty.New(),
+		httptransport.WithClientHost(upstream.URL()),
+		httptransport.WithClientTimeout(50*time.Millisecond))
+	for _, want := range []string{
+		"connection reset by peer",
+		"response err: no such user",
+		"unmarshal response",
+		"unexpected status code 502",
+		"Client.Timeout exceeded",
+	} {
+		if _, err := getUser(client); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("want error containing %q, have %v", want, err)
+		}
+	}
+}
+
+func TestUpstreamExpectations(t *testing.T) {
+	upstream := httptest.NewUpstream(t)
+	upstream.On(http.MethodPost, "/users").
+		WithHeader("X-Tenant", "acme").
+		WithQuery("dry_run", "1").
+		WithJSON(user{Name: "ann", Roles: []string{"admin"}}).
+		Reply(httptest.Envelope(user{Name: "ann"})).
+		Times(1)
+
+	client := httptransport.NewClient(resty.New().SetHeader("X-Tenant", "acme"), httptransport.WithClientHost(upstream.URL()))
+	var u user
+	create := client.Endpoint(httptransport.Req(http.MethodPost, "/users?dry_run=1"), httptransport.EncodeJSONRequest, httptransport.DecodeJSONResponse(&u))
+	if _, err := create(context.Background(), user{Name: "ann", Roles: []string{"admin"}}); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 1, len(upstream.Calls()); want != have {
+		t.Errorf("want %d calls, have %d", want, have)
+	}
+
+	rec := &recorder{TB: t}
+	unmet := httptest.NewUpstream(rec)
+	unmet.On(http.MethodGet, "/never")
+	unmet.On(http.MethodPost, "/users").WithJSON(user{Name: "bob"}).Times(1)
+	other := httptransport.NewClient(resty.New(), httptransport.WithClientHost(unmet.URL()))
+	create = other.Endpoint(httptransport.Req(http.MethodPost, "/users"), httptransport.EncodeJSONRequest, httptransport.DecodeJSONResponse(&u))
+	if _, err := create(context.Background(), user{Name: "ann"}); err == nil {
+		t.Error("want error for unexpected request, have none")
+	}
+	unmet.Verify()
+	if want, have := 3, len(rec.failures); want != have {
+		t.Errorf("want %d failures, have %d: %q", want, have, rec.failures)
+	}
+}
+
+func TestUpstreamLoadBalancing(t *testing.T) {
+	var instances []string
+	for i := 0; i < 2; i++ {
+		upstream := httptest.NewUpstream(t)
+		upstream.On(http.MethodGet, "/users/ann").Reply(httptest.Envelope(user{Name: "ann"})).Times(2)
+		instances = append(instances, upstream.Host())
+	}
+	client := httptransport.NewClient(resty.New(), httptransport.WithClientKitLb(sd.FixedInstancer(instances), 0))
+	for i := 0; i < 4; i++ {
+		if _, err := getUser(client); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -11,6 +11,8 @@ import (
 
 	"github.com/go-kit/kit/endpoint"
 	httptransport "github.com/go-kit/kit/transport/http"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Client wraps a JSON RPC method and provides a method that implements endpoint.Endpoint.
@@ -30,6 +32,7 @@ type Client struct {
 	finalizer      httptransport.ClientFinalizerFunc
 	requestID      RequestIDGenerator
 	bufferedStream bool
+	trace          *traceConfig
 }
 
 type clientRequest struct {
@@ -146,8 +149,9 @@ func (c Client) Endpoint() endpoint.Endpoint {
 		defer cancel()
 
 		var (
-			resp *http.Response
-			err  error
+			resp   *http.Response
+			rpcRes Response
+			err    error
 		)
 		if c.finalizer != nil {
 			defer func() {
@@ -172,6 +176,18 @@ func (c Client) Endpoint() endpoint.Endpoint {
 			ID:      c.requestID.Generate(),
 		}
 
+		if c.trace != nil {
+			var span trace.Span
+			ctx, span = c.trace.startClient(ctx, c.method, rpcReq.ID)
+			defer func() {
+				if err == nil && rpcRes.Error != nil {
+					endSpan(span, *rpcRes.Error, 0)
+					return
+				}
+				endSpan(span, err, 0)
+			}()
+		}
+
 		req, err := http.NewRequest("POST", c.tgt.String(), nil)
 		if err != nil {
 			return nil, err
@@ -188,6 +204,9 @@ func (c Client) Endpoint() endpoint.Endpoint {
 		for _, f := range c.before {
 			ctx = f(ctx, req)
 		}
+		if c.trace != nil {
+			c.trace.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+		}
 
 		resp, err = c.client.Do(req.WithContext(ctx))
 		if err != nil {
@@ -203,7 +222,6 @@ func (c Client) Endpoint() endpoint.Endpoint {
 		}
 
 		// Decode the body into an object
-		var rpcRes Response
 		err = json.NewDecoder(resp.Body).Decode(&rpcRes)
 		if err != nil {
 			return nil, err
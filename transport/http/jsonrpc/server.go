@@ -1,6 +1,7 @@
 package jsonrpc
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 
 	httptransport "github.com/go-kit/kit/transport/http"
 	"github.com/go-kit/log"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type requestIDKeyType struct{}
@@ -24,6 +26,7 @@ type Server struct {
 	errorEncoder httptransport.ErrorEncoder
 	finalizer    httptransport.ServerFinalizerFunc
 	logger       log.Logger
+	trace        *traceConfig
 }
 
 // NewServer constructs a new server, which implements http.Server.
@@ -109,18 +112,55 @@ func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Decode the body into an  object
-	var req Request
-	err := json.NewDecoder(r.Body).Decode(&req)
+	var raw json.RawMessage
+	err := json.NewDecoder(r.Body).Decode(&raw)
 	if err != nil {
 		rpcerr := parseError("JSON could not be decoded: " + err.Error())
 		s.logger.Log("err", rpcerr)
 		s.errorEncoder(ctx, rpcerr, w)
 		return
 	}
+	if isBatch(raw) {
+		s.serveBatch(ctx, w, r, raw)
+		return
+	}
+	var req Request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		rpcerr := parseError("JSON could not be decoded: " + err.Error())
+		s.logger.Log("err", rpcerr)
+		s.errorEncoder(ctx, rpcerr, w)
+		return
+	}
+
+	ctx, resParams, err := s.call(ctx, w, r, req)
+	if err != nil {
+		s.logger.Log("err", err)
+		s.errorEncoder(ctx, err, w)
+		return
+	}
+
+	res := Response{
+		ID:      req.ID,
+		JSONRPC: Version,
+		Result:  resParams,
+	}
 
+	w.Header().Set("Content-Type", ContentType)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// call invokes the endpoint of the method of req, and returns the encoded
+// result, along with the context of the call.
+func (s Server) call(ctx context.Context, w http.ResponseWriter, r *http.Request, req Request) (_ context.Context, _ json.RawMessage, err error) {
 	ctx = context.WithValue(ctx, requestIDKey, req.ID)
 	ctx = context.WithValue(ctx, ContextKeyRequestMethod, req.Method)
 
+	if s.trace != nil {
+		var span trace.Span
+		ctx, span = s.trace.startServer(ctx, r, req)
+		defer func() { endSpan(span, err, InternalError) }()
+	}
+
 	for _, f := range s.beforeCodec {
 		ctx = f(ctx, r, req)
 	}
@@ -129,49 +169,84 @@ func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// defined in the JSON  object
 	ecm, ok := s.ecm[req.Method]
 	if !ok {
-		err := methodNotFoundError(fmt.Sprintf("Method %s was not found.", req.Method))
-		s.logger.Log("err", err)
-		s.errorEncoder(ctx, err, w)
-		return
+		return ctx, nil, methodNotFoundError(fmt.Sprintf("Method %s was not found.", req.Method))
 	}
 
 	// Decode the JSON "params"
 	reqParams, err := ecm.Decode(ctx, req.Params)
 	if err != nil {
-		s.logger.Log("err", err)
-		s.errorEncoder(ctx, err, w)
-		return
+		return ctx, nil, err
 	}
 
 	// Call the Endpoint with the params
 	response, err := ecm.Endpoint(ctx, reqParams)
 	if err != nil {
-		s.logger.Log("err", err)
-		s.errorEncoder(ctx, err, w)
-		return
+		return ctx, nil, err
 	}
 
 	for _, f := range s.after {
 		ctx = f(ctx, w)
 	}
 
-	res := Response{
-		ID:      req.ID,
-		JSONRPC: Version,
-	}
-
 	// Encode the response from the Endpoint
 	resParams, err := ecm.Encode(ctx, response)
-	if err != nil {
-		s.logger.Log("err", err)
-		s.errorEncoder(ctx, err, w)
+	return ctx, resParams, err
+}
+
+// isBatch reports whether raw is a JSON array.
+func isBatch(raw json.RawMessage) bool {
+	trimmed := bytes.TrimLeft(raw, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+// serveBatch calls the methods of the requests of a batch in turn, and
+// writes their responses as an array. Notifications, requests without an ID,
+// get no response. Errors are written as the DefaultErrorEncoder would,
+// since the error encoder writes a whole HTTP response.
+func (s Server) serveBatch(ctx context.Context, w http.ResponseWriter, r *http.Request, raw json.RawMessage) {
+	var batch []json.RawMessage
+	if err := json.Unmarshal(raw, &batch); err != nil {
+		rpcerr := parseError("JSON could not be decoded: " + err.Error())
+		s.logger.Log("err", rpcerr)
+		s.errorEncoder(ctx, rpcerr, w)
+		return
+	}
+	if len(batch) == 0 {
+		rpcerr := invalidRequestError("Batch is empty.")
+		s.logger.Log("err", rpcerr)
+		s.errorEncoder(ctx, rpcerr, w)
 		return
 	}
 
-	res.Result = resParams
+	responses := make([]Response, 0, len(batch))
+	for _, element := range batch {
+		var req Request
+		if err := json.Unmarshal(element, &req); err != nil {
+			e := errorObject(invalidRequestError("Request could not be decoded: " + err.Error()))
+			responses = append(responses, Response{JSONRPC: Version, Error: &e})
+			continue
+		}
+		_, resParams, err := s.call(ctx, w, r, req)
+		if err != nil {
+			s.logger.Log("err", err)
+		}
+		if req.ID == nil {
+			continue
+		}
+		res := Response{ID: req.ID, JSONRPC: Version, Result: resParams}
+		if err != nil {
+			e := errorObject(err)
+			res.Result, res.Error = nil, &e
+		}
+		responses = append(responses, res)
+	}
 
+	if len(responses) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
 	w.Header().Set("Content-Type", ContentType)
-	_ = json.NewEncoder(w).Encode(res)
+	_ = json.NewEncoder(w).Encode(responses)
 }
 
 // DefaultErrorEncoder writes the error to the ResponseWriter,
@@ -188,13 +263,7 @@ func DefaultErrorEncoder(ctx context.Context, err error, w http.ResponseWriter)
 		}
 	}
 
-	e := Error{
-		Code:    InternalError,
-		Message: err.Error(),
-	}
-	if sc, ok := err.(ErrorCoder); ok {
-		e.Code = sc.ErrorCode()
-	}
+	e := errorObject(err)
 
 	w.WriteHeader(http.StatusOK)
 
@@ -209,6 +278,18 @@ func DefaultErrorEncoder(ctx context.Context, err error, w http.ResponseWriter)
 	})
 }
 
+// errorObject returns the JSON RPC error object err is encoded as.
+func errorObject(err error) Error {
+	e := Error{
+		Code:    InternalError,
+		Message: err.Error(),
+	}
+	if sc, ok := err.(ErrorCoder); ok {
+		e.Code = sc.ErrorCode()
+	}
+	return e
+}
+
 // ErrorCoder is checked by DefaultErrorEncoder. If an error value implements
 // ErrorCoder, the integer result of ErrorCode() will be used as the JSONRPC
 // error code when encoding the error.
@@ -12,8 +12,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/fitan/gink/transport/http/jsonrpc"
 	"github.com/go-kit/kit/endpoint"
-	"github.com/go-kit/kit/transport/http/jsonrpc"
 )
 
 func addBody() io.Reader {
@@ -0,0 +1,146 @@
+package jsonrpc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name of the spans of this package.
+const tracerName = "github.com/fitan/gink/transport/http/jsonrpc"
+
+// Attributes of the spans of calls, besides rpc.system and rpc.method.
+const (
+	rpcVersionKey      = attribute.Key("rpc.jsonrpc.version")
+	rpcRequestIDKey    = attribute.Key("rpc.jsonrpc.request_id")
+	rpcErrorCodeKey    = attribute.Key("rpc.jsonrpc.error_code")
+	rpcErrorMessageKey = attribute.Key("rpc.jsonrpc.error_message")
+)
+
+// TraceOption sets an optional parameter for ServerTrace and ClientTrace.
+type TraceOption func(*traceConfig)
+
+type traceConfig struct {
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+}
+
+// TraceProvider sets the provider of the tracer spans are started with. By
+// default it is the global provider at the time of the call.
+func TraceProvider(provider trace.TracerProvider) TraceOption {
+	return func(c *traceConfig) { c.provider = provider }
+}
+
+// TracePropagator sets the propagator span contexts are extracted from
+// requests, and injected in requests, with. By default the W3C trace context
+// and baggage are propagated.
+func TracePropagator(propagator propagation.TextMapPropagator) TraceOption {
+	return func(c *traceConfig) { c.propagator = propagator }
+}
+
+func newTraceConfig(options []TraceOption) *traceConfig {
+	c := &traceConfig{
+		propagator: propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+func (c traceConfig) tracer() trace.Tracer {
+	provider := c.provider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+// ServerTrace starts a server span for every call, as a child of the span
+// context propagated by the caller, and named after its method. Each request
+// of a batch gets its own span. The span is in the context of the
+// ServerBeforeCodec functions, of the codecs and of the endpoint, and ends
+// with the JSON RPC error code of the call if it fails.
+func ServerTrace(options ...TraceOption) ServerOption {
+	return func(s *Server) { s.trace = newTraceConfig(options) }
+}
+
+// ClientTrace starts a client span for every call, named after the method of
+// the Client, and propagates its context in the headers of the request.
+func ClientTrace(options ...TraceOption) ClientOption {
+	return func(c *Client) { c.trace = newTraceConfig(options) }
+}
+
+func (c traceConfig) startServer(ctx context.Context, r *http.Request, req Request) (context.Context, trace.Span) {
+	ctx = c.propagator.Extract(ctx, propagation.HeaderCarrier(r.Header))
+	attributes := []attribute.KeyValue{
+		semconv.RPCSystemKey.String("jsonrpc"),
+		semconv.RPCMethodKey.String(req.Method),
+		rpcVersionKey.String(req.JSONRPC),
+	}
+	if id, ok := requestIDString(req.ID); ok {
+		attributes = append(attributes, rpcRequestIDKey.String(id))
+	}
+	attributes = append(attributes, semconv.NetAttributesFromHTTPRequest("tcp", r)...)
+	return c.tracer().Start(ctx, req.Method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attributes...),
+	)
+}
+
+func (c traceConfig) startClient(ctx context.Context, method string, id interface{}) (context.Context, trace.Span) {
+	attributes := []attribute.KeyValue{
+		semconv.RPCSystemKey.String("jsonrpc"),
+		semconv.RPCMethodKey.String(method),
+		rpcVersionKey.String(Version),
+	}
+	if id != nil {
+		attributes = append(attributes, rpcRequestIDKey.String(fmt.Sprint(id)))
+	}
+	return c.tracer().Start(ctx, method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes...),
+	)
+}
+
+// endSpan ends span with the error of the call, if any. Errors which are not
+// ErrorCoders are recorded with defaultCode, or without a code if it is 0.
+func endSpan(span trace.Span, err error, defaultCode int) {
+	if err != nil {
+		code := defaultCode
+		if sc, ok := err.(ErrorCoder); ok {
+			code = sc.ErrorCode()
+		}
+		if code != 0 {
+			span.SetAttributes(rpcErrorCodeKey.Int(code))
+		}
+		span.SetAttributes(rpcErrorMessageKey.String(err.Error()))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// requestIDString returns id as a string, in the form it was sent with.
+func requestIDString(id *RequestID) (string, bool) {
+	if id == nil {
+		return "", false
+	}
+	if v, err := id.Int(); err == nil {
+		return fmt.Sprint(v), true
+	}
+	if v, err := id.Float32(); err == nil {
+		return fmt.Sprint(v), true
+	}
+	if v, err := id.String(); err == nil {
+		return v, true
+	}
+	return "", false
+}
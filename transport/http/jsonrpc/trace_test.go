@@ -0,0 +1,202 @@
+package jsonrpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/fitan/gink/transport/http/jsonrpc"
+	"github.com/go-kit/kit/endpoint"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func spanAttribute(span *sdktrace.SpanSnapshot, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func newTracedServer(provider trace.TracerProvider) *httptest.Server {
+	ecm := jsonrpc.EndpointCodecMap{
+		"add": jsonrpc.EndpointCodec{
+			Endpoint: func(_ context.Context, request interface{}) (interface{}, error) {
+				params := request.([]int)
+				return params[0] + params[1], nil
+			},
+			Decode: func(_ context.Context, params json.RawMessage) (interface{}, error) {
+				var v []int
+				err := json.Unmarshal(params, &v)
+				return v, err
+			},
+			Encode: func(_ context.Context, response interface{}) (json.RawMessage, error) {
+				return json.Marshal(response)
+			},
+		},
+	}
+	return httptest.NewServer(jsonrpc.NewServer(ecm, jsonrpc.ServerTrace(jsonrpc.TraceProvider(provider))))
+}
+
+func TestTraceClientServer(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	server := newTracedServer(provider)
+	defer server.Close()
+
+	tgt, _ := url.Parse(server.URL)
+	client := jsonrpc.NewClient(tgt, "add", jsonrpc.ClientTrace(jsonrpc.TraceProvider(provider)))
+	response, err := client.Endpoint()(context.Background(), []int{3, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := float64(5), response; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+
+	spans := exporter.GetSpans()
+	if want, have := 2, len(spans); want != have {
+		t.Fatalf("want %d spans, have %d", want, have)
+	}
+	// The server span ends first.
+	serverSpan, clientSpan := spans[0], spans[1]
+	if want, have := trace.SpanKindServer, serverSpan.SpanKind; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if want, have := trace.SpanKindClient, clientSpan.SpanKind; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if want, have := clientSpan.SpanContext.SpanID(), serverSpan.Parent.SpanID(); want != have {
+		t.Errorf("server span parent: want %v, have %v", want, have)
+	}
+	for _, span := range spans {
+		if want, have := "add", span.Name; want != have {
+			t.Errorf("want %q, have %q", want, have)
+		}
+		for key, want := range map[attribute.Key]string{
+			"rpc.system":             "jsonrpc",
+			"rpc.method":             "add",
+			"rpc.jsonrpc.request_id": "0",
+			"rpc.jsonrpc.version":    "2.0",
+		} {
+			if have, _ := spanAttribute(span, key); want != have.AsString() {
+				t.Errorf("%s %s: want %q, have %q", span.SpanKind, key, want, have.AsString())
+			}
+		}
+	}
+}
+
+func TestTraceErrorCode(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	server := newTracedServer(provider)
+	defer server.Close()
+
+	tgt, _ := url.Parse(server.URL)
+	client := jsonrpc.NewClient(tgt, "sub", jsonrpc.ClientTrace(jsonrpc.TraceProvider(provider)))
+	if _, err := client.Endpoint()(context.Background(), []int{3, 2}); err == nil {
+		t.Fatal("want error, have none")
+	}
+
+	spans := exporter.GetSpans()
+	if want, have := 2, len(spans); want != have {
+		t.Fatalf("want %d spans, have %d", want, have)
+	}
+	for _, span := range spans {
+		if want, have := codes.Error, span.StatusCode; want != have {
+			t.Errorf("%s: want %v, have %v", span.SpanKind, want, have)
+		}
+		have, _ := spanAttribute(span, "rpc.jsonrpc.error_code")
+		if want := int64(jsonrpc.MethodNotFoundError); want != have.AsInt64() {
+			t.Errorf("%s: want %d, have %d", span.SpanKind, want, have.AsInt64())
+		}
+	}
+}
+
+func TestTraceBatch(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	server := newTracedServer(provider)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(`[
+		{"jsonrpc": "2.0", "method": "add", "params": [1, 2], "id": 1},
+		{"jsonrpc": "2.0", "method": "add", "params": [3, 4]},
+		{"jsonrpc": "2.0", "method": "sub", "params": [5, 6], "id": "b"},
+		42
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	buf, _ := ioutil.ReadAll(resp.Body)
+	var responses []jsonrpc.Response
+	if err := json.Unmarshal(buf, &responses); err != nil {
+		t.Fatalf("%v: %s", err, buf)
+	}
+	if want, have := 3, len(responses); want != have {
+		t.Fatalf("want %d responses, have %d: %s", want, have, buf)
+	}
+	if want, have := "3", string(responses[0].Result); want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+	if responses[1].Error == nil || responses[1].Error.Code != jsonrpc.MethodNotFoundError {
+		t.Errorf("want method not found, have %s", buf)
+	}
+	if responses[2].Error == nil || responses[2].Error.Code != jsonrpc.InvalidRequestError || responses[2].ID != nil {
+		t.Errorf("want invalid request, have %s", buf)
+	}
+
+	spans := exporter.GetSpans()
+	if want, have := 3, len(spans); want != have {
+		t.Fatalf("want %d spans, have %d", want, have)
+	}
+	for i, want := range []string{"1", "", "b"} {
+		have, _ := spanAttribute(spans[i], "rpc.jsonrpc.request_id")
+		if want != have.AsString() {
+			t.Errorf("span %d: want request id %q, have %q", i, want, have.AsString())
+		}
+	}
+}
+
+func TestServerBatchNotifications(t *testing.T) {
+	ecm := jsonrpc.EndpointCodecMap{
+		"notify": jsonrpc.EndpointCodec{
+			Endpoint: endpoint.Nop,
+			Decode:   nopDecoder,
+			Encode:   nopEncoder,
+		},
+	}
+	server := httptest.NewServer(jsonrpc.NewServer(ecm))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(`[
+		{"jsonrpc": "2.0", "method": "notify"},
+		{"jsonrpc": "2.0", "method": "notify"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if want, have := http.StatusNoContent, resp.StatusCode; want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+
+	resp, err = http.Post(server.URL, "application/json", strings.NewReader(`[]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	buf, _ := ioutil.ReadAll(resp.Body)
+	expectErrorCode(t, jsonrpc.InvalidRequestError, buf)
+}
@@ -0,0 +1,173 @@
+package http
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+)
+
+// Metrics records the requests served by the Servers set up with
+// ServerMetrics, and sent by the Clients set up with WithClientMetrics.
+// Implementations must be safe for concurrent use. KitMetrics records them
+// with go-kit metrics, and MetricsRegistry exposes them in the Prometheus text
+// format.
+type Metrics interface {
+	// ServerInFlight adds delta to the number of requests being served for
+	// method and route.
+	ServerInFlight(method, route string, delta float64)
+	// ObserveServer records a request once it has been served.
+	ObserveServer(o ServerObservation)
+	// ClientInFlight adds delta to the number of requests sent to host and
+	// waiting for their response.
+	ClientInFlight(host string, delta float64)
+	// ObserveClient records a request once its response has been read.
+	ObserveClient(o ClientObservation)
+}
+
+// ServerObservation describes a request served by a Server.
+type ServerObservation struct {
+	// Method is the HTTP method of the request.
+	Method string
+	// Route is the path pattern of the route of the request, as returned by
+	// gin.Context.FullPath.
+	Route string
+	// Code is the status code of the response.
+	Code int
+	// Latency is the time from the start of the request to the end of its
+	// response.
+	Latency time.Duration
+	// RequestSize is the size of the request body, as announced by its
+	// Content-Length, or as read otherwise.
+	RequestSize int64
+	// ResponseSize is the size of the response body as written.
+	ResponseSize int64
+}
+
+// Error reports whether the request failed on the side of the Server.
+func (o ServerObservation) Error() bool {
+	return o.Code >= 500
+}
+
+// Outcomes of ClientObservations.
+const (
+	ClientOutcomeSuccess     = "success"
+	ClientOutcomeClientError = "client_error"
+	ClientOutcomeServerError = "server_error"
+	ClientOutcomeError       = "error"
+)
+
+// ClientObservation describes a request sent by a Client. Every attempt of a
+// retried request is observed.
+type ClientObservation struct {
+	// Method is the HTTP method of the request.
+	Method string
+	// Host is the host the request was sent to.
+	Host string
+	// Outcome is ClientOutcomeError if no response was received, and tells
+	// the class of its status code otherwise.
+	Outcome string
+	// Code is the status code of the response, or 0 if none was received.
+	Code int
+	// Latency is the time until the headers of the response were received.
+	Latency time.Duration
+	// RequestSize is the size of the request body, or 0 if unknown.
+	RequestSize int64
+	// ResponseSize is the size of the response body as read.
+	ResponseSize int64
+}
+
+// Error reports whether the request failed, either without a response or
+// with a 4xx or 5xx status code.
+func (o ClientObservation) Error() bool {
+	return o.Outcome != ClientOutcomeSuccess
+}
+
+func clientOutcome(code int) string {
+	switch {
+	case code >= 500:
+		return ClientOutcomeServerError
+	case code >= 400:
+		return ClientOutcomeClientError
+	default:
+		return ClientOutcomeSuccess
+	}
+}
+
+// KitMetrics is a Metrics recording with go-kit metrics, so that requests can
+// be reported to any of their backends. Metrics left nil are not recorded.
+// Latencies are observed in seconds and sizes in bytes.
+type KitMetrics struct {
+	// Labelled with method, route and code.
+	ServerRequestCount metrics.Counter
+	ServerErrorCount   metrics.Counter
+	ServerLatency      metrics.Histogram
+	// Labelled with method and route.
+	ServerInFlightRequests metrics.Gauge
+	ServerRequestSize      metrics.Histogram
+	ServerResponseSize     metrics.Histogram
+
+	// Labelled with method, host and outcome.
+	ClientRequestCount metrics.Counter
+	ClientErrorCount   metrics.Counter
+	ClientLatency      metrics.Histogram
+	// Labelled with host.
+	ClientInFlightRequests metrics.Gauge
+	// Labelled with method and host.
+	ClientRequestSize  metrics.Histogram
+	ClientResponseSize metrics.Histogram
+}
+
+// ServerInFlight implements Metrics.
+func (m KitMetrics) ServerInFlight(method, route string, delta float64) {
+	if m.ServerInFlightRequests != nil {
+		m.ServerInFlightRequests.With("method", method, "route", route).Add(delta)
+	}
+}
+
+// ObserveServer implements Metrics.
+func (m KitMetrics) ObserveServer(o ServerObservation) {
+	labels := []string{"method", o.Method, "route", o.Route, "code", strconv.Itoa(o.Code)}
+	if m.ServerRequestCount != nil {
+		m.ServerRequestCount.With(labels...).Add(1)
+	}
+	if m.ServerErrorCount != nil && o.Error() {
+		m.ServerErrorCount.With(labels...).Add(1)
+	}
+	if m.ServerLatency != nil {
+		m.ServerLatency.With(labels...).Observe(o.Latency.Seconds())
+	}
+	if m.ServerRequestSize != nil {
+		m.ServerRequestSize.With("method", o.Method, "route", o.Route).Observe(float64(o.RequestSize))
+	}
+	if m.ServerResponseSize != nil {
+		m.ServerResponseSize.With("method", o.Method, "route", o.Route).Observe(float64(o.ResponseSize))
+	}
+}
+
+// ClientInFlight implements Metrics.
+func (m KitMetrics) ClientInFlight(host string, delta float64) {
+	if m.ClientInFlightRequests != nil {
+		m.ClientInFlightRequests.With("host", host).Add(delta)
+	}
+}
+
+// ObserveClient implements Metrics.
+func (m KitMetrics) ObserveClient(o ClientObservation) {
+	labels := []string{"method", o.Method, "host", o.Host, "outcome", o.Outcome}
+	if m.ClientRequestCount != nil {
+		m.ClientRequestCount.With(labels...).Add(1)
+	}
+	if m.ClientErrorCount != nil && o.Error() {
+		m.ClientErrorCount.With(labels...).Add(1)
+	}
+	if m.ClientLatency != nil {
+		m.ClientLatency.With(labels...).Observe(o.Latency.Seconds())
+	}
+	if m.ClientRequestSize != nil {
+		m.ClientRequestSize.With("method", o.Method, "host", o.Host).Observe(float64(o.RequestSize))
+	}
+	if m.ClientResponseSize != nil {
+		m.ClientResponseSize.With("method", o.Method, "host", o.Host).Observe(float64(o.ResponseSize))
+	}
+}
@@ -0,0 +1,288 @@
+package http
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsRegistry is a Metrics holding its metrics in memory, and exposing
+// them in the Prometheus text format, so that services can be scraped without
+// a metrics backend. Its metrics are:
+//
+//	<namespace>_server_requests_total{method,route,code}
+//	<namespace>_server_errors_total{method,route,code}
+//	<namespace>_server_request_duration_seconds{method,route,code}
+//	<namespace>_server_requests_in_flight{method,route}
+//	<namespace>_server_request_size_bytes{method,route}
+//	<namespace>_server_response_size_bytes{method,route}
+//	<namespace>_client_requests_total{method,host,outcome}
+//	<namespace>_client_errors_total{method,host,outcome}
+//	<namespace>_client_request_duration_seconds{method,host,outcome}
+//	<namespace>_client_requests_in_flight{host}
+//	<namespace>_client_request_size_bytes{method,host}
+//	<namespace>_client_response_size_bytes{method,host}
+type MetricsRegistry struct {
+	namespace      string
+	latencyBuckets []float64
+	sizeBuckets    []float64
+
+	mu       sync.Mutex
+	families map[string]*metricFamily
+}
+
+// MetricsOption sets an optional parameter for MetricsRegistry.
+type MetricsOption func(*MetricsRegistry)
+
+// MetricsNamespace sets the prefix of the names of the metrics. By default it
+// is "http".
+func MetricsNamespace(namespace string) MetricsOption {
+	return func(r *MetricsRegistry) { r.namespace = namespace }
+}
+
+// MetricsLatencyBuckets sets the upper bounds, in seconds, of the buckets of
+// the latency histograms. By default they range from 5ms to 10s.
+func MetricsLatencyBuckets(buckets ...float64) MetricsOption {
+	return func(r *MetricsRegistry) { r.latencyBuckets = buckets }
+}
+
+// MetricsSizeBuckets sets the upper bounds, in bytes, of the buckets of the
+// size histograms. By default they range from 100B to 10MB.
+func MetricsSizeBuckets(buckets ...float64) MetricsOption {
+	return func(r *MetricsRegistry) { r.sizeBuckets = buckets }
+}
+
+// NewMetricsRegistry returns an empty MetricsRegistry.
+func NewMetricsRegistry(options ...MetricsOption) *MetricsRegistry {
+	r := &MetricsRegistry{
+		namespace:      "http",
+		latencyBuckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		sizeBuckets:    []float64{100, 1000, 10000, 100000, 1000000, 10000000},
+		families:       make(map[string]*metricFamily),
+	}
+	for _, option := range options {
+		option(r)
+	}
+	sort.Float64s(r.latencyBuckets)
+	sort.Float64s(r.sizeBuckets)
+	return r
+}
+
+type metricType string
+
+const (
+	metricCounter   metricType = "counter"
+	metricGauge     metricType = "gauge"
+	metricHistogram metricType = "histogram"
+)
+
+type metricFamily struct {
+	help    string
+	typ     metricType
+	labels  []string
+	buckets []float64
+	series  map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labelValues []string
+	value       float64
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+// series returns the series of the family name with labelValues, creating
+// them if needed. It must be called with r.mu held.
+func (r *MetricsRegistry) series(name, help string, typ metricType, buckets []float64, labels []string, labelValues ...string) *metricSeries {
+	name = r.namespace + "_" + name
+	f, ok := r.families[name]
+	if !ok {
+		f = &metricFamily{help: help, typ: typ, labels: labels, buckets: buckets, series: make(map[string]*metricSeries)}
+		r.families[name] = f
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &metricSeries{labelValues: labelValues}
+		if typ == metricHistogram {
+			s.counts = make([]uint64, len(buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (s *metricSeries) observe(buckets []float64, v float64) {
+	for i, upper := range buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+var (
+	serverLabels       = []string{"method", "route", "code"}
+	serverRouteLabels  = []string{"method", "route"}
+	clientLabels       = []string{"method", "host", "outcome"}
+	clientHostLabels   = []string{"host"}
+	clientMethodLabels = []string{"method", "host"}
+)
+
+// ServerInFlight implements Metrics.
+func (r *MetricsRegistry) ServerInFlight(method, route string, delta float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series("server_requests_in_flight", "Requests being served.", metricGauge, nil, serverRouteLabels, method, route).value += delta
+}
+
+// ObserveServer implements Metrics.
+func (r *MetricsRegistry) ObserveServer(o ServerObservation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	code := strconv.Itoa(o.Code)
+	r.series("server_requests_total", "Requests served.", metricCounter, nil, serverLabels, o.Method, o.Route, code).value++
+	if o.Error() {
+		r.series("server_errors_total", "Requests served with a 5xx status code.", metricCounter, nil, serverLabels, o.Method, o.Route, code).value++
+	}
+	r.series("server_request_duration_seconds", "Time taken to serve requests.", metricHistogram, r.latencyBuckets, serverLabels, o.Method, o.Route, code).
+		observe(r.latencyBuckets, o.Latency.Seconds())
+	r.series("server_request_size_bytes", "Size of the bodies of served requests.", metricHistogram, r.sizeBuckets, serverRouteLabels, o.Method, o.Route).
+		observe(r.sizeBuckets, float64(o.RequestSize))
+	r.series("server_response_size_bytes", "Size of the bodies of responses.", metricHistogram, r.sizeBuckets, serverRouteLabels, o.Method, o.Route).
+		observe(r.sizeBuckets, float64(o.ResponseSize))
+}
+
+// ClientInFlight implements Metrics.
+func (r *MetricsRegistry) ClientInFlight(host string, delta float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series("client_requests_in_flight", "Requests sent and waiting for their response.", metricGauge, nil, clientHostLabels, host).value += delta
+}
+
+// ObserveClient implements Metrics.
+func (r *MetricsRegistry) ObserveClient(o ClientObservation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series("client_requests_total", "Requests sent.", metricCounter, nil, clientLabels, o.Method, o.Host, o.Outcome).value++
+	if o.Error() {
+		r.series("client_errors_total", "Requests sent that failed or were answered with a 4xx or 5xx status code.", metricCounter, nil, clientLabels, o.Method, o.Host, o.Outcome).value++
+	}
+	r.series("client_request_duration_seconds", "Time taken to receive the headers of responses.", metricHistogram, r.latencyBuckets, clientLabels, o.Method, o.Host, o.Outcome).
+		observe(r.latencyBuckets, o.Latency.Seconds())
+	r.series("client_request_size_bytes", "Size of the bodies of sent requests.", metricHistogram, r.sizeBuckets, clientMethodLabels, o.Method, o.Host).
+		observe(r.sizeBuckets, float64(o.RequestSize))
+	r.series("client_response_size_bytes", "Size of the bodies of received responses.", metricHistogram, r.sizeBuckets, clientMethodLabels, o.Method, o.Host).
+		observe(r.sizeBuckets, float64(o.ResponseSize))
+}
+
+// Register serves Handler on /metrics of routes.
+func (r *MetricsRegistry) Register(routes gin.IRoutes) {
+	routes.GET("/metrics", r.Handler)
+}
+
+// Handler writes the metrics in the Prometheus text format.
+func (r *MetricsRegistry) Handler(gCtx *gin.Context) {
+	gCtx.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	gCtx.Status(http.StatusOK)
+	r.WriteTo(gCtx.Writer)
+}
+
+// WriteTo writes the metrics to w in the Prometheus text format, sorted by
+// name and labels.
+func (r *MetricsRegistry) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	r.mu.Lock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := r.families[name]
+		bw.WriteString("# HELP " + name + " " + f.help + "\n")
+		bw.WriteString("# TYPE " + name + " " + string(f.typ) + "\n")
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			f.write(bw, name, f.series[key])
+		}
+	}
+	r.mu.Unlock()
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+func (f *metricFamily) write(w *bufio.Writer, name string, s *metricSeries) {
+	if f.typ != metricHistogram {
+		writeSample(w, name, f.labels, s.labelValues, "", "", s.value)
+		return
+	}
+	for i, upper := range f.buckets {
+		writeSample(w, name+"_bucket", f.labels, s.labelValues, "le", formatFloat(upper), float64(s.counts[i]))
+	}
+	writeSample(w, name+"_bucket", f.labels, s.labelValues, "le", "+Inf", float64(s.count))
+	writeSample(w, name+"_sum", f.labels, s.labelValues, "", "", s.sum)
+	writeSample(w, name+"_count", f.labels, s.labelValues, "", "", float64(s.count))
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraLabel, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(label + `="` + labelValueEscaper.Replace(values[i]) + `"`)
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraLabel + `="` + extraValue + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
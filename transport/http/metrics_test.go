@@ -0,0 +1,161 @@
+package http_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/generic"
+	"github.com/go-resty/resty/v2"
+)
+
+func TestServerClientMetrics(t *testing.T) {
+	registry := httptransport.NewMetricsRegistry(httptransport.MetricsNamespace("test"))
+	newServer := func(err error) *httptransport.Server {
+		return httptransport.NewServer(
+			func(_ context.Context, request interface{}) (interface{}, error) { return request, err },
+			readBodyDecoder,
+			encodeString,
+			httptransport.ServerMetrics(registry),
+		)
+	}
+	r := gin.New()
+	r.POST("/echo/:id", newServer(nil).ServeHTTP)
+	r.POST("/fail", newServer(httptransport.NewStatusError(http.StatusBadGateway, "upstream failed")).ServeHTTP)
+	registry.Register(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	client := httptransport.NewClient(resty.New(), httptransport.WithClientHost(server.URL), httptransport.WithClientMetrics(registry))
+	var body string
+	for _, path := range []string{"/echo/1", "/echo/2", "/fail"} {
+		e := client.Endpoint(httptransport.Req(http.MethodPost, path), httptransport.EncodeJSONRequest, httptransport.DecodeJSONResponse(&body))
+		e(context.Background(), "hello")
+	}
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if want, have := "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	buf := new(strings.Builder)
+	registry.WriteTo(buf)
+	exposition := buf.String()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	for _, want := range []string{
+		"# TYPE test_server_requests_total counter\n",
+		`test_server_requests_total{method="POST",route="/echo/:id",code="200"} 2` + "\n",
+		`test_server_requests_total{method="POST",route="/fail",code="502"} 1` + "\n",
+		`test_server_errors_total{method="POST",route="/fail",code="502"} 1` + "\n",
+		`test_server_requests_in_flight{method="POST",route="/echo/:id"} 0` + "\n",
+		"# TYPE test_server_request_duration_seconds histogram\n",
+		`test_server_request_duration_seconds_bucket{method="POST",route="/echo/:id",code="200",le="+Inf"} 2` + "\n",
+		`test_server_request_duration_seconds_count{method="POST",route="/echo/:id",code="200"} 2` + "\n",
+		// The body "hello" is sent as is and echoed.
+		`test_server_request_size_bytes_sum{method="POST",route="/echo/:id"} 10` + "\n",
+		`test_server_response_size_bytes_sum{method="POST",route="/echo/:id"} 10` + "\n",
+		`test_client_requests_total{method="POST",host="` + host + `",outcome="success"} 2` + "\n",
+		`test_client_requests_total{method="POST",host="` + host + `",outcome="server_error"} 1` + "\n",
+		`test_client_errors_total{method="POST",host="` + host + `",outcome="server_error"} 1` + "\n",
+		`test_client_requests_in_flight{host="` + host + `"} 0` + "\n",
+		`test_client_response_size_bytes_sum{method="POST",host="` + host + `"} 25` + "\n",
+	} {
+		if !strings.Contains(exposition, want) {
+			t.Errorf("missing %q in\n%s", want, exposition)
+		}
+	}
+	if strings.Contains(exposition, `test_server_errors_total{method="POST",route="/echo/:id"`) {
+		t.Errorf("successful requests counted as errors:\n%s", exposition)
+	}
+}
+
+func TestServerMetricsAborted(t *testing.T) {
+	registry := httptransport.NewMetricsRegistry()
+	handler := httptransport.NewServer(
+		func(_ context.Context, request interface{}) (interface{}, error) { return request, nil },
+		readBodyDecoder,
+		encodeString,
+		httptransport.ServerBefore(func(ctx context.Context, gCtx *gin.Context) context.Context {
+			httptransport.Abort(gCtx, httptransport.NewStatusError(http.StatusForbidden, "forbidden"))
+			return ctx
+		}),
+		httptransport.ServerMetrics(registry),
+	)
+	r := gin.New()
+	r.GET("/", handler.ServeHTTP)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	buf := new(strings.Builder)
+	registry.WriteTo(buf)
+	if want := `http_server_requests_total{method="GET",route="/",code="403"} 1`; !strings.Contains(buf.String(), want) {
+		t.Errorf("missing %q in\n%s", want, buf)
+	}
+}
+
+// labelledCounter records the label values it is added to with.
+type labelledCounter struct {
+	mu     *sync.Mutex
+	values map[string]float64
+	labels []string
+}
+
+func (c *labelledCounter) With(labelValues ...string) metrics.Counter {
+	return &labelledCounter{mu: c.mu, values: c.values, labels: append(append([]string(nil), c.labels...), labelValues...)}
+}
+
+func (c *labelledCounter) Add(delta float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[strings.Join(c.labels, " ")] += delta
+}
+
+func TestKitMetrics(t *testing.T) {
+	var (
+		requests = &labelledCounter{mu: &sync.Mutex{}, values: map[string]float64{}}
+		errs     = &labelledCounter{mu: &sync.Mutex{}, values: map[string]float64{}}
+	)
+	m := httptransport.KitMetrics{
+		ClientRequestCount:     requests,
+		ClientErrorCount:       errs,
+		ClientInFlightRequests: generic.NewGauge("in_flight"),
+		ClientLatency:          generic.NewHistogram("latency", 10),
+	}
+
+	r := gin.New()
+	r.GET("/", func(gCtx *gin.Context) { gCtx.Status(http.StatusNotFound) })
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	client := httptransport.NewClient(resty.New(), httptransport.WithClientHost(server.URL), httptransport.WithClientMetrics(m))
+	var body string
+	e := client.Endpoint(httptransport.Req(http.MethodGet, "/"), httptransport.EncodeJSONRequest, httptransport.DecodeJSONResponse(&body))
+	e(context.Background(), nil)
+
+	u, _ := url.Parse(server.URL)
+	labels := "method GET host " + u.Host + " outcome client_error"
+	if want, have := map[string]float64{labels: 1}, requests.values; !reflect.DeepEqual(want, have) {
+		t.Errorf("requests: want %v, have %v", want, have)
+	}
+	if want, have := map[string]float64{labels: 1}, errs.values; !reflect.DeepEqual(want, have) {
+		t.Errorf("errors: want %v, have %v", want, have)
+	}
+}
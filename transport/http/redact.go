@@ -0,0 +1,154 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Redacted replaces the values hidden by redaction rules.
+const Redacted = "[REDACTED]"
+
+// DefaultRedactedHeaders are the headers whose values are hidden from logs
+// unless other headers are set.
+var DefaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-API-Key"}
+
+// redactor hides the values of headers, and of fields of JSON bodies, before
+// they are logged.
+type redactor struct {
+	headers map[string]bool
+	paths   [][]string
+}
+
+func newRedactor(headers, paths []string) redactor {
+	r := redactor{headers: make(map[string]bool, len(headers))}
+	for _, name := range headers {
+		r.headers[http.CanonicalHeaderKey(name)] = true
+	}
+	for _, path := range paths {
+		r.paths = append(r.paths, strings.Split(path, "."))
+	}
+	return r
+}
+
+// header returns the values of the header name, joined, or Redacted.
+func (r redactor) header(h http.Header, name string) string {
+	values := h.Values(name)
+	if len(values) == 0 {
+		return ""
+	}
+	if r.headers[http.CanonicalHeaderKey(name)] {
+		return Redacted
+	}
+	return strings.Join(values, ", ")
+}
+
+// body renders a body of size bytes, of which b was captured, for a log.
+// Fields of JSON bodies matching the paths of r are replaced with Redacted.
+// Since a truncated JSON body can not be redacted, it is omitted when r has
+// paths. Bodies that are not text are only described.
+func (r redactor) body(b []byte, size int64) string {
+	truncated := int64(len(b)) < size
+	if !utf8.Valid(b) && !(truncated && utf8.Valid(trimIncompleteRune(b))) {
+		return fmt.Sprintf("[binary %d bytes]", size)
+	}
+	if len(r.paths) > 0 && looksLikeJSON(b) {
+		if truncated {
+			return fmt.Sprintf("[truncated JSON %d bytes]", size)
+		}
+		redacted, err := r.json(b)
+		if err != nil {
+			return fmt.Sprintf("[invalid JSON %d bytes]", size)
+		}
+		b = redacted
+	}
+	if truncated {
+		return string(trimIncompleteRune(b)) + "...[truncated " + strconv.FormatInt(size, 10) + " bytes]"
+	}
+	return string(b)
+}
+
+// json returns b with the fields matching the paths of r replaced with
+// Redacted. Paths are dot-separated field names or array indexes, where *
+// matches any field or element.
+func (r redactor) json(b []byte) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	for _, path := range r.paths {
+		redactPath(v, path)
+	}
+	return json.Marshal(v)
+}
+
+func redactPath(v interface{}, path []string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if path[0] != "*" && path[0] != k {
+				continue
+			}
+			if len(path) == 1 {
+				v[k] = Redacted
+			} else {
+				redactPath(child, path[1:])
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			if path[0] != "*" && path[0] != strconv.Itoa(i) {
+				continue
+			}
+			if len(path) == 1 {
+				v[i] = Redacted
+			} else {
+				redactPath(child, path[1:])
+			}
+		}
+	}
+}
+
+func looksLikeJSON(b []byte) bool {
+	b = bytes.TrimSpace(b)
+	return len(b) > 0 && (b[0] == '{' || b[0] == '[')
+}
+
+// trimIncompleteRune drops the bytes of a rune cut at the end of b.
+func trimIncompleteRune(b []byte) []byte {
+	for i := 0; i < utf8.UTFMax && i < len(b); i++ {
+		if utf8.RuneStart(b[len(b)-1-i]) {
+			if !utf8.FullRune(b[len(b)-1-i:]) {
+				return b[:len(b)-1-i]
+			}
+			break
+		}
+	}
+	return b
+}
+
+// captureBuffer keeps the first max bytes written to it, and counts all of
+// them.
+type captureBuffer struct {
+	max  int
+	buf  bytes.Buffer
+	size int64
+}
+
+func (c *captureBuffer) Write(p []byte) (int, error) {
+	c.size += int64(len(p))
+	if room := c.max - c.buf.Len(); room > 0 {
+		if len(p) > room {
+			c.buf.Write(p[:room])
+		} else {
+			c.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
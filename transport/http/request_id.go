@@ -0,0 +1,171 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-resty/resty/v2"
+)
+
+// RequestIDHeader is the header request IDs are read from, answered in and
+// forwarded in.
+const RequestIDHeader = "X-Request-Id"
+
+// KeyRequestID is populated in the gin keys by GenerateRequestID. Its value
+// is the ID of the request.
+const KeyRequestID = "KeyRequestID"
+
+// RequestIDOption sets an optional parameter for GenerateRequestID.
+type RequestIDOption func(*requestIDConfig)
+
+type requestIDConfig struct {
+	generate       func() string
+	ignoreIncoming bool
+}
+
+// RequestIDGenerator sets the func generating IDs, such as NewUUIDv7 or
+// NewULID. By default it is NewUUIDv7.
+func RequestIDGenerator(generate func() string) RequestIDOption {
+	return func(c *requestIDConfig) { c.generate = generate }
+}
+
+// RequestIDIgnoreIncoming generates an ID for every request, rather than
+// keeping the ID sent by the caller, for services called by untrusted
+// clients.
+func RequestIDIgnoreIncoming() RequestIDOption {
+	return func(c *requestIDConfig) { c.ignoreIncoming = true }
+}
+
+// GenerateRequestID returns a RequestFunc identifying every request by the ID
+// in its RequestIDHeader, or by a new ID if it has none, or an invalid one. The
+// ID is set in the RequestIDHeader of the request and of the response, in the
+// gin keys under KeyRequestID, and in the context under ContextKeyRequestID,
+// so that the logs of the services a request goes through can be joined.
+//
+// Add it before the ServerBefore functions reading the RequestIDHeader, such
+// as PopulateRequestContext.
+func GenerateRequestID(options ...RequestIDOption) RequestFunc {
+	c := requestIDConfig{generate: NewUUIDv7}
+	for _, option := range options {
+		option(&c)
+	}
+	return func(ctx context.Context, gCtx *gin.Context) context.Context {
+		id := gCtx.GetHeader(RequestIDHeader)
+		if c.ignoreIncoming || !validRequestID(id) {
+			id = c.generate()
+		}
+		gCtx.Request.Header.Set(RequestIDHeader, id)
+		gCtx.Header(RequestIDHeader, id)
+		gCtx.Set(KeyRequestID, id)
+		return context.WithValue(ctx, ContextKeyRequestID, id)
+	}
+}
+
+// validRequestID reports whether id may be logged and forwarded as is: it
+// must be at most 128 printable ASCII characters other than spaces.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestIDFromContext returns the ID populated in ctx by GenerateRequestID,
+// or else the RequestIDHeader populated by PopulateRequestContext.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	if id, _ := ctx.Value(ContextKeyRequestID).(string); id != "" {
+		return id, true
+	}
+	id, _ := ctx.Value(ContextKeyRequestXRequestID).(string)
+	return id, id != ""
+}
+
+// WithRequestID forwards the ID of the inbound request a Server is serving to
+// the outgoing request, in its RequestIDHeader. Calls whose context holds no
+// ID are sent without the header, so that they are not joined to another
+// request in the logs.
+func WithRequestID() RequestOption {
+	return func(request *Request) {
+		request.before = append(request.before, func(ctx context.Context, req *resty.Request) context.Context {
+			if id, ok := RequestIDFromContext(ctx); ok {
+				req.SetHeader(RequestIDHeader, id)
+			} else {
+				req.Header.Del(RequestIDHeader)
+			}
+			return ctx
+		})
+	}
+}
+
+// ForwardRequestID sets the RequestIDHeader of r to the ID of the inbound
+// request a Server is serving. Its signature is that of the ClientBefore
+// functions of the jsonrpc package, to forward IDs on JSON-RPC calls.
+func ForwardRequestID(ctx context.Context, r *http.Request) context.Context {
+	if id, ok := RequestIDFromContext(ctx); ok {
+		r.Header.Set(RequestIDHeader, id)
+	}
+	return ctx
+}
+
+// NewUUIDv7 returns a random UUID of version 7, which sorts by its creation
+// time to the millisecond, such as "01890a5d-ac96-774b-bcce-b302099a8057".
+func NewUUIDv7() string {
+	var b [16]byte
+	rand.Read(b[6:])
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	binary.BigEndian.PutUint16(b[0:], uint16(ms>>32))
+	binary.BigEndian.PutUint32(b[2:], uint32(ms))
+	b[6] = b[6]&0x0f | 0x70
+	b[8] = b[8]&0x3f | 0x80
+
+	var s [36]byte
+	hex.Encode(s[0:8], b[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], b[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], b[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], b[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], b[10:])
+	return string(s[:])
+}
+
+// crockford is the Crockford base32 alphabet ULIDs are encoded with.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID returns a random ULID, which sorts by its creation time to the
+// millisecond, such as "01H4567ABCDEFGHJKMNPQRSTVW".
+func NewULID() string {
+	var b [16]byte
+	rand.Read(b[6:])
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	binary.BigEndian.PutUint16(b[0:], uint16(ms>>32))
+	binary.BigEndian.PutUint32(b[2:], uint32(ms))
+
+	// The 128 bits are encoded in 26 characters of 5 bits, the first one
+	// holding the 3 most significant bits.
+	var s [26]byte
+	for i := range s {
+		bit := i*5 - 2
+		var v int
+		for j := 0; j < 5; j++ {
+			v <<= 1
+			if k := bit + j; k >= 0 && b[k/8]&(0x80>>(k%8)) != 0 {
+				v |= 1
+			}
+		}
+		s[i] = crockford[v]
+	}
+	return string(s[:])
+}
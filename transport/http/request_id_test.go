@@ -0,0 +1,188 @@
+package http_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/fitan/gink/transport/http/jsonrpc"
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-resty/resty/v2"
+)
+
+var (
+	uuidv7Pattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	ulidPattern   = regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+)
+
+func TestRequestIDGenerators(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		generate func() string
+		pattern  *regexp.Regexp
+	}{
+		{"UUIDv7", httptransport.NewUUIDv7, uuidv7Pattern},
+		{"ULID", httptransport.NewULID, ulidPattern},
+	} {
+		ids := make([]string, 100)
+		seen := make(map[string]bool)
+		for i := range ids {
+			ids[i] = tt.generate()
+			if !tt.pattern.MatchString(ids[i]) {
+				t.Errorf("%s: invalid ID %q", tt.name, ids[i])
+			}
+			if seen[ids[i]] {
+				t.Errorf("%s: duplicate ID %q", tt.name, ids[i])
+			}
+			seen[ids[i]] = true
+		}
+		// IDs sort by their time to the millisecond, so the first and the
+		// last are in order unless generated within the same millisecond.
+		if first, last := ids[0], ids[len(ids)-1]; first[:8] > last[:8] {
+			t.Errorf("%s: %q sorts after %q", tt.name, first, last)
+		}
+	}
+}
+
+func TestGenerateRequestID(t *testing.T) {
+	type seen struct{ ctx, key, header string }
+	var have seen
+	newRouter := func(options ...httptransport.RequestIDOption) *gin.Engine {
+		handler := httptransport.NewServer(
+			func(ctx context.Context, _ interface{}) (interface{}, error) {
+				have.ctx, _ = httptransport.RequestIDFromContext(ctx)
+				return "ok", nil
+			},
+			func(_ context.Context, gCtx *gin.Context) (interface{}, error) {
+				have.key = gCtx.GetString(httptransport.KeyRequestID)
+				have.header = gCtx.GetHeader(httptransport.RequestIDHeader)
+				return nil, nil
+			},
+			encodeString,
+			httptransport.ServerBefore(httptransport.GenerateRequestID(options...)),
+		)
+		r := gin.New()
+		r.GET("/", handler.ServeHTTP)
+		return r
+	}
+
+	for _, tt := range []struct {
+		name     string
+		router   *gin.Engine
+		incoming string
+		pattern  *regexp.Regexp
+	}{
+		{"generated", newRouter(), "", uuidv7Pattern},
+		{"ULID", newRouter(httptransport.RequestIDGenerator(httptransport.NewULID)), "", ulidPattern},
+		{"incoming", newRouter(), "abc-123", regexp.MustCompile(`^abc-123$`)},
+		{"invalid incoming", newRouter(), "a b", uuidv7Pattern},
+		{"ignored incoming", newRouter(httptransport.RequestIDIgnoreIncoming()), "abc-123", uuidv7Pattern},
+	} {
+		have = seen{}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.incoming != "" {
+			req.Header.Set(httptransport.RequestIDHeader, tt.incoming)
+		}
+		rec := httptest.NewRecorder()
+		tt.router.ServeHTTP(rec, req)
+
+		id := rec.Header().Get(httptransport.RequestIDHeader)
+		if !tt.pattern.MatchString(id) {
+			t.Errorf("%s: response header %q does not match %s", tt.name, id, tt.pattern)
+		}
+		if want := (seen{id, id, id}); want != have {
+			t.Errorf("%s: want %+v, have %+v", tt.name, want, have)
+		}
+	}
+}
+
+func TestForwardRequestID(t *testing.T) {
+	received := make(chan string, 2)
+	downstream := gin.New()
+	downstream.Any("/*path", func(gCtx *gin.Context) {
+		received <- gCtx.GetHeader(httptransport.RequestIDHeader)
+		gCtx.JSON(http.StatusOK, map[string]interface{}{"jsonrpc": "2.0", "id": 0, "result": "ok"})
+	})
+	server := httptest.NewServer(downstream)
+	defer server.Close()
+
+	client := httptransport.NewClient(resty.New(), httptransport.WithClientHost(server.URL))
+	var body json.RawMessage
+	restCall := client.Endpoint(httptransport.Req(http.MethodGet, "/rest"), httptransport.EncodeJSONRequest, httptransport.DecodeJSONResponse(&body), httptransport.WithRequestID())
+	tgt, _ := url.Parse(server.URL + "/rpc")
+	rpcCall := jsonrpc.NewClient(tgt, "call", jsonrpc.ClientBefore(httptransport.ForwardRequestID)).Endpoint()
+
+	handler := httptransport.NewServer(
+		func(ctx context.Context, _ interface{}) (interface{}, error) {
+			for _, call := range []endpoint.Endpoint{restCall, rpcCall} {
+				if _, err := call(ctx, nil); err != nil {
+					return nil, err
+				}
+			}
+			return "ok", nil
+		},
+		httptransport.NopRequestDecoder,
+		encodeString,
+		httptransport.ServerBefore(httptransport.GenerateRequestID()),
+	)
+	r := gin.New()
+	r.GET("/", handler.ServeHTTP)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if want, have := http.StatusOK, rec.Code; want != have {
+		t.Fatalf("want %d, have %d: %s", want, have, rec.Body)
+	}
+
+	id := rec.Header().Get(httptransport.RequestIDHeader)
+	for _, name := range []string{"resty", "jsonrpc"} {
+		if have := <-received; id != have {
+			t.Errorf("%s: want %q, have %q", name, id, have)
+		}
+	}
+}
+
+func TestWithRequestIDPerCall(t *testing.T) {
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get(httptransport.RequestIDHeader)))
+	}))
+	defer downstream.Close()
+
+	client := httptransport.NewClient(resty.New(), httptransport.WithClientHost(downstream.URL))
+	call := client.Endpoint(httptransport.Req(http.MethodGet, "/", httptransport.WithReqHeader(httptransport.RequestIDHeader, "fixed")), httptransport.EncodeJSONRequest, decodeBody, httptransport.WithRequestID())
+	withID := func(id string) context.Context {
+		return context.WithValue(context.Background(), httptransport.ContextKeyRequestID, id)
+	}
+
+	// A call with an ID, then a call without one.
+	for _, tt := range []struct {
+		ctx  context.Context
+		want string
+	}{
+		{withID("id-a"), "id-a"},
+		{context.Background(), ""},
+	} {
+		if have, err := call(tt.ctx, nil); err != nil || tt.want != have {
+			t.Errorf("want %q, have %q (%v)", tt.want, have, err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			if have, err := call(withID(id), nil); err != nil || id != have {
+				t.Errorf("want %q, have %q (%v)", id, have, err)
+			}
+		}(fmt.Sprintf("id-%d", i))
+	}
+	wg.Wait()
+}
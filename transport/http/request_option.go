@@ -3,24 +3,193 @@ package http
 import (
 	"context"
 	"encoding/json"
-	"github.com/go-resty/resty/v2"
+	"io"
+	"net/http"
 	"os"
+
+	"github.com/go-kit/log"
+	"github.com/go-resty/resty/v2"
 )
 
+// WithRequestDebug writes the DebugInfo of every request as JSON to
+// os.Stdout, with DefaultRedactedHeaders redacted and bodies truncated to
+// 4KB. Use WithRequestDebugLog to write it elsewhere or redact more.
 func WithRequestDebug() RequestOption {
+	return WithRequestDebugLog(DebugWriter(os.Stdout))
+}
+
+// DebugOption sets an optional parameter for WithRequestDebugLog.
+type DebugOption func(*debugConfig)
+
+type debugConfig struct {
+	logger        log.Logger
+	maxBody       int
+	onRequest     bool
+	redactHeaders []string
+	redactPaths   []string
+}
+
+// DebugLogger logs the DebugInfo of requests to logger, under the keys
+// request, response and trace_info.
+func DebugLogger(logger log.Logger) DebugOption {
+	return func(c *debugConfig) { c.logger = logger }
+}
+
+// DebugWriter writes the DebugInfo of requests to w as JSON, one per line.
+func DebugWriter(w io.Writer) DebugOption {
+	return func(c *debugConfig) { c.logger = debugWriter{json.NewEncoder(log.NewSyncWriter(w))} }
+}
+
+// DebugMaxBody truncates bodies to n bytes. By default it is 4096.
+func DebugMaxBody(n int) DebugOption {
+	return func(c *debugConfig) { c.maxBody = n }
+}
+
+// DebugOnRequest only writes the DebugInfo of the requests whose context
+// holds true under ContextKeyRequestDebug, rather than of every request
+// whose context does not hold false.
+func DebugOnRequest() DebugOption {
+	return func(c *debugConfig) { c.onRequest = true }
+}
+
+// DebugRedactHeaders sets the headers whose values are written as Redacted.
+// By default they are DefaultRedactedHeaders.
+func DebugRedactHeaders(names ...string) DebugOption {
+	return func(c *debugConfig) { c.redactHeaders = names }
+}
+
+// DebugRedactJSON adds paths of fields of JSON bodies written as Redacted,
+// in the syntax of AccessLogRedactJSON.
+func DebugRedactJSON(paths ...string) DebugOption {
+	return func(c *debugConfig) { c.redactPaths = append(c.redactPaths, paths...) }
+}
+
+// ContextWithRequestDebug returns a copy of ctx enabling or disabling the
+// writing of the DebugInfo of the requests sent with it, overriding the
+// default of WithRequestDebugLog.
+func ContextWithRequestDebug(ctx context.Context, enabled bool) context.Context {
+	return context.WithValue(ctx, ContextKeyRequestDebug, enabled)
+}
+
+// WithRequestDebugLog writes the DebugInfo of every request, with its
+// headers, bodies and timings, once its response is received. Credentials
+// are redacted from the headers, bodies longer than the limit are
+// truncated, and bodies that are not text are only described. By default it
+// is written to os.Stdout as JSON.
+func WithRequestDebugLog(options ...DebugOption) RequestOption {
+	c := debugConfig{
+		maxBody:       4096,
+		redactHeaders: DefaultRedactedHeaders,
+	}
+	for _, option := range options {
+		option(&c)
+	}
+	if c.logger == nil {
+		DebugWriter(os.Stdout)(&c)
+	}
+	redact := newRedactor(c.redactHeaders, c.redactPaths)
+
+	enabled := func(ctx context.Context) bool {
+		on, ok := ctx.Value(ContextKeyRequestDebug).(bool)
+		if !ok {
+			return !c.onRequest
+		}
+		return on
+	}
 	return func(request *Request) {
 		request.before = append(request.before, func(ctx context.Context, req *resty.Request) context.Context {
-			req.EnableTrace()
+			if enabled(ctx) {
+				req.EnableTrace()
+			}
 			return ctx
 		})
 		request.after = append(request.after, func(ctx context.Context, resp *resty.Response) context.Context {
-			info := DebugInfo{
-				Response: SetResponse(resp),
-				Request:  SetRequest(resp.Request),
-				Info:     SetInfo(resp.Request.TraceInfo()),
+			if !enabled(ctx) {
+				return ctx
 			}
-			_ = json.NewEncoder(os.Stdout).Encode(info)
+			c.logger.Log(
+				"request", debugRequest(resp.Request, redact, c.maxBody),
+				"response", debugResponse(resp, redact, c.maxBody),
+				"trace_info", SetInfo(resp.Request.TraceInfo()),
+			)
 			return ctx
 		})
 	}
 }
+
+// debugWriter is a log.Logger writing the keys of WithRequestDebugLog as a
+// DebugInfo.
+type debugWriter struct {
+	enc *json.Encoder
+}
+
+func (w debugWriter) Log(keyvals ...interface{}) error {
+	var info DebugInfo
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		switch v := keyvals[i+1].(type) {
+		case RequestInfo:
+			info.Request = v
+		case ResponseInfo:
+			info.Response = v
+		case Info:
+			info.Info = v
+		}
+	}
+	return w.enc.Encode(info)
+}
+
+func debugRequest(req *resty.Request, redact redactor, maxBody int) RequestInfo {
+	info := SetRequest(req)
+	header := req.Header
+	if req.RawRequest != nil {
+		header = req.RawRequest.Header
+	}
+	info.Header = redactHeader(header, redact)
+
+	var b []byte
+	switch body := req.Body.(type) {
+	case nil:
+	case []byte:
+		b = body
+	case string:
+		b = []byte(body)
+	case io.Reader:
+		// The body was consumed when sent.
+		info.Body = "[stream]"
+		return info
+	default:
+		b, _ = json.Marshal(body)
+	}
+	info.Body = debugBody(b, redact, maxBody)
+	return info
+}
+
+func debugResponse(resp *resty.Response, redact redactor, maxBody int) ResponseInfo {
+	info := SetResponse(resp)
+	info.Header = redactHeader(resp.Header(), redact)
+	info.Body = debugBody(resp.Body(), redact, maxBody)
+	return info
+}
+
+func debugBody(b []byte, redact redactor, maxBody int) string {
+	size := int64(len(b))
+	if len(b) > maxBody {
+		b = b[:maxBody]
+	}
+	return redact.body(b, size)
+}
+
+func redactHeader(h http.Header, redact redactor) http.Header {
+	if len(h) == 0 {
+		return nil
+	}
+	redacted := make(http.Header, len(h))
+	for name := range h {
+		if redact.headers[http.CanonicalHeaderKey(name)] {
+			redacted[name] = []string{Redacted}
+		} else {
+			redacted[name] = h[name]
+		}
+	}
+	return redacted
+}
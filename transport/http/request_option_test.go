@@ -0,0 +1,142 @@
+package http_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/log"
+	"github.com/go-resty/resty/v2"
+)
+
+func newDebugUpstream() *httptest.Server {
+	r := gin.New()
+	r.POST("/login", func(gCtx *gin.Context) {
+		gCtx.Header("Set-Cookie", "session=secret")
+		gCtx.JSON(http.StatusOK, map[string]string{"token": "secret", "padding": strings.Repeat("x", 100)})
+	})
+	r.GET("/image", func(gCtx *gin.Context) {
+		gCtx.Data(http.StatusOK, "image/png", []byte{0x89, 'P', 'N', 'G', 0xff, 0xfe, 0x00})
+	})
+	return httptest.NewServer(r)
+}
+
+// debugLine is the part of a written DebugInfo checked by the tests, since
+// its trace info can not be decoded.
+type debugLine struct {
+	Request  httptransport.RequestInfo  `json:"request"`
+	Response httptransport.ResponseInfo `json:"response"`
+}
+
+func TestWithRequestDebugLog(t *testing.T) {
+	server := newDebugUpstream()
+	defer server.Close()
+
+	var buf bytes.Buffer
+	client := httptransport.NewClient(resty.New().SetHeader("Authorization", "Bearer secret"), httptransport.WithClientHost(server.URL))
+	debug := httptransport.WithRequestDebugLog(
+		httptransport.DebugWriter(&buf),
+		httptransport.DebugRedactJSON("password", "token"),
+	)
+	var body json.RawMessage
+	login := client.Endpoint(httptransport.Req(http.MethodPost, "/login"), httptransport.EncodeJSONRequest, httptransport.DecodeJSONResponse(&body), debug)
+	if _, err := login(context.Background(), map[string]string{"user": "ann", "password": "secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var info debugLine
+	if err := json.Unmarshal(buf.Bytes(), &info); err != nil {
+		t.Fatalf("%v: %s", err, buf.String())
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("secret written: %s", buf.String())
+	}
+	if want, have := httptransport.Redacted, info.Request.Header.Get("Authorization"); want != have {
+		t.Errorf("Authorization: want %q, have %q", want, have)
+	}
+	if want, have := httptransport.Redacted, info.Response.Header.Get("Set-Cookie"); want != have {
+		t.Errorf("Set-Cookie: want %q, have %q", want, have)
+	}
+	if want, have := `{"password":"[REDACTED]","user":"ann"}`, info.Request.Body; want != have {
+		t.Errorf("request body: want %s, have %s", want, have)
+	}
+	if want, have := http.StatusOK, info.Response.StatusCode; want != have {
+		t.Errorf("status: want %d, have %d", want, have)
+	}
+	if !strings.Contains(info.Response.Body.(string), `"token":"[REDACTED]"`) {
+		t.Errorf("response body: have %s", info.Response.Body)
+	}
+
+	buf.Reset()
+	var image string
+	get := client.Endpoint(httptransport.Req(http.MethodGet, "/image"), httptransport.EncodeJSONRequest, httptransport.DecodeJSONResponse(&image),
+		httptransport.WithRequestDebugLog(httptransport.DebugWriter(&buf)))
+	if _, err := get(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	info = debugLine{}
+	if err := json.Unmarshal(buf.Bytes(), &info); err != nil {
+		t.Fatalf("%v: %s", err, buf.String())
+	}
+	if want, have := "[binary 7 bytes]", info.Response.Body; want != have {
+		t.Errorf("binary body: want %q, have %q", want, have)
+	}
+}
+
+func TestWithRequestDebugLogTruncate(t *testing.T) {
+	server := newDebugUpstream()
+	defer server.Close()
+
+	var buf bytes.Buffer
+	client := httptransport.NewClient(resty.New(), httptransport.WithClientHost(server.URL))
+	var body json.RawMessage
+	login := client.Endpoint(httptransport.Req(http.MethodPost, "/login"), httptransport.EncodeJSONRequest, httptransport.DecodeJSONResponse(&body),
+		httptransport.WithRequestDebugLog(httptransport.DebugWriter(&buf), httptransport.DebugMaxBody(20)))
+	if _, err := login(context.Background(), "hello"); err != nil {
+		t.Fatal(err)
+	}
+	var info debugLine
+	if err := json.Unmarshal(buf.Bytes(), &info); err != nil {
+		t.Fatalf("%v: %s", err, buf.String())
+	}
+	if have := info.Response.Body.(string); !strings.HasSuffix(have, "...[truncated 131 bytes]") || len(have) > 20+len("...[truncated 131 bytes]") {
+		t.Errorf("response body not truncated: %s", have)
+	}
+}
+
+func TestWithRequestDebugLogOnRequest(t *testing.T) {
+	server := newDebugUpstream()
+	defer server.Close()
+
+	var buf bytes.Buffer
+	client := httptransport.NewClient(resty.New(), httptransport.WithClientHost(server.URL))
+	var body json.RawMessage
+	login := client.Endpoint(httptransport.Req(http.MethodPost, "/login"), httptransport.EncodeJSONRequest, httptransport.DecodeJSONResponse(&body),
+		httptransport.WithRequestDebugLog(httptransport.DebugLogger(log.NewJSONLogger(&buf)), httptransport.DebugOnRequest()))
+
+	if _, err := login(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("want nothing written, have %s", buf.String())
+	}
+
+	if _, err := login(httptransport.ContextWithRequestDebug(context.Background(), true), nil); err != nil {
+		t.Fatal(err)
+	}
+	var line map[string]json.RawMessage
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("%v: %s", err, buf.String())
+	}
+	for _, key := range []string{"request", "response", "trace_info"} {
+		if _, ok := line[key]; !ok {
+			t.Errorf("missing %s in %s", key, buf.String())
+		}
+	}
+}
@@ -31,7 +31,27 @@ func SetContentType(contentType string) ServerResponseFunc {
 // SetResponseHeader returns a ServerResponseFunc that sets the given header.
 func SetResponseHeader(key, val string) ServerResponseFunc {
 	return func(ctx context.Context, gCtx *gin.Context) context.Context {
-		gCtx.Set(key, val)
+		gCtx.Writer.Header().Set(key, val)
+		return ctx
+	}
+}
+
+// AddResponseHeader returns a ServerResponseFunc that adds the given value to
+// the values of a header.
+func AddResponseHeader(key, val string) ServerResponseFunc {
+	return func(ctx context.Context, gCtx *gin.Context) context.Context {
+		gCtx.Writer.Header().Add(key, val)
+		return ctx
+	}
+}
+
+// RemoveResponseHeader returns a ServerResponseFunc that removes the given
+// headers.
+func RemoveResponseHeader(keys ...string) ServerResponseFunc {
+	return func(ctx context.Context, gCtx *gin.Context) context.Context {
+		for _, key := range keys {
+			gCtx.Writer.Header().Del(key)
+		}
 		return ctx
 	}
 }
@@ -39,7 +59,18 @@ func SetResponseHeader(key, val string) ServerResponseFunc {
 // SetRequestHeader returns a RequestFunc that sets the given header.
 func SetRequestHeader(key, val string) RequestFunc {
 	return func(ctx context.Context, gCtx *gin.Context) context.Context {
-		gCtx.Header(key, val)
+		gCtx.Request.Header.Set(key, val)
+		return ctx
+	}
+}
+
+// RemoveRequestHeader returns a RequestFunc that removes the given headers,
+// such as internal headers clients must not be able to set.
+func RemoveRequestHeader(keys ...string) RequestFunc {
+	return func(ctx context.Context, gCtx *gin.Context) context.Context {
+		for _, key := range keys {
+			gCtx.Request.Header.Del(key)
+		}
 		return ctx
 	}
 }
@@ -115,6 +146,9 @@ const (
 	// PopulateRequestContext. Its value is r.Method.
 	ContextKeyRequestMethod contextKey = iota
 
+	// ContextKeyRequestDebug enables or disables WithRequestDebugLog for the
+	// requests sent with the context. Its value is of type bool, and is set
+	// with ContextWithRequestDebug.
 	ContextKeyRequestDebug
 
 	// ContextKeyRequestURI is populated in the context by
@@ -175,4 +209,32 @@ const (
 	// ContextKeyResponseSize is populated in the context whenever a
 	// ServerFinalizerFunc is specified. Its value is of type int64.
 	ContextKeyResponseSize
+
+	// ContextKeyRateLimit is populated in the context by ServerRateLimit.
+	// Its value is of type LimitInfo.
+	ContextKeyRateLimit
+
+	// ContextKeyConcurrencyLimit is populated in the context by
+	// ServerConcurrencyLimit. Its value is of type LimitInfo.
+	ContextKeyConcurrencyLimit
+
+	// ContextKeyPrincipal is populated in the context by the authenticators
+	// of this package. Its value is of type Principal.
+	ContextKeyPrincipal
+
+	// ContextKeyAuthorization is populated in the context by ServerAuthorize.
+	// Its value is of type *AuthorizationDecision.
+	ContextKeyAuthorization
+
+	// ContextKeyConnection is populated in the context of requests by
+	// ConnContext. Its value is of type net.Conn.
+	ContextKeyConnection
+
+	// ContextKeyDraining is populated in the context by ServerRunner. Its
+	// value is of type <-chan struct{}, closed once the Runner drains.
+	ContextKeyDraining
+
+	// ContextKeyRequestID is populated in the context by GenerateRequestID.
+	// Its value is of type string.
+	ContextKeyRequestID
 )
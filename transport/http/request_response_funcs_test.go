@@ -2,29 +2,122 @@ package http_test
 
 import (
 	"context"
+	"net/http"
 	"net/http/httptest"
 	"testing"
 
-	httptransport "github.com/go-kit/kit/transport/http"
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/gin-gonic/gin"
 )
 
+func newTestContext(method string, header http.Header) (*gin.Context, *httptest.ResponseRecorder) {
+	r := httptest.NewRecorder()
+	gCtx, _ := gin.CreateTestContext(r)
+	gCtx.Request = httptest.NewRequest(method, "/", nil)
+	for k, v := range header {
+		gCtx.Request.Header[k] = v
+	}
+	return gCtx, r
+}
+
 func TestSetHeader(t *testing.T) {
 	const (
 		key = "X-Foo"
 		val = "12345"
 	)
-	r := httptest.NewRecorder()
-	httptransport.SetResponseHeader(key, val)(context.Background(), r)
+	gCtx, r := newTestContext(http.MethodGet, nil)
+	httptransport.SetResponseHeader(key, val)(context.Background(), gCtx)
+	gCtx.Writer.WriteHeaderNow()
 	if want, have := val, r.Header().Get(key); want != have {
 		t.Errorf("want %q, have %q", want, have)
 	}
+	if _, ok := gCtx.Get(key); ok {
+		t.Errorf("header was set as a gin key")
+	}
 }
 
 func TestSetContentType(t *testing.T) {
 	const contentType = "application/json"
-	r := httptest.NewRecorder()
-	httptransport.SetContentType(contentType)(context.Background(), r)
+	gCtx, r := newTestContext(http.MethodGet, nil)
+	httptransport.SetContentType(contentType)(context.Background(), gCtx)
+	gCtx.Writer.WriteHeaderNow()
 	if want, have := contentType, r.Header().Get("Content-Type"); want != have {
 		t.Errorf("want %q, have %q", want, have)
 	}
 }
+
+func TestAddRemoveResponseHeader(t *testing.T) {
+	gCtx, r := newTestContext(http.MethodGet, nil)
+	ctx := context.Background()
+	httptransport.AddResponseHeader("Vary", "Origin")(ctx, gCtx)
+	httptransport.AddResponseHeader("Vary", "Accept")(ctx, gCtx)
+	httptransport.SetResponseHeader("Server", "gink")(ctx, gCtx)
+	httptransport.RemoveResponseHeader("Server")(ctx, gCtx)
+	gCtx.Writer.WriteHeaderNow()
+	if want, have := []string{"Origin", "Accept"}, r.Header().Values("Vary"); len(want) != len(have) || want[0] != have[0] || want[1] != have[1] {
+		t.Errorf("Vary: want %q, have %q", want, have)
+	}
+	if have := r.Header().Get("Server"); have != "" {
+		t.Errorf("Server: want none, have %q", have)
+	}
+}
+
+func TestRequestHeader(t *testing.T) {
+	gCtx, r := newTestContext(http.MethodGet, http.Header{
+		"X-Correlation-Id": {" abc "},
+		"X-Internal":       {"1"},
+		"Accept":           {" ", "application/json "},
+		"X-Empty":          {""},
+	})
+	ctx := context.Background()
+	httptransport.NormalizeRequestHeaders(ctx, gCtx)
+	httptransport.RenameRequestHeader("X-Correlation-ID", "X-Request-ID")(ctx, gCtx)
+	httptransport.RemoveRequestHeader("X-Internal")(ctx, gCtx)
+	httptransport.SetRequestHeader("X-Tenant", "acme")(ctx, gCtx)
+
+	for k, want := range map[string]string{
+		"X-Request-Id":     "abc",
+		"X-Correlation-Id": "",
+		"X-Internal":       "",
+		"Accept":           "application/json",
+		"X-Tenant":         "acme",
+	} {
+		if have := gCtx.Request.Header.Get(k); want != have {
+			t.Errorf("%s: want %q, have %q", k, want, have)
+		}
+	}
+	if _, ok := gCtx.Request.Header["X-Empty"]; ok {
+		t.Error("empty header was not dropped")
+	}
+	if len(r.Header()) != 0 {
+		t.Errorf("request headers leaked into the response: %v", r.Header())
+	}
+}
+
+func TestSetSecurityHeaders(t *testing.T) {
+	handler := httptransport.NewServer(
+		func(context.Context, interface{}) (interface{}, error) {
+			return nil, httptransport.NewStatusError(http.StatusNotFound, "")
+		},
+		httptransport.NopRequestDecoder,
+		httptransport.EncodeJSONResponse,
+		httptransport.ServerBefore(httptransport.SetSecurityHeaders(httptransport.DefaultSecurityHeaders)),
+	)
+	r := gin.New()
+	r.GET("/", handler.ServeHTTP)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	resp, _ := getWithHeader(t, server.URL, "", "")
+	for k, want := range map[string]string{
+		"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+		"Content-Security-Policy":   "default-src 'none'; frame-ancestors 'none'",
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "DENY",
+		"Referrer-Policy":           "no-referrer",
+	} {
+		if have := resp.Header.Get(k); want != have {
+			t.Errorf("%s: want %q, have %q", k, want, have)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package http
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+)
+
+// Runner serves a handler, usually a gin.Engine, until it receives a signal
+// or its context is done, and then shuts it down gracefully: it reports
+// itself as not ready, stops accepting connections, waits for the requests of
+// the Servers registered with ServerRunner to complete, and runs its shutdown
+// hooks.
+type Runner struct {
+	server       *http.Server
+	listener     net.Listener
+	signals      []os.Signal
+	drainDelay   time.Duration
+	drainTimeout time.Duration
+	hooks        []func(context.Context) error
+	logger       log.Logger
+
+	mu       sync.Mutex
+	ready    bool
+	inFlight int
+	idle     chan struct{}
+	draining chan struct{}
+	drained  bool
+}
+
+// RunnerOption sets an optional parameter for Runners.
+type RunnerOption func(*Runner)
+
+// RunnerListener makes the Runner serve on l rather than listen on its
+// address.
+func RunnerListener(l net.Listener) RunnerOption {
+	return func(r *Runner) { r.listener = l }
+}
+
+// RunnerHTTPServer makes the Runner serve with s, so that its timeouts can be
+// set. If its TLSConfig is set, TLS is served with the certificates it holds.
+// Its Addr and Handler are set from the arguments of NewRunner if empty, and
+// its ConnContext is set to ConnContext.
+func RunnerHTTPServer(s *http.Server) RunnerOption {
+	return func(r *Runner) { r.server = s }
+}
+
+// RunnerSignals sets the signals the Runner shuts down on. By default they
+// are SIGTERM and SIGINT.
+func RunnerSignals(signals ...os.Signal) RunnerOption {
+	return func(r *Runner) { r.signals = signals }
+}
+
+// RunnerDrainDelay sets how long the Runner keeps accepting requests once it
+// reports itself as not ready, so that load balancers polling its readiness
+// stop sending it requests before it stops listening. By default it is 0.
+func RunnerDrainDelay(d time.Duration) RunnerOption {
+	return func(r *Runner) { r.drainDelay = d }
+}
+
+// RunnerDrainTimeout sets how long the Runner waits for in-flight requests
+// before closing their connections. By default it is 30 seconds.
+func RunnerDrainTimeout(d time.Duration) RunnerOption {
+	return func(r *Runner) { r.drainTimeout = d }
+}
+
+// RunnerLogger sets the logger the Runner reports its shutdown to. By
+// default nothing is logged.
+func RunnerLogger(logger log.Logger) RunnerOption {
+	return func(r *Runner) { r.logger = logger }
+}
+
+// RunnerOnShutdown adds a hook run once the requests are drained. Hooks are
+// run in the reverse order they were added, with a context bounded by the
+// drain timeout.
+func RunnerOnShutdown(f func(ctx context.Context) error) RunnerOption {
+	return func(r *Runner) { r.hooks = append(r.hooks, f) }
+}
+
+// RunnerStopInstancers stops instancers once the requests are drained, so
+// that their service discovery watches are released.
+func RunnerStopInstancers(instancers ...sd.Instancer) RunnerOption {
+	return RunnerOnShutdown(func(context.Context) error {
+		for _, instancer := range instancers {
+			instancer.Stop()
+		}
+		return nil
+	})
+}
+
+// RunnerCloseClients closes the idle connections of clients once the
+// requests are drained.
+func RunnerCloseClients(clients ...*Client) RunnerOption {
+	return RunnerOnShutdown(func(context.Context) error {
+		for _, client := range clients {
+			client.client.GetClient().CloseIdleConnections()
+		}
+		return nil
+	})
+}
+
+// NewRunner returns a Runner serving handler on addr.
+func NewRunner(addr string, handler http.Handler, options ...RunnerOption) *Runner {
+	r := &Runner{
+		signals:      []os.Signal{syscall.SIGTERM, os.Interrupt},
+		drainTimeout: 30 * time.Second,
+		logger:       log.NewNopLogger(),
+		draining:     make(chan struct{}),
+	}
+	for _, option := range options {
+		option(r)
+	}
+	if r.server == nil {
+		r.server = &http.Server{}
+	}
+	if r.server.Addr == "" {
+		r.server.Addr = addr
+	}
+	if r.server.Handler == nil {
+		r.server.Handler = handler
+	}
+	if r.server.ConnContext == nil {
+		r.server.ConnContext = ConnContext
+	}
+	return r
+}
+
+// ServerRunner registers the Server with r, so that r waits for its requests
+// when shutting down. The context of its requests holds the channel returned
+// by r.Draining under ContextKeyDraining, so that long-lived responses, such
+// as event streams, can end once r drains.
+func ServerRunner(r *Runner) ServerOption {
+	return func(s *Server) { s.runner = r }
+}
+
+// Run serves until ctx is done or one of the signals of the Runner is
+// received, and then shuts down. It returns nil if the requests were drained
+// and the hooks succeeded.
+func (r *Runner) Run(ctx context.Context) error {
+	l := r.listener
+	if l == nil {
+		var err error
+		if l, err = net.Listen("tcp", r.server.Addr); err != nil {
+			return errors.Wrap(err, "listen")
+		}
+	}
+
+	signals := make(chan os.Signal, 1)
+	if len(r.signals) > 0 {
+		signal.Notify(signals, r.signals...)
+		defer signal.Stop(signals)
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		if r.server.TLSConfig != nil {
+			served <- r.server.ServeTLS(l, "", "")
+		} else {
+			served <- r.server.Serve(l)
+		}
+	}()
+	r.mu.Lock()
+	r.ready = true
+	r.mu.Unlock()
+
+	select {
+	case err := <-served:
+		r.drain()
+		return errors.Wrap(err, "serve")
+	case sig := <-signals:
+		r.logger.Log("msg", "shutting down", "signal", sig.String())
+	case <-ctx.Done():
+		r.logger.Log("msg", "shutting down", "err", ctx.Err())
+	}
+	return r.shutdown()
+}
+
+func (r *Runner) shutdown() error {
+	r.drain()
+	if r.drainDelay > 0 {
+		time.Sleep(r.drainDelay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.drainTimeout)
+	defer cancel()
+	r.logger.Log("msg", "draining", "in_flight", r.InFlight())
+	err := r.server.Shutdown(ctx)
+	if err == nil {
+		err = r.waitIdle(ctx)
+	}
+	if err != nil {
+		err = errors.Errorf("drain timed out with %d requests in flight", r.InFlight())
+		r.logger.Log("msg", "closing connections", "err", err)
+		r.server.Close()
+	}
+
+	hookCtx, cancel := context.WithTimeout(context.Background(), r.drainTimeout)
+	defer cancel()
+	for i := len(r.hooks) - 1; i >= 0; i-- {
+		if hookErr := r.hooks[i](hookCtx); hookErr != nil {
+			r.logger.Log("msg", "shutdown hook failed", "err", hookErr)
+			if err == nil {
+				err = errors.Wrap(hookErr, "shutdown hook")
+			}
+		}
+	}
+	r.logger.Log("msg", "shut down")
+	return err
+}
+
+// drain reports the Runner as not ready and closes its draining channel.
+func (r *Runner) drain() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ready = false
+	if !r.drained {
+		r.drained = true
+		close(r.draining)
+	}
+}
+
+// Ready reports whether the Runner is serving and not shutting down.
+func (r *Runner) Ready() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ready
+}
+
+// InFlight returns the number of requests being served by the Servers
+// registered with the Runner.
+func (r *Runner) InFlight() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.inFlight
+}
+
+// Draining returns a channel closed once the Runner starts shutting down.
+func (r *Runner) Draining() <-chan struct{} {
+	return r.draining
+}
+
+// track counts a request as in flight until the returned func is called.
+func (r *Runner) track() func() {
+	r.mu.Lock()
+	r.inFlight++
+	r.mu.Unlock()
+	return func() {
+		r.mu.Lock()
+		r.inFlight--
+		if r.inFlight == 0 && r.idle != nil {
+			close(r.idle)
+			r.idle = nil
+		}
+		r.mu.Unlock()
+	}
+}
+
+func (r *Runner) waitIdle(ctx context.Context) error {
+	r.mu.Lock()
+	if r.inFlight == 0 {
+		r.mu.Unlock()
+		return nil
+	}
+	if r.idle == nil {
+		r.idle = make(chan struct{})
+	}
+	idle := r.idle
+	r.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,195 @@
+package http_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/kit/sd"
+)
+
+type stopInstancer struct {
+	sd.FixedInstancer
+	stopped chan struct{}
+}
+
+func (i stopInstancer) Stop() { close(i.stopped) }
+
+func TestRunner(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		instancer = stopInstancer{stopped: make(chan struct{})}
+		hooks     []string
+		started   = make(chan struct{}, 2)
+		release   = make(chan struct{})
+	)
+	r := gin.New()
+	runner := httptransport.NewRunner("", r,
+		httptransport.RunnerListener(l),
+		httptransport.RunnerSignals(),
+		httptransport.RunnerStopInstancers(instancer),
+		httptransport.RunnerOnShutdown(func(context.Context) error { hooks = append(hooks, "first"); return nil }),
+		httptransport.RunnerOnShutdown(func(context.Context) error { hooks = append(hooks, "second"); return nil }),
+	)
+
+	slow := httptransport.NewServer(
+		func(context.Context, interface{}) (interface{}, error) {
+			started <- struct{}{}
+			<-release
+			return struct{}{}, nil
+		},
+		httptransport.NopRequestDecoder,
+		httptransport.EncodeJSONResponse,
+		httptransport.ServerRunner(runner),
+	)
+	stream := httptransport.NewServer(
+		func(context.Context, interface{}) (interface{}, error) { return nil, nil },
+		httptransport.NopRequestDecoder,
+		func(ctx context.Context, gCtx *gin.Context, _ interface{}) error {
+			draining := ctx.Value(httptransport.ContextKeyDraining).(<-chan struct{})
+			started <- struct{}{}
+			gCtx.Stream(func(w io.Writer) bool {
+				select {
+				case <-draining:
+					gCtx.SSEvent("bye", "draining")
+					return false
+				case <-time.After(10 * time.Millisecond):
+					gCtx.SSEvent("tick", "")
+					return true
+				}
+			})
+			return nil
+		},
+		httptransport.ServerRunner(runner),
+	)
+	r.GET("/slow", slow.ServeHTTP)
+	r.GET("/stream", stream.ServeHTTP)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- runner.Run(ctx) }()
+
+	url := "http://" + l.Addr().String()
+	type result struct {
+		code int
+		body string
+		err  error
+	}
+	get := func(path string) <-chan result {
+		c := make(chan result, 1)
+		go func() {
+			resp, err := http.Get(url + path)
+			if err != nil {
+				c <- result{err: err}
+				return
+			}
+			b, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			c <- result{code: resp.StatusCode, body: string(b)}
+		}()
+		return c
+	}
+	slowResult, streamResult := get("/slow"), get("/stream")
+	<-started
+	<-started
+	if !runner.Ready() {
+		t.Error("runner not ready while serving")
+	}
+	if want, have := 2, runner.InFlight(); want != have {
+		t.Errorf("in flight: want %d, have %d", want, have)
+	}
+
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	if runner.Ready() {
+		t.Error("runner ready while draining")
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("runner returned before requests were drained: %v", err)
+	default:
+	}
+	close(release)
+
+	if res := <-slowResult; res.err != nil || res.code != http.StatusOK {
+		t.Errorf("in-flight request: %d %v", res.code, res.err)
+	}
+	if res := <-streamResult; res.err != nil || !strings.Contains(res.body, "event:bye") {
+		t.Errorf("stream: %q %v", res.body, res.err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runner did not shut down")
+	}
+	select {
+	case <-instancer.stopped:
+	default:
+		t.Error("instancer not stopped")
+	}
+	if want, have := "second first", strings.Join(hooks, " "); want != have {
+		t.Errorf("hooks: want %q, have %q", want, have)
+	}
+	if _, err := http.Get(url + "/slow"); err == nil {
+		t.Error("runner still accepting requests")
+	}
+}
+
+func TestRunnerDrainTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hooked bool
+	r := gin.New()
+	runner := httptransport.NewRunner("", r,
+		httptransport.RunnerListener(l),
+		httptransport.RunnerSignals(),
+		httptransport.RunnerDrainTimeout(100*time.Millisecond),
+		httptransport.RunnerOnShutdown(func(context.Context) error { hooked = true; return nil }),
+	)
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	stuck := httptransport.NewServer(
+		func(context.Context, interface{}) (interface{}, error) {
+			close(started)
+			<-release
+			return struct{}{}, nil
+		},
+		httptransport.NopRequestDecoder,
+		httptransport.EncodeJSONResponse,
+		httptransport.ServerRunner(runner),
+	)
+	r.GET("/", stuck.ServeHTTP)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- runner.Run(ctx) }()
+	go http.Get("http://" + l.Addr().String())
+	<-started
+
+	begin := time.Now()
+	cancel()
+	if err := <-done; err == nil {
+		t.Error("want drain error, have none")
+	}
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Errorf("shut down after %s", elapsed)
+	}
+	if !hooked {
+		t.Error("hooks not run after drain timeout")
+	}
+}
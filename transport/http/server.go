@@ -1,14 +1,19 @@
 package http
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/transport"
 	"github.com/go-kit/log"
 	"go.opentelemetry.io/otel/trace"
+	"net"
 	"net/http"
+	"time"
 )
 
 // Server wraps an endpoint and implements http.Handler.
@@ -21,8 +26,19 @@ type Server struct {
 	errorEncoder ErrorEncoder
 	finalizer    []ServerFinalizerFunc
 	errorHandler transport.ErrorHandler
+	interceptors []interceptor
+	cors         *CORSPolicy
+	runner       *Runner
 }
 
+// handlerFunc serves a request once the ServerBefore functions have been
+// executed, and returns the context the finalizers are executed with.
+type handlerFunc func(ctx context.Context, gCtx *gin.Context) context.Context
+
+// interceptor wraps the decode, endpoint and encode steps of a Server. It may
+// answer a request without calling next, or call next more than once.
+type interceptor func(next handlerFunc) handlerFunc
+
 // NewServer constructs a new server, which implements http.Handler and wraps
 // the provided endpoint.
 func NewServer(
@@ -48,11 +64,20 @@ func NewServer(
 type ServerOption func(*Server)
 
 // ServerBefore functions are executed on the HTTP request object before the
-// request is decoded.
+// request is decoded. They may reject the request with Abort.
 func ServerBefore(before ...RequestFunc) ServerOption {
 	return func(s *Server) { s.before = append(s.before, before...) }
 }
 
+// Abort stops the processing of a request from a RequestFunc executed by a
+// Server: the remaining ServerBefore functions, the decoder and the endpoint
+// are skipped, and err is passed to the error handler and error encoder. A
+// RequestFunc that writes the response itself may call gCtx.Abort instead.
+func Abort(gCtx *gin.Context, err error) {
+	gCtx.Error(err)
+	gCtx.Abort()
+}
+
 // ServerAfter functions are executed on the HTTP response writer after the
 // endpoint is invoked, but before anything is written to the client.
 func ServerAfter(after ...ServerResponseFunc) ServerOption {
@@ -96,6 +121,11 @@ func ServerFinalizer(f ...ServerFinalizerFunc) ServerOption {
 func (s Server) ServeHTTP(gCtx *gin.Context) {
 	ctx := gCtx.Request.Context()
 
+	if s.runner != nil {
+		defer s.runner.track()()
+		ctx = context.WithValue(ctx, ContextKeyDraining, s.runner.Draining())
+	}
+
 	if len(s.finalizer) > 0 {
 		iw := &interceptingWriter{gCtx.Writer, http.StatusOK, 0}
 		defer func() {
@@ -110,20 +140,35 @@ func (s Server) ServeHTTP(gCtx *gin.Context) {
 
 	for _, f := range s.before {
 		ctx = f(ctx, gCtx)
+		if gCtx.IsAborted() {
+			if err := gCtx.Errors.Last(); err != nil {
+				s.errorHandler.Handle(ctx, err.Err)
+				s.errorEncoder(ctx, err.Err, gCtx)
+			}
+			return
+		}
 	}
 
+	h := s.serve
+	for i := len(s.interceptors) - 1; i >= 0; i-- {
+		h = s.interceptors[i](h)
+	}
+	ctx = h(ctx, gCtx)
+}
+
+func (s Server) serve(ctx context.Context, gCtx *gin.Context) context.Context {
 	request, err := s.dec(ctx, gCtx)
 	if err != nil {
 		s.errorHandler.Handle(ctx, err)
 		s.errorEncoder(ctx, err, gCtx)
-		return
+		return ctx
 	}
 
 	response, err := s.e(ctx, request)
 	if err != nil {
 		s.errorHandler.Handle(ctx, err)
 		s.errorEncoder(ctx, err, gCtx)
-		return
+		return ctx
 	}
 
 	for _, f := range s.after {
@@ -133,8 +178,9 @@ func (s Server) ServeHTTP(gCtx *gin.Context) {
 	if err := s.enc(ctx, gCtx, response); err != nil {
 		s.errorHandler.Handle(ctx, err)
 		s.errorEncoder(ctx, err, gCtx)
-		return
+		return ctx
 	}
+	return ctx
 }
 
 // ErrorEncoder is responsible for encoding an error to the ResponseWriter.
@@ -268,3 +314,130 @@ func (w *interceptingWriter) Write(p []byte) (int, error) {
 	w.written += int64(n)
 	return n, err
 }
+
+// bufferingWriter holds back the status and body written by an encoder, so
+// the response can be inspected, replaced or stored before it is sent with
+// flush. Headers are written straight through to the wrapped writer.
+type bufferingWriter struct {
+	gin.ResponseWriter
+	code    int
+	written bool
+	buf     bytes.Buffer
+}
+
+func newBufferingWriter(w gin.ResponseWriter) *bufferingWriter {
+	return &bufferingWriter{ResponseWriter: w, code: http.StatusOK}
+}
+
+func (w *bufferingWriter) WriteHeader(code int) {
+	if code > 0 {
+		w.code = code
+	}
+}
+
+func (w *bufferingWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *bufferingWriter) Write(p []byte) (int, error) {
+	w.written = true
+	return w.buf.Write(p)
+}
+
+func (w *bufferingWriter) WriteString(s string) (int, error) {
+	w.written = true
+	return w.buf.WriteString(s)
+}
+
+func (w *bufferingWriter) Status() int {
+	return w.code
+}
+
+func (w *bufferingWriter) Size() int {
+	if !w.written {
+		return -1
+	}
+	return w.buf.Len()
+}
+
+func (w *bufferingWriter) Written() bool {
+	return w.written
+}
+
+// Flush is a no-op, the body is only sent by flush.
+func (w *bufferingWriter) Flush() {}
+
+// flush sends the buffered status and body to the wrapped writer.
+func (w *bufferingWriter) flush() error {
+	w.ResponseWriter.WriteHeader(w.code)
+	if w.buf.Len() == 0 {
+		w.ResponseWriter.WriteHeaderNow()
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	return err
+}
+
+// detachedWriter is a gin.ResponseWriter that is not connected to a client,
+// it is used to serve requests in the background. The body is discarded.
+type detachedWriter struct {
+	header http.Header
+	code   int
+	size   int
+}
+
+func newDetachedWriter() *detachedWriter {
+	return &detachedWriter{header: make(http.Header), code: http.StatusOK, size: -1}
+}
+
+func (w *detachedWriter) Header() http.Header { return w.header }
+
+func (w *detachedWriter) WriteHeader(code int) {
+	if code > 0 && w.size < 0 {
+		w.code = code
+	}
+}
+
+func (w *detachedWriter) WriteHeaderNow() {
+	if w.size < 0 {
+		w.size = 0
+	}
+}
+
+func (w *detachedWriter) Write(p []byte) (int, error) {
+	w.WriteHeaderNow()
+	w.size += len(p)
+	return len(p), nil
+}
+
+func (w *detachedWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *detachedWriter) Status() int { return w.code }
+
+func (w *detachedWriter) Size() int { return w.size }
+
+func (w *detachedWriter) Written() bool { return w.size >= 0 }
+
+func (w *detachedWriter) Flush() { w.WriteHeaderNow() }
+
+func (w *detachedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("detached response writer can not be hijacked")
+}
+
+func (w *detachedWriter) CloseNotify() <-chan bool { return make(chan bool) }
+
+func (w *detachedWriter) Pusher() http.Pusher { return nil }
+
+// detachedContext keeps the values of its parent but is never canceled and
+// has no deadline.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+func (detachedContext) Err() error { return nil }
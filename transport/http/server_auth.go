@@ -0,0 +1,109 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Principal is the verified identity of the caller of a request.
+type Principal struct {
+	// Subject identifies the caller, such as the sub claim of a JWT or the
+	// owner of an API key.
+	Subject string
+	// Method is the scheme the caller was authenticated with: "jwt",
+	// "apikey" or "hmac".
+	Method string
+	Roles  []string
+	Scopes []string
+	// Claims are the claims of a JWT.
+	Claims map[string]interface{}
+}
+
+const (
+	// KeyPrincipal is populated in the gin keys by the authenticators of this
+	// package. Its value is of type Principal.
+	KeyPrincipal = "KeyPrincipal"
+	// KeyPrincipalSubject is populated in the gin keys by the authenticators
+	// of this package. Its value is the Subject of the Principal.
+	KeyPrincipalSubject = "KeyPrincipalSubject"
+)
+
+// SetPrincipal populates p in the gin keys under KeyPrincipal and
+// KeyPrincipalSubject, and in the context under ContextKeyPrincipal, so that
+// handlers can bind it with ginkey tags and endpoints can read it with
+// PrincipalFromContext.
+func SetPrincipal(ctx context.Context, gCtx *gin.Context, p Principal) context.Context {
+	gCtx.Set(KeyPrincipal, p)
+	gCtx.Set(KeyPrincipalSubject, p.Subject)
+	return context.WithValue(ctx, ContextKeyPrincipal, p)
+}
+
+// PrincipalFromContext returns the Principal populated in ctx by an
+// authenticator.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(ContextKeyPrincipal).(Principal)
+	return p, ok
+}
+
+// unauthorized returns a 401 StatusError with the given WWW-Authenticate
+// challenge.
+func unauthorized(challenge, message string) *StatusError {
+	return &StatusError{
+		Code:    http.StatusUnauthorized,
+		Message: message,
+		Header:  http.Header{"Www-Authenticate": []string{challenge}},
+	}
+}
+
+// APIKeyOption sets an optional parameter for APIKeyAuthenticator.
+type APIKeyOption func(*apiKeyAuthenticator)
+
+// APIKeyHeader sets the header keys are read from. By default it is
+// X-API-Key.
+func APIKeyHeader(name string) APIKeyOption {
+	return func(a *apiKeyAuthenticator) { a.header = name }
+}
+
+// APIKeyAuthenticator returns a RequestFunc that authenticates requests by a
+// static API key, mapping each key to the Principal it identifies. Requests
+// without a known key are aborted with a 401 StatusError.
+func APIKeyAuthenticator(keys map[string]Principal, options ...APIKeyOption) RequestFunc {
+	a := &apiKeyAuthenticator{
+		header: "X-API-Key",
+		keys:   make(map[[sha256.Size]byte]Principal, len(keys)),
+	}
+	for key, p := range keys {
+		if p.Method == "" {
+			p.Method = "apikey"
+		}
+		a.keys[sha256.Sum256([]byte(key))] = p
+	}
+	for _, option := range options {
+		option(a)
+	}
+	return a.authenticate
+}
+
+type apiKeyAuthenticator struct {
+	header string
+	// keys are indexed by their hash, so that looking them up does not leak
+	// their prefix through timing.
+	keys map[[sha256.Size]byte]Principal
+}
+
+func (a *apiKeyAuthenticator) authenticate(ctx context.Context, gCtx *gin.Context) context.Context {
+	key := gCtx.GetHeader(a.header)
+	if key == "" {
+		Abort(gCtx, unauthorized("ApiKey", "missing API key"))
+		return ctx
+	}
+	p, ok := a.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		Abort(gCtx, unauthorized("ApiKey", "invalid API key"))
+		return ctx
+	}
+	return SetPrincipal(ctx, gCtx, p)
+}
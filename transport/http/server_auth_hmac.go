@@ -0,0 +1,205 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HMACScheme is the Authorization scheme of requests signed with HMAC. The
+// header has the form
+//
+//	Authorization: HMAC-SHA256 KeyId=<id>, Timestamp=<unix seconds>, Nonce=<nonce>, Signature=<base64>
+//
+// where the signature is the HMAC-SHA256, with the secret of the key, of the
+// method, the request URI, the timestamp, the nonce and the hex encoded
+// SHA-256 of the body, each followed by a newline.
+const HMACScheme = "HMAC-SHA256"
+
+// hmacSignature returns the signature of a request as described by
+// HMACScheme.
+func hmacSignature(secret []byte, method, uri string, timestamp int64, nonce string, body []byte) string {
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%d\n%s\n%s\n", method, uri, timestamp, nonce, hex.EncodeToString(sum[:]))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// hmacAuthorization returns the Authorization header of a signed request.
+func hmacAuthorization(keyID string, timestamp int64, nonce, signature string) string {
+	return fmt.Sprintf("%s KeyId=%s, Timestamp=%d, Nonce=%s, Signature=%s", HMACScheme, keyID, timestamp, nonce, signature)
+}
+
+// HMACKeyFunc returns the secret of the key keyID, and the Principal of the
+// callers holding it.
+type HMACKeyFunc func(ctx context.Context, keyID string) (secret []byte, p Principal, err error)
+
+// NonceStore records the nonces of signed requests, so that they can not be
+// replayed.
+type NonceStore interface {
+	// Remember records nonce for ttl, and reports whether it was not
+	// recorded already.
+	Remember(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+// HMACOption sets an optional parameter for HMACAuthenticator.
+type HMACOption func(*hmacAuthenticator)
+
+// HMACMaxSkew sets how far the timestamp of a request may be from the
+// current time. By default it is 5 minutes.
+func HMACMaxSkew(d time.Duration) HMACOption {
+	return func(a *hmacAuthenticator) { a.skew = d }
+}
+
+// HMACNonceStore sets the store nonces are recorded in. By default they are
+// recorded in memory, which is only suitable for a single instance.
+func HMACNonceStore(store NonceStore) HMACOption {
+	return func(a *hmacAuthenticator) { a.nonces = store }
+}
+
+// HMACAuthenticator returns a RequestFunc that authenticates requests signed
+// as described by HMACScheme, with secrets returned by keys. Requests with an
+// invalid signature, a timestamp out of the allowed skew or a nonce already
+// seen are aborted with a 401 StatusError. The body is read and replaced, so
+// that it can still be decoded.
+func HMACAuthenticator(keys HMACKeyFunc, options ...HMACOption) RequestFunc {
+	a := &hmacAuthenticator{keys: keys, skew: 5 * time.Minute}
+	for _, option := range options {
+		option(a)
+	}
+	if a.nonces == nil {
+		a.nonces = NewMemoryNonceStore()
+	}
+	return a.authenticate
+}
+
+type hmacAuthenticator struct {
+	keys   HMACKeyFunc
+	skew   time.Duration
+	nonces NonceStore
+}
+
+func (a *hmacAuthenticator) authenticate(ctx context.Context, gCtx *gin.Context) context.Context {
+	p, err := a.verify(ctx, gCtx, time.Now())
+	if errors.Is(err, ErrRequestBodyTooLarge) {
+		Abort(gCtx, ErrRequestBodyTooLarge)
+		return ctx
+	}
+	if err != nil {
+		Abort(gCtx, unauthorized(HMACScheme, err.Error()))
+		return ctx
+	}
+	return SetPrincipal(ctx, gCtx, p)
+}
+
+func (a *hmacAuthenticator) verify(ctx context.Context, gCtx *gin.Context, now time.Time) (Principal, error) {
+	params, ok := parseHMACAuthorization(gCtx.GetHeader("Authorization"))
+	if !ok {
+		return Principal{}, fmt.Errorf("missing request signature")
+	}
+	timestamp, err := strconv.ParseInt(params["Timestamp"], 10, 64)
+	if err != nil {
+		return Principal{}, fmt.Errorf("invalid signature timestamp")
+	}
+	if skew := now.Sub(time.Unix(timestamp, 0)); skew > a.skew || skew < -a.skew {
+		return Principal{}, fmt.Errorf("signature timestamp out of range")
+	}
+
+	secret, p, err := a.keys(ctx, params["KeyId"])
+	if err != nil {
+		return Principal{}, fmt.Errorf("unknown signing key")
+	}
+
+	var body []byte
+	if gCtx.Request.Body != nil {
+		if body, err = ioutil.ReadAll(gCtx.Request.Body); err != nil {
+			return Principal{}, err
+		}
+		gCtx.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	want := hmacSignature(secret, gCtx.Request.Method, gCtx.Request.URL.RequestURI(), timestamp, params["Nonce"], body)
+	if !hmac.Equal([]byte(want), []byte(params["Signature"])) {
+		return Principal{}, fmt.Errorf("invalid request signature")
+	}
+
+	// Nonces are only recorded once the signature is verified, so that
+	// forged requests can not burn the nonces of legitimate ones.
+	fresh, err := a.nonces.Remember(ctx, params["KeyId"]+" "+params["Nonce"], 2*a.skew)
+	if err != nil {
+		return Principal{}, err
+	}
+	if !fresh {
+		return Principal{}, fmt.Errorf("replayed request signature")
+	}
+
+	if p.Subject == "" {
+		p.Subject = params["KeyId"]
+	}
+	if p.Method == "" {
+		p.Method = "hmac"
+	}
+	return p, nil
+}
+
+func parseHMACAuthorization(auth string) (map[string]string, bool) {
+	if !strings.HasPrefix(auth, HMACScheme+" ") {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for _, part := range strings.Split(auth[len(HMACScheme)+1:], ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) == 2 {
+			params[kv[0]] = kv[1]
+		}
+	}
+	for _, k := range []string{"KeyId", "Timestamp", "Nonce", "Signature"} {
+		if params[k] == "" {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// NewMemoryNonceStore returns a NonceStore that records nonces in memory.
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{nonces: make(map[string]time.Time)}
+}
+
+type memoryNonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+	sweep  time.Time
+}
+
+func (s *memoryNonceStore) Remember(_ context.Context, nonce string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.After(s.sweep) {
+		for k, expires := range s.nonces {
+			if now.After(expires) {
+				delete(s.nonces, k)
+			}
+		}
+		s.sweep = now.Add(time.Minute)
+	}
+
+	if expires, ok := s.nonces[nonce]; ok && now.Before(expires) {
+		return false, nil
+	}
+	s.nonces[nonce] = now.Add(ttl)
+	return true, nil
+}
@@ -0,0 +1,275 @@
+package http
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// JWKS is a set of keys JWTs are verified with. HMAC keys are read from "oct"
+// keys, RSA keys from "RSA" keys and ECDSA keys from "EC" keys.
+type JWKS struct {
+	keys []jwksKey
+}
+
+type jwksKey struct {
+	kid string
+	alg string
+	key interface{}
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS parses a JSON Web Key Set as defined by RFC 7517. Keys whose use
+// is not "sig", and keys of other types, are ignored.
+func ParseJWKS(data []byte) (*JWKS, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	s := &JWKS{}
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("jwks: key %d: %v", i, err)
+		}
+		if key != nil {
+			s.keys = append(s.keys, jwksKey{kid: k.Kid, alg: k.Alg, key: key})
+		}
+	}
+	return s, nil
+}
+
+// LoadJWKSFile reads a JSON Web Key Set from the file at path.
+func LoadJWKSFile(path string) (*JWKS, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// NewSecretJWKS returns a JWKS holding a single HMAC secret.
+func NewSecretJWKS(secret []byte) *JWKS {
+	return &JWKS{keys: []jwksKey{{key: secret}}}
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "oct":
+		return decodeBase64URL(k.K)
+	case "RSA":
+		n, err := decodeBase64URL(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBase64URL(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBase64URL(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBase64URL(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("point is not on curve %s", k.Crv)
+		}
+		return key, nil
+	}
+	return nil, nil
+}
+
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// key returns the key a token signed with alg by the key kid is verified with.
+// Keys are only returned for algorithms of their type, so that a token can not
+// pass off an RSA public key as an HMAC secret.
+func (s *JWKS) key(kid, alg string) (interface{}, error) {
+	for _, k := range s.keys {
+		if kid != "" && k.kid != kid || k.alg != "" && k.alg != alg {
+			continue
+		}
+		switch k.key.(type) {
+		case []byte:
+			if strings.HasPrefix(alg, "HS") {
+				return k.key, nil
+			}
+		case *rsa.PublicKey:
+			if strings.HasPrefix(alg, "RS") {
+				return k.key, nil
+			}
+		case *ecdsa.PublicKey:
+			if strings.HasPrefix(alg, "ES") {
+				return k.key, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no key for kid %q and alg %q", kid, alg)
+}
+
+// JWTOption sets an optional parameter for JWTAuthenticator.
+type JWTOption func(*jwtAuthenticator)
+
+// JWTIssuer requires the iss claim of tokens to be issuer.
+func JWTIssuer(issuer string) JWTOption {
+	return func(a *jwtAuthenticator) { a.issuer = issuer }
+}
+
+// JWTAudience requires the aud claim of tokens to contain audience.
+func JWTAudience(audience string) JWTOption {
+	return func(a *jwtAuthenticator) { a.audience = audience }
+}
+
+// JWTLeeway sets the clock skew tolerated when checking the exp and nbf
+// claims of tokens. By default none is tolerated.
+func JWTLeeway(leeway time.Duration) JWTOption {
+	return func(a *jwtAuthenticator) { a.leeway = leeway }
+}
+
+// JWTAllowMissingExpiry accepts tokens without an exp claim, which then
+// never expire. By default they are rejected.
+func JWTAllowMissingExpiry() JWTOption {
+	return func(a *jwtAuthenticator) { a.allowMissingExpiry = true }
+}
+
+// JWTAuthenticator returns a RequestFunc that authenticates requests by the
+// JWT in their "Authorization: Bearer" header. Tokens must be signed with
+// HS256, HS384, HS512, RS256, RS384, RS512, ES256, ES384 or ES512 by a key of
+// keys, and must have an exp claim that has not passed. Requests without a
+// valid token are aborted with a 401 StatusError.
+//
+// The Principal of a request has the sub claim as Subject, the roles claim as
+// Roles, and the space separated scope claim, or the scp claim, as Scopes.
+func JWTAuthenticator(keys *JWKS, options ...JWTOption) RequestFunc {
+	a := &jwtAuthenticator{keys: keys}
+	for _, option := range options {
+		option(a)
+	}
+	a.parser = jwt.NewParser(
+		jwt.WithValidMethods([]string{"HS256", "HS384", "HS512", "RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithoutClaimsValidation(),
+	)
+	return a.authenticate
+}
+
+type jwtAuthenticator struct {
+	keys               *JWKS
+	parser             *jwt.Parser
+	issuer             string
+	audience           string
+	leeway             time.Duration
+	allowMissingExpiry bool
+}
+
+func (a *jwtAuthenticator) authenticate(ctx context.Context, gCtx *gin.Context) context.Context {
+	auth := gCtx.GetHeader("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		Abort(gCtx, unauthorized("Bearer", "missing bearer token"))
+		return ctx
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := a.parser.ParseWithClaims(strings.TrimSpace(auth[7:]), claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return a.keys.key(kid, t.Method.Alg())
+	})
+	if err == nil {
+		err = a.validate(claims, time.Now())
+	}
+	if err != nil {
+		Abort(gCtx, unauthorized(`Bearer error="invalid_token"`, "invalid bearer token: "+err.Error()))
+		return ctx
+	}
+
+	p := Principal{Method: "jwt", Claims: claims}
+	p.Subject, _ = claims["sub"].(string)
+	p.Roles = claimStrings(claims["roles"])
+	if scope, ok := claims["scope"].(string); ok {
+		p.Scopes = strings.Fields(scope)
+	} else {
+		p.Scopes = claimStrings(claims["scp"])
+	}
+	return SetPrincipal(ctx, gCtx, p)
+}
+
+func (a *jwtAuthenticator) validate(claims jwt.MapClaims, now time.Time) error {
+	if _, ok := claims["exp"]; !ok && !a.allowMissingExpiry {
+		return fmt.Errorf("token has no expiry")
+	}
+	if !claims.VerifyExpiresAt(now.Add(-a.leeway).Unix(), false) {
+		return fmt.Errorf("token is expired")
+	}
+	if !claims.VerifyNotBefore(now.Add(a.leeway).Unix(), false) {
+		return fmt.Errorf("token is not valid yet")
+	}
+	if a.issuer != "" && !claims.VerifyIssuer(a.issuer, true) {
+		return fmt.Errorf("unexpected issuer")
+	}
+	if a.audience != "" && !claims.VerifyAudience(a.audience, true) {
+		return fmt.Errorf("unexpected audience")
+	}
+	return nil
+}
+
+func claimStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		s := make([]string, 0, len(v))
+		for _, e := range v {
+			if e, ok := e.(string); ok {
+				s = append(s, e)
+			}
+		}
+		return s
+	}
+	return nil
+}
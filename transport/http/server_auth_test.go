@@ -0,0 +1,217 @@
+package http_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+type authRequest struct {
+	User string `ginkey:"KeyPrincipalSubject"`
+	Body string
+}
+
+func authServer(authenticator httptransport.RequestFunc) *httptest.Server {
+	handler := httptransport.NewServer(
+		func(ctx context.Context, request interface{}) (interface{}, error) {
+			p, _ := httptransport.PrincipalFromContext(ctx)
+			req := request.(*authRequest)
+			return map[string]interface{}{"user": req.User, "body": req.Body, "method": p.Method, "scopes": p.Scopes}, nil
+		},
+		func(_ context.Context, gCtx *gin.Context) (interface{}, error) {
+			req := &authRequest{}
+			if err := httptransport.BindGinKey(gCtx, req); err != nil {
+				return nil, err
+			}
+			b, err := ioutil.ReadAll(gCtx.Request.Body)
+			req.Body = string(b)
+			return req, err
+		},
+		httptransport.EncodeJSONResponse,
+		httptransport.ServerBefore(authenticator),
+	)
+	r := gin.New()
+	r.POST("/orders", handler.ServeHTTP)
+	return httptest.NewServer(r)
+}
+
+func postAuth(t *testing.T, url, body string, header http.Header) (*http.Response, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url+"/orders", strings.NewReader(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	buf, _ := ioutil.ReadAll(resp.Body)
+	return resp, string(buf)
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	secret := []byte("s3cret")
+
+	jwks := fmt.Sprintf(`{"keys":[
+		{"kty":"RSA","kid":"rsa","n":%q,"e":%q},
+		{"kty":"EC","kid":"ec","crv":"P-256","x":%q,"y":%q},
+		{"kty":"oct","kid":"hs","k":%q},
+		{"kty":"RSA","kid":"enc","use":"enc","n":"AQ","e":"AQAB"}
+	]}`, b64(rsaKey.N.Bytes()), b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+		b64(ecKey.X.Bytes()), b64(ecKey.Y.Bytes()), b64(secret))
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := ioutil.WriteFile(path, []byte(jwks), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := httptransport.LoadJWKSFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := authServer(httptransport.JWTAuthenticator(keys, httptransport.JWTIssuer("gink")))
+	defer server.Close()
+
+	sign := func(method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	valid := jwt.MapClaims{"sub": "alice", "iss": "gink", "scope": "read write", "exp": time.Now().Add(time.Hour).Unix()}
+
+	for _, tt := range []struct {
+		name, token string
+		code        int
+	}{
+		{"RS256", sign(jwt.SigningMethodRS256, "rsa", rsaKey, valid), http.StatusOK},
+		{"ES256", sign(jwt.SigningMethodES256, "ec", ecKey, valid), http.StatusOK},
+		{"HS256", sign(jwt.SigningMethodHS256, "hs", secret, valid), http.StatusOK},
+		{"missing", "", http.StatusUnauthorized},
+		{"expired", sign(jwt.SigningMethodHS256, "hs", secret, jwt.MapClaims{"sub": "alice", "iss": "gink", "exp": time.Now().Add(-time.Minute).Unix()}), http.StatusUnauthorized},
+		{"no expiry", sign(jwt.SigningMethodHS256, "hs", secret, jwt.MapClaims{"sub": "alice", "iss": "gink", "scope": "read write"}), http.StatusUnauthorized},
+		{"issuer", sign(jwt.SigningMethodHS256, "hs", secret, jwt.MapClaims{"sub": "alice", "iss": "other", "exp": time.Now().Add(time.Hour).Unix()}), http.StatusUnauthorized},
+		{"wrong key", sign(jwt.SigningMethodHS256, "hs", []byte("other"), valid), http.StatusUnauthorized},
+		{"alg confusion", sign(jwt.SigningMethodHS256, "rsa", []byte(b64(rsaKey.N.Bytes())), valid), http.StatusUnauthorized},
+		{"none", sign(jwt.SigningMethodNone, "hs", jwt.UnsafeAllowNoneSignatureType, valid), http.StatusUnauthorized},
+	} {
+		header := http.Header{}
+		if tt.token != "" {
+			header.Set("Authorization", "Bearer "+tt.token)
+		}
+		resp, body := postAuth(t, server.URL, "order", header)
+		if want, have := tt.code, resp.StatusCode; want != have {
+			t.Errorf("%s: want %d, have %d (%s)", tt.name, want, have, body)
+			continue
+		}
+		if tt.code == http.StatusOK {
+			if want, have := `{"body":"order","method":"jwt","scopes":["read","write"],"user":"alice"}`, body; want != have {
+				t.Errorf("%s: want %s, have %s", tt.name, want, have)
+			}
+		} else if resp.Header.Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: missing WWW-Authenticate header", tt.name)
+		}
+	}
+
+	lenient := authServer(httptransport.JWTAuthenticator(keys, httptransport.JWTAllowMissingExpiry()))
+	defer lenient.Close()
+	token := sign(jwt.SigningMethodHS256, "hs", secret, jwt.MapClaims{"sub": "alice", "scope": "read write"})
+	resp, body := postAuth(t, lenient.URL, "order", http.Header{"Authorization": {"Bearer " + token}})
+	if want, have := http.StatusOK, resp.StatusCode; want != have {
+		t.Errorf("no expiry allowed: want %d, have %d (%s)", want, have, body)
+	}
+}
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	server := authServer(httptransport.APIKeyAuthenticator(map[string]httptransport.Principal{
+		"k-123": {Subject: "billing"},
+	}))
+	defer server.Close()
+
+	_, body := postAuth(t, server.URL, "", http.Header{"X-Api-Key": {"k-123"}})
+	if want, have := `{"body":"","method":"apikey","scopes":null,"user":"billing"}`, body; want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+	for _, key := range []string{"", "k-12"} {
+		resp, _ := postAuth(t, server.URL, "", http.Header{"X-Api-Key": {key}})
+		if want, have := http.StatusUnauthorized, resp.StatusCode; want != have {
+			t.Errorf("%q: want %d, have %d", key, want, have)
+		}
+	}
+}
+
+func TestHMACAuthenticator(t *testing.T) {
+	secret := []byte("hmac-secret")
+	server := authServer(httptransport.HMACAuthenticator(func(_ context.Context, keyID string) ([]byte, httptransport.Principal, error) {
+		if keyID != "svc" {
+			return nil, httptransport.Principal{}, fmt.Errorf("unknown key %s", keyID)
+		}
+		return secret, httptransport.Principal{}, nil
+	}, httptransport.HMACMaxSkew(time.Minute)))
+	defer server.Close()
+
+	sign := func(keyID string, timestamp int64, nonce, body string) http.Header {
+		sum := sha256.Sum256([]byte(body))
+		mac := hmac.New(sha256.New, secret)
+		fmt.Fprintf(mac, "POST\n/orders\n%d\n%s\n%s\n", timestamp, nonce, hex.EncodeToString(sum[:]))
+		signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+		return http.Header{"Authorization": {fmt.Sprintf("HMAC-SHA256 KeyId=%s, Timestamp=%d, Nonce=%s, Signature=%s", keyID, timestamp, nonce, signature)}}
+	}
+	now := time.Now().Unix()
+
+	resp, body := postAuth(t, server.URL, "order", sign("svc", now, "n1", "order"))
+	if want, have := `{"body":"order","method":"hmac","scopes":null,"user":"svc"}`, body; want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		body   string
+		header http.Header
+	}{
+		{"replayed", "order", sign("svc", now, "n1", "order")},
+		{"tampered", "other", sign("svc", now, "n2", "order")},
+		{"stale", "order", sign("svc", now-120, "n3", "order")},
+		{"unknown key", "order", sign("other", now, "n4", "order")},
+		{"unsigned", "order", nil},
+	} {
+		resp, _ = postAuth(t, server.URL, tt.body, tt.header)
+		if want, have := http.StatusUnauthorized, resp.StatusCode; want != have {
+			t.Errorf("%s: want %d, have %d", tt.name, want, have)
+		}
+	}
+
+	// A tampered request does not burn the nonce of the legitimate one.
+	resp, _ = postAuth(t, server.URL, "order", sign("svc", now, "n2", "order"))
+	if want, have := http.StatusOK, resp.StatusCode; want != have {
+		t.Errorf("after tampered: want %d, have %d", want, have)
+	}
+}
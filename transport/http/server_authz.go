@@ -0,0 +1,126 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/kit/endpoint"
+)
+
+// AuthorizationRequest is the request a Policy decides on.
+type AuthorizationRequest struct {
+	// Principal is the caller populated by an authenticator, and
+	// Authenticated reports whether there was one.
+	Principal     Principal
+	Authenticated bool
+	// FullPath is the matched route of the request, such as "/users/:id".
+	FullPath string
+	// Request is the decoded request.
+	Request interface{}
+}
+
+// Policy decides whether a request may invoke the endpoint. A non-nil error
+// denies the request: a StatusError is encoded as is, and any other error is
+// encoded as a 403 StatusError with the error message as reason.
+type Policy func(ctx context.Context, r AuthorizationRequest) error
+
+// AuthorizationDecision records the decision on a request, so that
+// finalizers can audit it. It is populated in the context under
+// ContextKeyAuthorization by ServerAuthorize, and filled in once the request
+// has been decoded; Evaluated is false if the request was not decoded.
+type AuthorizationDecision struct {
+	Evaluated bool
+	Allowed   bool
+	Reason    string
+	Principal Principal
+	FullPath  string
+}
+
+// ServerAuthorize evaluates policies after a request is decoded and before
+// the endpoint is invoked. The request is allowed only if all policies allow
+// it; otherwise the endpoint is not invoked, and the error of the first
+// denying policy is passed to the error encoder.
+func ServerAuthorize(policies ...Policy) ServerOption {
+	return func(s *Server) {
+		s.interceptors = append(s.interceptors, populateAuthorizationDecision)
+		s.e = authorizationMiddleware(policies)(s.e)
+	}
+}
+
+func populateAuthorizationDecision(next handlerFunc) handlerFunc {
+	return func(ctx context.Context, gCtx *gin.Context) context.Context {
+		d := &AuthorizationDecision{FullPath: gCtx.FullPath()}
+		return next(context.WithValue(ctx, ContextKeyAuthorization, d), gCtx)
+	}
+}
+
+func authorizationMiddleware(policies []Policy) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			d, _ := ctx.Value(ContextKeyAuthorization).(*AuthorizationDecision)
+			if d == nil {
+				d = &AuthorizationDecision{}
+			}
+			r := AuthorizationRequest{FullPath: d.FullPath, Request: request}
+			r.Principal, r.Authenticated = PrincipalFromContext(ctx)
+
+			d.Evaluated, d.Principal = true, r.Principal
+			for _, policy := range policies {
+				if err := policy(ctx, r); err != nil {
+					d.Allowed, d.Reason = false, err.Error()
+					var se *StatusError
+					if !errors.As(err, &se) {
+						err = NewStatusError(http.StatusForbidden, err.Error())
+					}
+					return nil, err
+				}
+			}
+			d.Allowed = true
+			return next(ctx, request)
+		}
+	}
+}
+
+// RequireRole is a Policy that allows requests whose principal has at least
+// one of roles.
+func RequireRole(roles ...string) Policy {
+	return func(_ context.Context, r AuthorizationRequest) error {
+		if !r.Authenticated {
+			return errors.New("request is not authenticated")
+		}
+		for _, role := range roles {
+			if containsString(r.Principal.Roles, role) {
+				return nil
+			}
+		}
+		return errors.New("requires one of the roles " + strings.Join(roles, ", "))
+	}
+}
+
+// RequireScope is a Policy that allows requests whose principal has all of
+// scopes.
+func RequireScope(scopes ...string) Policy {
+	return func(_ context.Context, r AuthorizationRequest) error {
+		if !r.Authenticated {
+			return errors.New("request is not authenticated")
+		}
+		for _, scope := range scopes {
+			if !containsString(r.Principal.Scopes, scope) {
+				return errors.New("requires the scope " + scope)
+			}
+		}
+		return nil
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package http_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/gin-gonic/gin"
+)
+
+func TestServerAuthorize(t *testing.T) {
+	var (
+		called    int
+		decisions []httptransport.AuthorizationDecision
+	)
+	handler := httptransport.NewServer(
+		func(context.Context, interface{}) (interface{}, error) {
+			called++
+			return struct{}{}, nil
+		},
+		func(_ context.Context, gCtx *gin.Context) (interface{}, error) {
+			return gCtx.Param("owner"), nil
+		},
+		httptransport.EncodeJSONResponse,
+		httptransport.ServerBefore(httptransport.APIKeyAuthenticator(map[string]httptransport.Principal{
+			"admin": {Subject: "root", Roles: []string{"admin"}},
+			"alice": {Subject: "alice", Roles: []string{"user"}},
+			"bob":   {Subject: "bob", Roles: []string{"user"}},
+			"guest": {Subject: "guest"},
+		})),
+		httptransport.ServerAuthorize(
+			httptransport.RequireRole("user", "admin"),
+			func(_ context.Context, r httptransport.AuthorizationRequest) error {
+				if r.FullPath != "/accounts/:owner" {
+					return errors.New("unexpected route " + r.FullPath)
+				}
+				if r.Principal.Subject != r.Request.(string) && r.Principal.Subject != "root" {
+					return errors.New("not the owner")
+				}
+				return nil
+			},
+		),
+		httptransport.ServerFinalizer(func(ctx context.Context, _ int, _ *gin.Context) {
+			if d, ok := ctx.Value(httptransport.ContextKeyAuthorization).(*httptransport.AuthorizationDecision); ok {
+				decisions = append(decisions, *d)
+			}
+		}),
+	)
+	r := gin.New()
+	r.GET("/accounts/:owner", handler.ServeHTTP)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	for _, tt := range []struct {
+		key    string
+		code   int
+		reason string
+	}{
+		{"alice", http.StatusOK, ""},
+		{"admin", http.StatusOK, ""},
+		{"bob", http.StatusForbidden, "not the owner"},
+		{"guest", http.StatusForbidden, "requires one of the roles user, admin"},
+		{"", http.StatusUnauthorized, ""},
+	} {
+		decisions = nil
+		resp, _ := getWithHeader(t, server.URL+"/accounts/alice", "X-Api-Key", tt.key)
+		if want, have := tt.code, resp.StatusCode; want != have {
+			t.Errorf("%q: want %d, have %d", tt.key, want, have)
+		}
+		if tt.code == http.StatusUnauthorized {
+			if len(decisions) != 0 {
+				t.Errorf("%q: unauthenticated request was evaluated", tt.key)
+			}
+			continue
+		}
+		if want, have := 1, len(decisions); want != have {
+			t.Errorf("%q: decisions: want %d, have %d", tt.key, want, have)
+			continue
+		}
+		d := decisions[0]
+		if want, have := tt.code == http.StatusOK, d.Allowed; want != have {
+			t.Errorf("%q: Allowed: want %v, have %v", tt.key, want, have)
+		}
+		if want, have := tt.reason, d.Reason; want != have {
+			t.Errorf("%q: Reason: want %q, have %q", tt.key, want, have)
+		}
+		if want, have := tt.key, d.Principal.Subject; tt.key != "admin" && want != have {
+			t.Errorf("%q: Principal: want %q, have %q", tt.key, want, have)
+		}
+	}
+	if want, have := 2, called; want != have {
+		t.Errorf("endpoint calls: want %d, have %d", want, have)
+	}
+}
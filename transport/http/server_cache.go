@@ -0,0 +1,444 @@
+package http
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Cacheable is checked by the cache installed with ServerCache. If a response
+// implements Cacheable and returns false, it is not stored and is sent with
+// Cache-Control: no-store.
+type Cacheable interface {
+	Cacheable() bool
+}
+
+// CachedResponse is an encoded response kept in a CacheStore.
+type CachedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+
+	// StoredAt is when the response was encoded. It is fresh until Expires
+	// and may be served while it is revalidated until StaleUntil.
+	StoredAt   time.Time
+	Expires    time.Time
+	StaleUntil time.Time
+}
+
+// CacheStore stores encoded responses for ServerCache. Get returns nil and no
+// error when key is not stored. A store may evict entries at any time, but
+// should not return them once ttl has passed since they were set.
+type CacheStore interface {
+	Get(ctx context.Context, key string) (*CachedResponse, error)
+	Set(ctx context.Context, key string, resp *CachedResponse, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// CacheOption sets an optional parameter for ServerCache.
+type CacheOption func(*responseCache)
+
+// CacheStaleWhileRevalidate allows an expired response to be served for up to
+// d longer, while a single request refreshes it in the background.
+func CacheStaleWhileRevalidate(d time.Duration) CacheOption {
+	return func(c *responseCache) { c.swr = d }
+}
+
+// CacheKeyQuery adds the values of the given query parameters to the cache
+// key. By default the query string is not part of the key.
+func CacheKeyQuery(names ...string) CacheOption {
+	return func(c *responseCache) { c.query = append(c.query, names...) }
+}
+
+// CacheKeyHeaders adds the values of the given request headers to the cache
+// key, and lists them in the Vary header of cached responses.
+func CacheKeyHeaders(names ...string) CacheOption {
+	return func(c *responseCache) {
+		for _, name := range names {
+			c.headers = append(c.headers, http.CanonicalHeaderKey(name))
+		}
+	}
+}
+
+// CachePerPrincipal caches the responses of requests from authenticated
+// callers, keyed by their Principal, and sends them with Cache-Control:
+// private. Cached responses are served without invoking the endpoint, so
+// its middlewares, including the policies of ServerAuthorize, are only
+// applied to misses; they must not depend on more of the request than its
+// key. Requests sending credentials without a Principal populated in their
+// context are still not cached.
+func CachePerPrincipal() CacheOption {
+	return func(c *responseCache) { c.perPrincipal = true }
+}
+
+// ServerCache caches the encoded responses of GET and HEAD requests in store
+// for ttl. Responses are keyed by method, route (the KeyRequestFullPath gin
+// key, or the route of the request when it has not been populated), path
+// parameters and the query parameters and headers selected with CacheKeyQuery
+// and CacheKeyHeaders.
+//
+// Only 200 responses written by the response encoder are stored; errors,
+// responses implementing Cacheable that return false, and responses that set
+// cookies or a private or no-store Cache-Control header are not. Stored
+// responses get a Cache-Control max-age header unless they set their own.
+// Concurrent misses for the same key are collapsed, so the endpoint is
+// invoked once and the other requests are answered from its response.
+// Requests sent with Cache-Control: no-cache skip the lookup and refresh the
+// stored response.
+//
+// Requests with an Authorization or Cookie header, or a Principal populated
+// by an authenticator, are neither looked up nor stored, unless
+// CachePerPrincipal is given, since their responses may be specific to the
+// caller.
+func ServerCache(store CacheStore, ttl time.Duration, options ...CacheOption) ServerOption {
+	return func(s *Server) {
+		c := &responseCache{
+			server:  s,
+			store:   store,
+			ttl:     ttl,
+			flights: make(map[string]*cacheFlight),
+		}
+		for _, option := range options {
+			option(c)
+		}
+		s.enc = c.encoder(s.enc)
+		s.interceptors = append(s.interceptors, c.intercept)
+	}
+}
+
+type responseCache struct {
+	server  *Server
+	store   CacheStore
+	ttl     time.Duration
+	swr     time.Duration
+	query   []string
+	headers []string
+
+	perPrincipal bool
+
+	mu      sync.Mutex
+	flights map[string]*cacheFlight
+}
+
+// cacheFlight is a request refreshing a key. Requests for the same key wait
+// until done is closed and then use resp, if it could be stored.
+type cacheFlight struct {
+	done chan struct{}
+	resp *CachedResponse
+}
+
+type cacheRecordKey struct{}
+
+// cacheRecord is filled by the cache encoder with the response to store.
+// It is private for responses keyed by Principal.
+type cacheRecord struct {
+	resp    *CachedResponse
+	private bool
+}
+
+func (c *responseCache) intercept(next handlerFunc) handlerFunc {
+	return func(ctx context.Context, gCtx *gin.Context) context.Context {
+		method := gCtx.Request.Method
+		if method != http.MethodGet && method != http.MethodHead {
+			return next(ctx, gCtx)
+		}
+
+		p, authenticated := PrincipalFromContext(ctx)
+		credentials := gCtx.GetHeader("Authorization") != "" || gCtx.GetHeader("Cookie") != ""
+		if (authenticated || credentials) && !(c.perPrincipal && authenticated) {
+			return next(ctx, gCtx)
+		}
+		key := c.key(gCtx)
+		if authenticated {
+			key += " principal=" + url.QueryEscape(p.Method) + ":" + url.QueryEscape(p.Subject)
+		}
+		if !strings.Contains(gCtx.GetHeader("Cache-Control"), "no-cache") {
+			resp, err := c.store.Get(ctx, key)
+			if err != nil {
+				c.server.errorHandler.Handle(ctx, err)
+			}
+			if resp != nil {
+				now := time.Now()
+				if now.Before(resp.Expires) {
+					c.write(gCtx, resp)
+					return ctx
+				}
+				if now.Before(resp.StaleUntil) {
+					c.write(gCtx, resp)
+					c.revalidate(ctx, gCtx, key, authenticated, next)
+					return ctx
+				}
+			}
+		}
+
+		flight, leader := c.join(key)
+		if !leader {
+			select {
+			case <-flight.done:
+			case <-ctx.Done():
+				return next(ctx, gCtx)
+			}
+			if flight.resp == nil {
+				return next(ctx, gCtx)
+			}
+			c.write(gCtx, flight.resp)
+			return ctx
+		}
+
+		defer c.leave(key, flight)
+		rec := &cacheRecord{private: authenticated}
+		ctx = next(context.WithValue(ctx, cacheRecordKey{}, rec), gCtx)
+		flight.resp = c.set(ctx, key, rec)
+		return ctx
+	}
+}
+
+// revalidate refreshes a stale key in the background, unless a request is
+// already refreshing it.
+func (c *responseCache) revalidate(ctx context.Context, gCtx *gin.Context, key string, private bool, next handlerFunc) {
+	flight, leader := c.join(key)
+	if !leader {
+		return
+	}
+
+	cp := gCtx.Copy()
+	ctx = detachedContext{ctx}
+	cp.Request = gCtx.Request.WithContext(ctx)
+	cp.Writer = newDetachedWriter()
+
+	go func() {
+		defer c.leave(key, flight)
+		rec := &cacheRecord{private: private}
+		ctx := next(context.WithValue(ctx, cacheRecordKey{}, rec), cp)
+		flight.resp = c.set(ctx, key, rec)
+	}()
+}
+
+func (c *responseCache) join(key string) (*cacheFlight, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if flight, ok := c.flights[key]; ok {
+		return flight, false
+	}
+	flight := &cacheFlight{done: make(chan struct{})}
+	c.flights[key] = flight
+	return flight, true
+}
+
+func (c *responseCache) leave(key string, flight *cacheFlight) {
+	c.mu.Lock()
+	delete(c.flights, key)
+	c.mu.Unlock()
+	close(flight.done)
+}
+
+func (c *responseCache) set(ctx context.Context, key string, rec *cacheRecord) *CachedResponse {
+	if rec.resp == nil {
+		return nil
+	}
+	if err := c.store.Set(ctx, key, rec.resp, rec.resp.StaleUntil.Sub(rec.resp.StoredAt)); err != nil {
+		c.server.errorHandler.Handle(ctx, err)
+	}
+	return rec.resp
+}
+
+// write answers a request with a cached response. Headers already set on the
+// response, by ServerBefore functions for instance, are kept.
+func (c *responseCache) write(gCtx *gin.Context, resp *CachedResponse) {
+	h := gCtx.Writer.Header()
+	for k, v := range resp.Header {
+		if _, ok := h[k]; !ok {
+			h[k] = v
+		}
+	}
+	h.Set("Age", strconv.Itoa(int(time.Since(resp.StoredAt)/time.Second)))
+
+	if etag := resp.Header.Get("ETag"); etag != "" || resp.Header.Get("Last-Modified") != "" {
+		lastModified, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+		if notModified(gCtx.Request, etag, lastModified) {
+			h.Del("Content-Type")
+			h.Del("Content-Length")
+			gCtx.Writer.WriteHeader(http.StatusNotModified)
+			gCtx.Writer.WriteHeaderNow()
+			return
+		}
+	}
+
+	gCtx.Writer.WriteHeader(resp.StatusCode)
+	gCtx.Writer.WriteHeaderNow()
+	gCtx.Writer.Write(resp.Body)
+}
+
+func (c *responseCache) encoder(enc EncodeResponseFunc) EncodeResponseFunc {
+	return func(ctx context.Context, gCtx *gin.Context, response interface{}) error {
+		rec, ok := ctx.Value(cacheRecordKey{}).(*cacheRecord)
+		if !ok {
+			return enc(ctx, gCtx, response)
+		}
+		if cc, ok := response.(Cacheable); ok && !cc.Cacheable() {
+			if gCtx.Writer.Header().Get("Cache-Control") == "" {
+				gCtx.Header("Cache-Control", "no-store")
+			}
+			return enc(ctx, gCtx, response)
+		}
+
+		bw := newBufferingWriter(gCtx.Writer)
+		gCtx.Writer = bw
+		err := enc(ctx, gCtx, response)
+		gCtx.Writer = bw.ResponseWriter
+		if err != nil {
+			return err
+		}
+
+		h := gCtx.Writer.Header()
+		cacheControl := h.Get("Cache-Control")
+		private := strings.Contains(cacheControl, "private")
+		if bw.code != http.StatusOK || h.Get("Set-Cookie") != "" ||
+			strings.Contains(cacheControl, "no-store") || (private && !rec.private) {
+			return bw.flush()
+		}
+		if cacheControl == "" {
+			cacheControl = fmt.Sprintf("max-age=%d", int(c.ttl/time.Second))
+			if c.swr > 0 {
+				cacheControl += fmt.Sprintf(", stale-while-revalidate=%d", int(c.swr/time.Second))
+			}
+		}
+		if rec.private && !private {
+			cacheControl = "private, " + cacheControl
+		}
+		h.Set("Cache-Control", cacheControl)
+		for _, name := range c.headers {
+			h.Add("Vary", name)
+		}
+
+		now := time.Now()
+		rec.resp = &CachedResponse{
+			StatusCode: bw.code,
+			Header:     h.Clone(),
+			Body:       append([]byte(nil), bw.buf.Bytes()...),
+			StoredAt:   now,
+			Expires:    now.Add(c.ttl),
+			StaleUntil: now.Add(c.ttl + c.swr),
+		}
+		return bw.flush()
+	}
+}
+
+func (c *responseCache) key(gCtx *gin.Context) string {
+	route := gCtx.GetString(KeyRequestFullPath)
+	if route == "" {
+		route = gCtx.FullPath()
+	}
+	if route == "" {
+		route = gCtx.Request.URL.Path
+	}
+
+	var b strings.Builder
+	b.WriteString(gCtx.Request.Method)
+	b.WriteByte(' ')
+	b.WriteString(route)
+
+	for _, p := range gCtx.Params {
+		b.WriteByte(' ')
+		b.WriteString(url.QueryEscape(p.Key))
+		b.WriteByte('=')
+		b.WriteString(url.QueryEscape(p.Value))
+	}
+
+	query := gCtx.Request.URL.Query()
+	selected := url.Values{}
+	for _, name := range c.query {
+		if v, ok := query[name]; ok {
+			selected[name] = v
+		}
+	}
+	if len(selected) > 0 {
+		b.WriteString(" ?")
+		b.WriteString(selected.Encode())
+	}
+
+	for _, name := range c.headers {
+		b.WriteByte(' ')
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(url.QueryEscape(strings.Join(gCtx.Request.Header.Values(name), ",")))
+	}
+	return b.String()
+}
+
+// NewLRUCacheStore returns an in-memory CacheStore holding at most capacity
+// responses, evicting the least recently used ones first.
+func NewLRUCacheStore(capacity int) CacheStore {
+	return &lruCacheStore{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+type lruCacheStore struct {
+	capacity int
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type lruCacheEntry struct {
+	key     string
+	resp    *CachedResponse
+	expires time.Time
+}
+
+func (s *lruCacheStore) Get(_ context.Context, key string) (*CachedResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.items[key]
+	if !ok {
+		return nil, nil
+	}
+	entry := el.Value.(*lruCacheEntry)
+	if time.Now().After(entry.expires) {
+		s.ll.Remove(el)
+		delete(s.items, key)
+		return nil, nil
+	}
+	s.ll.MoveToFront(el)
+	return entry.resp, nil
+}
+
+func (s *lruCacheStore) Set(_ context.Context, key string, resp *CachedResponse, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := &lruCacheEntry{key: key, resp: resp, expires: time.Now().Add(ttl)}
+	if el, ok := s.items[key]; ok {
+		el.Value = entry
+		s.ll.MoveToFront(el)
+		return nil
+	}
+	s.items[key] = s.ll.PushFront(entry)
+	for s.capacity > 0 && s.ll.Len() > s.capacity {
+		el := s.ll.Back()
+		s.ll.Remove(el)
+		delete(s.items, el.Value.(*lruCacheEntry).key)
+	}
+	return nil
+}
+
+func (s *lruCacheStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[key]; ok {
+		s.ll.Remove(el)
+		delete(s.items, key)
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package http_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/gin-gonic/gin"
+)
+
+type uncacheableResponse struct{}
+
+func (uncacheableResponse) Cacheable() bool { return false }
+
+func cacheServer(e func(context.Context, interface{}) (interface{}, error), ttl time.Duration, options ...httptransport.CacheOption) *httptest.Server {
+	handler := httptransport.NewServer(
+		e,
+		func(context.Context, *gin.Context) (interface{}, error) { return struct{}{}, nil },
+		httptransport.EncodeJSONResponse,
+		httptransport.ServerCache(httptransport.NewLRUCacheStore(16), ttl, options...),
+	)
+	r := gin.New()
+	r.GET("/items/:id", handler.ServeHTTP)
+	return httptest.NewServer(r)
+}
+
+func TestServerCache(t *testing.T) {
+	var calls int32
+	server := cacheServer(func(context.Context, interface{}) (interface{}, error) {
+		return map[string]int32{"n": atomic.AddInt32(&calls, 1)}, nil
+	}, time.Minute, httptransport.CacheKeyQuery("page"))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		path, body string
+	}{
+		{"/items/1", `{"n":1}`},
+		{"/items/1", `{"n":1}`},
+		{"/items/1?other=x", `{"n":1}`},
+		{"/items/2", `{"n":2}`},
+		{"/items/1?page=2", `{"n":3}`},
+		{"/items/1?page=2", `{"n":3}`},
+	} {
+		resp, body := getWithHeader(t, server.URL+tt.path, "", "")
+		if want, have := tt.body, body; want != have {
+			t.Errorf("%s: want %s, have %s", tt.path, want, have)
+		}
+		if want, have := "max-age=60", resp.Header.Get("Cache-Control"); want != have {
+			t.Errorf("%s: Cache-Control: want %q, have %q", tt.path, want, have)
+		}
+	}
+
+	resp, body := getWithHeader(t, server.URL+"/items/1", "Cache-Control", "no-cache")
+	if want, have := `{"n":4}`, body; want != have {
+		t.Errorf("no-cache: want %s, have %s", want, have)
+	}
+	if resp.Header.Get("Age") != "" {
+		t.Errorf("no-cache: want no Age header, have %q", resp.Header.Get("Age"))
+	}
+	resp, body = getWithHeader(t, server.URL+"/items/1", "", "")
+	if want, have := `{"n":4}`, body; want != have {
+		t.Errorf("refreshed: want %s, have %s", want, have)
+	}
+	if want, have := "0", resp.Header.Get("Age"); want != have {
+		t.Errorf("Age: want %q, have %q", want, have)
+	}
+}
+
+func TestServerCacheAuthenticated(t *testing.T) {
+	newServer := func(options ...httptransport.CacheOption) *httptest.Server {
+		var calls int32
+		handler := httptransport.NewServer(
+			func(ctx context.Context, _ interface{}) (interface{}, error) {
+				p, _ := httptransport.PrincipalFromContext(ctx)
+				return map[string]interface{}{"user": p.Subject, "n": atomic.AddInt32(&calls, 1)}, nil
+			},
+			func(context.Context, *gin.Context) (interface{}, error) { return struct{}{}, nil },
+			httptransport.EncodeJSONResponse,
+			httptransport.ServerBefore(func(ctx context.Context, gCtx *gin.Context) context.Context {
+				if token := gCtx.GetHeader("Authorization"); token != "" {
+					return httptransport.SetPrincipal(ctx, gCtx, httptransport.Principal{Subject: token, Method: "test"})
+				}
+				return ctx
+			}),
+			httptransport.ServerCache(httptransport.NewLRUCacheStore(16), time.Minute, options...),
+		)
+		r := gin.New()
+		r.GET("/items/:id", handler.ServeHTTP)
+		return httptest.NewServer(r)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		options []httptransport.CacheOption
+		steps   []struct{ header, value, body, cacheControl string }
+	}{
+		{
+			name: "default",
+			steps: []struct{ header, value, body, cacheControl string }{
+				{"Authorization", "a", `{"n":1,"user":"a"}`, ""},
+				{"Authorization", "b", `{"n":2,"user":"b"}`, ""},
+				{"Authorization", "a", `{"n":3,"user":"a"}`, ""},
+				{"Cookie", "session=a", `{"n":4,"user":""}`, ""},
+				{"", "", `{"n":5,"user":""}`, "max-age=60"},
+				{"", "", `{"n":5,"user":""}`, "max-age=60"},
+			},
+		},
+		{
+			name:    "per principal",
+			options: []httptransport.CacheOption{httptransport.CachePerPrincipal()},
+			steps: []struct{ header, value, body, cacheControl string }{
+				{"Authorization", "a", `{"n":1,"user":"a"}`, "private, max-age=60"},
+				{"Authorization", "b", `{"n":2,"user":"b"}`, "private, max-age=60"},
+				{"Authorization", "a", `{"n":1,"user":"a"}`, "private, max-age=60"},
+				{"Authorization", "b", `{"n":2,"user":"b"}`, "private, max-age=60"},
+				{"", "", `{"n":3,"user":""}`, "max-age=60"},
+				{"", "", `{"n":3,"user":""}`, "max-age=60"},
+			},
+		},
+	} {
+		server := newServer(tt.options...)
+		for i, step := range tt.steps {
+			resp, body := getWithHeader(t, server.URL+"/items/1", step.header, step.value)
+			if want, have := step.body, body; want != have {
+				t.Errorf("%s %d: want %s, have %s", tt.name, i, want, have)
+			}
+			if want, have := step.cacheControl, resp.Header.Get("Cache-Control"); want != have {
+				t.Errorf("%s %d: Cache-Control: want %q, have %q", tt.name, i, want, have)
+			}
+		}
+		server.Close()
+	}
+}
+
+func TestServerCacheOptOut(t *testing.T) {
+	var calls int32
+	server := cacheServer(func(context.Context, interface{}) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return uncacheableResponse{}, nil
+	}, time.Minute)
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		resp, _ := getWithHeader(t, server.URL+"/items/1", "", "")
+		if want, have := "no-store", resp.Header.Get("Cache-Control"); want != have {
+			t.Errorf("Cache-Control: want %q, have %q", want, have)
+		}
+	}
+	if want, have := int32(2), atomic.LoadInt32(&calls); want != have {
+		t.Errorf("calls: want %d, have %d", want, have)
+	}
+}
+
+func TestServerCacheCollapsesMisses(t *testing.T) {
+	var (
+		calls   int32
+		entered = make(chan struct{}, 1)
+		release = make(chan struct{})
+	)
+	server := cacheServer(func(context.Context, interface{}) (interface{}, error) {
+		entered <- struct{}{}
+		<-release
+		return map[string]int32{"n": atomic.AddInt32(&calls, 1)}, nil
+	}, time.Minute)
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 5)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := http.Get(server.URL + "/items/1")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer resp.Body.Close()
+			buf, _ := ioutil.ReadAll(resp.Body)
+			bodies[i] = string(buf)
+		}(i)
+	}
+	<-entered
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if want, have := int32(1), atomic.LoadInt32(&calls); want != have {
+		t.Errorf("calls: want %d, have %d", want, have)
+	}
+	for i, body := range bodies {
+		if want, have := `{"n":1}`, body; want != have {
+			t.Errorf("request %d: want %s, have %s", i, want, have)
+		}
+	}
+}
+
+func TestServerCacheStaleWhileRevalidate(t *testing.T) {
+	var calls int32
+	refreshed := make(chan struct{}, 1)
+	server := cacheServer(func(context.Context, interface{}) (interface{}, error) {
+		n := atomic.AddInt32(&calls, 1)
+		if n > 1 {
+			select {
+			case refreshed <- struct{}{}:
+			default:
+			}
+		}
+		return map[string]int32{"n": n}, nil
+	}, 10*time.Millisecond, httptransport.CacheStaleWhileRevalidate(time.Minute))
+	defer server.Close()
+
+	getWithHeader(t, server.URL+"/items/1", "", "")
+	time.Sleep(20 * time.Millisecond)
+
+	resp, body := getWithHeader(t, server.URL+"/items/1", "", "")
+	if want, have := `{"n":1}`, body; want != have {
+		t.Errorf("stale: want %s, have %s", want, have)
+	}
+	if want, have := "max-age=0, stale-while-revalidate=60", resp.Header.Get("Cache-Control"); want != have {
+		t.Errorf("Cache-Control: want %q, have %q", want, have)
+	}
+
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for revalidation")
+	}
+	for i := 0; i < 100; i++ {
+		if _, body = getWithHeader(t, server.URL+"/items/1", "", ""); body != `{"n":1}` {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Errorf("revalidated: want a refreshed body, have %s", body)
+}
+
+func TestLRUCacheStore(t *testing.T) {
+	ctx := context.Background()
+	store := httptransport.NewLRUCacheStore(2)
+	for i := 0; i < 3; i++ {
+		store.Set(ctx, fmt.Sprint(i), &httptransport.CachedResponse{StatusCode: i}, time.Minute)
+		if i == 1 {
+			store.Get(ctx, "0")
+		}
+	}
+	if resp, _ := store.Get(ctx, "1"); resp != nil {
+		t.Error("least recently used entry was not evicted")
+	}
+	if resp, _ := store.Get(ctx, "0"); resp == nil {
+		t.Error("recently used entry was evicted")
+	}
+
+	store.Set(ctx, "x", &httptransport.CachedResponse{}, -time.Second)
+	if resp, _ := store.Get(ctx, "x"); resp != nil {
+		t.Error("expired entry was returned")
+	}
+}
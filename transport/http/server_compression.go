@@ -0,0 +1,307 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CompressionOption sets an optional parameter for ServerCompression.
+type CompressionOption func(*compression)
+
+// CompressionMinSize sets the size from which responses are compressed.
+// By default responses of 1024 bytes or more are compressed.
+func CompressionMinSize(n int) CompressionOption {
+	return func(c *compression) { c.minSize = n }
+}
+
+// CompressionEncodings sets the content codings responses may be compressed
+// with, among "zstd", "gzip" and "deflate", in order of preference. The
+// preference breaks ties between codings the client accepts with the same
+// quality. By default all are used, in that order.
+func CompressionEncodings(encodings ...string) CompressionOption {
+	return func(c *compression) { c.encodings = encodings }
+}
+
+// ServerCompression compresses responses with the best content coding the
+// Accept-Encoding header of the request accepts. Responses smaller than the
+// minimum size, without a body, already encoded, or of media types that are
+// compressed already, such as images, are sent as is. Compressed responses
+// lose their Content-Length, and their strong ETag is made weak, since the
+// compressed body is not byte-for-byte the one it was computed on.
+//
+// The compressing writer wraps the writer of finalizers, so that
+// ContextKeyResponseSize holds the compressed size. Responses are compressed
+// after the other options have seen them, whatever order they are given in:
+// options storing responses, such as ServerCache and ServerIdempotency, store
+// them uncompressed, and the responses they replay are compressed for the
+// request they answer.
+func ServerCompression(options ...CompressionOption) ServerOption {
+	return func(s *Server) {
+		c := &compression{
+			server:    s,
+			minSize:   1024,
+			encodings: []string{"zstd", "gzip", "deflate"},
+		}
+		for _, option := range options {
+			option(c)
+		}
+		s.interceptors = append([]interceptor{c.intercept}, s.interceptors...)
+	}
+}
+
+type compression struct {
+	server    *Server
+	minSize   int
+	encodings []string
+}
+
+func (c *compression) intercept(next handlerFunc) handlerFunc {
+	return func(ctx context.Context, gCtx *gin.Context) context.Context {
+		w := &compressWriter{
+			ResponseWriter: gCtx.Writer,
+			config:         c,
+			header:         gCtx.Writer.Header().Clone(),
+			code:           gCtx.Writer.Status(),
+			encoding:       c.negotiate(gCtx.GetHeader("Accept-Encoding")),
+			head:           gCtx.Request.Method == http.MethodHead,
+		}
+		gCtx.Writer = w
+		defer func() { gCtx.Writer = w.ResponseWriter }()
+
+		ctx = next(ctx, gCtx)
+		if err := w.Close(); err != nil {
+			c.server.errorHandler.Handle(ctx, err)
+		}
+		return ctx
+	}
+}
+
+// negotiate returns the coding of c with the highest quality in accept, or
+// "" if accept accepts none.
+func (c *compression) negotiate(accept string) string {
+	if accept == "" {
+		return ""
+	}
+	qualities, wildcard := make(map[string]float64), -1.0
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		name, q := strings.ToLower(strings.TrimSpace(params[0])), 1.0
+		for _, param := range params[1:] {
+			if param = strings.TrimSpace(param); strings.HasPrefix(param, "q=") {
+				var err error
+				if q, err = strconv.ParseFloat(param[2:], 64); err != nil {
+					q = 0
+				}
+			}
+		}
+		if name == "*" {
+			wildcard = q
+		} else {
+			qualities[name] = q
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range c.encodings {
+		q, ok := qualities[encoding]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compressWriter holds back the response until it is known whether it is
+// large enough to be compressed. The writers it wraps see the response as
+// sent to the client, while the writers wrapping it see the uncompressed
+// response, including its headers.
+type compressWriter struct {
+	gin.ResponseWriter
+	config   *compression
+	header   http.Header
+	code     int
+	encoding string
+	head     bool
+
+	buf       bytes.Buffer
+	headerNow bool
+	decided   bool
+	enc       compressor
+}
+
+func (w *compressWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if code > 0 && !w.decided {
+		w.code = code
+	}
+}
+
+func (w *compressWriter) WriteHeaderNow() {
+	w.headerNow = true
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.decided {
+		if w.enc != nil {
+			return w.enc.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+	w.buf.Write(p)
+	if w.buf.Len() >= w.config.minSize {
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *compressWriter) Status() int {
+	if !w.decided {
+		return w.code
+	}
+	return w.ResponseWriter.Status()
+}
+
+func (w *compressWriter) Written() bool {
+	return w.decided || w.headerNow || w.buf.Len() > 0
+}
+
+// Flush sends what has been written so far, so that streamed responses are
+// not held back.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide()
+	}
+	if w.enc != nil {
+		w.enc.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Close sends the rest of the response.
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		if err := w.decide(); err != nil {
+			return err
+		}
+	}
+	if w.enc == nil {
+		return nil
+	}
+	err := w.enc.Close()
+	putCompressor(w.encoding, w.enc)
+	w.enc = nil
+	return err
+}
+
+// decide copies the headers to the wrapped writer, compressing the response
+// if it is eligible and has reached the minimum size, and sends what has
+// been written so far.
+func (w *compressWriter) decide() error {
+	w.decided = true
+	h := w.ResponseWriter.Header()
+	for k := range h {
+		if _, ok := w.header[k]; !ok {
+			delete(h, k)
+		}
+	}
+	for k, v := range w.header {
+		h[k] = v
+	}
+
+	if w.eligible() {
+		h.Add("Vary", "Accept-Encoding")
+		if w.encoding != "" && w.buf.Len() >= w.config.minSize {
+			h.Set("Content-Encoding", w.encoding)
+			h.Del("Content-Length")
+			if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+				h.Set("ETag", "W/"+etag)
+			}
+			w.enc = getCompressor(w.encoding, w.ResponseWriter)
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(w.code)
+	if w.buf.Len() == 0 {
+		if w.headerNow {
+			w.ResponseWriter.WriteHeaderNow()
+		}
+		return nil
+	}
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+	return err
+}
+
+// eligible reports whether the response may be compressed.
+func (w *compressWriter) eligible() bool {
+	if w.head || w.code < http.StatusOK || w.code == http.StatusNoContent || w.code == http.StatusNotModified {
+		return false
+	}
+	if w.header.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := strings.ToLower(w.header.Get("Content-Type"))
+	if strings.HasPrefix(contentType, "image/svg") {
+		return true
+	}
+	for _, prefix := range []string{"image/", "video/", "audio/", "application/zip", "application/gzip", "application/x-gzip", "application/zstd"} {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// ServerDecompression decodes request bodies sent with a gzip, deflate or
+// zstd Content-Encoding before they are decoded. Reads of more than maxBytes
+// of decoded body fail with ErrRequestBodyTooLarge, as do zstd bodies whose
+// window is larger than maxBytes, so that small compressed bodies can not
+// expand into huge ones. Requests with another
+// Content-Encoding are aborted with ErrUnsupportedContentEncoding.
+func ServerDecompression(maxBytes int64) ServerOption {
+	return func(s *Server) {
+		s.before = append(s.before, func(ctx context.Context, gCtx *gin.Context) context.Context {
+			r := gCtx.Request
+			encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+			if encoding == "" || encoding == "identity" || r.Body == nil || r.Body == http.NoBody {
+				return ctx
+			}
+			body, err := newDecompressor(encoding, r.Body, maxBytes)
+			if err != nil {
+				Abort(gCtx, NewStatusError(http.StatusBadRequest, "invalid "+encoding+" body: "+err.Error()))
+				return ctx
+			}
+			if body == nil {
+				Abort(gCtx, ErrUnsupportedContentEncoding)
+				return ctx
+			}
+			r.Body = &limitedBody{ReadCloser: body, n: maxBytes}
+			r.ContentLength = -1
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			return ctx
+		})
+	}
+}
@@ -0,0 +1,353 @@
+package http_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/gin-gonic/gin"
+	"github.com/go-resty/resty/v2"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestServerCompression(t *testing.T) {
+	var (
+		body = strings.Repeat("compressible ", 200)
+		size int64
+	)
+	handler := httptransport.NewServer(
+		func(_ context.Context, request interface{}) (interface{}, error) { return request, nil },
+		func(_ context.Context, gCtx *gin.Context) (interface{}, error) { return gCtx.Query("body"), nil },
+		func(_ context.Context, gCtx *gin.Context, response interface{}) error {
+			gCtx.Header("ETag", `"v1"`)
+			gCtx.String(http.StatusOK, response.(string))
+			return nil
+		},
+		httptransport.ServerCompression(httptransport.CompressionMinSize(100)),
+		httptransport.ServerFinalizer(func(ctx context.Context, code int, gCtx *gin.Context) {
+			size = ctx.Value(httptransport.ContextKeyResponseSize).(int64)
+		}),
+	)
+	r := gin.New()
+	r.GET("/", handler.ServeHTTP)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	get := func(accept, body string) (*http.Response, []byte) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/?body="+body, nil)
+		// Setting the header stops the transport from decoding the response.
+		req.Header.Set("Accept-Encoding", accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return resp, b
+	}
+
+	for _, tt := range []struct {
+		accept, encoding string
+	}{
+		{"gzip", "gzip"},
+		{"gzip, deflate, zstd", "zstd"},
+		{"gzip;q=1, zstd;q=0.5", "gzip"},
+		{"deflate, *;q=0.1", "deflate"},
+		{"*", "zstd"},
+		{"zstd;q=0, *", "gzip"},
+		{"br", ""},
+		{"identity", ""},
+	} {
+		resp, b := get(tt.accept, strings.Replace(body, " ", "+", -1))
+		if want, have := tt.encoding, resp.Header.Get("Content-Encoding"); want != have {
+			t.Errorf("%q: Content-Encoding: want %q, have %q", tt.accept, want, have)
+		}
+		if want, have := "Accept-Encoding", resp.Header.Get("Vary"); want != have {
+			t.Errorf("%q: Vary: want %q, have %q", tt.accept, want, have)
+		}
+		if want, have := int64(len(b)), size; want != have {
+			t.Errorf("%q: finalizer size: want %d, have %d", tt.accept, want, have)
+		}
+		if tt.encoding == "" {
+			if want, have := `"v1"`, resp.Header.Get("ETag"); want != have {
+				t.Errorf("%q: ETag: want %s, have %s", tt.accept, want, have)
+			}
+			continue
+		}
+		if want, have := `W/"v1"`, resp.Header.Get("ETag"); want != have {
+			t.Errorf("%q: ETag: want %s, have %s", tt.accept, want, have)
+		}
+		if want, have := int64(len(b)), resp.ContentLength; have != -1 && want != have {
+			t.Errorf("%q: Content-Length: want %d, have %d", tt.accept, want, have)
+		}
+		if len(b) >= len(body) {
+			t.Errorf("%q: %d compressed bytes for %d", tt.accept, len(b), len(body))
+		}
+	}
+
+	resp, b := get("gzip", "small")
+	if want, have := "", resp.Header.Get("Content-Encoding"); want != have {
+		t.Errorf("small: Content-Encoding: want %q, have %q", want, have)
+	}
+	if want, have := "small", string(b); want != have {
+		t.Errorf("small: want %q, have %q", want, have)
+	}
+
+	// The transport decodes the responses it asked to be compressed.
+	resp, err := http.Get(server.URL + "/?body=" + strings.Replace(body, " ", "+", -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !resp.Uncompressed || string(b) != body {
+		t.Errorf("transparent decoding: uncompressed %v, %d bytes", resp.Uncompressed, len(b))
+	}
+}
+
+func TestServerCompressionStoredResponses(t *testing.T) {
+	var (
+		body  = strings.Repeat("compressible ", 200)
+		calls int32
+	)
+	endpoint := func(context.Context, interface{}) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return body, nil
+	}
+	encode := func(_ context.Context, gCtx *gin.Context, response interface{}) error {
+		gCtx.String(http.StatusOK, response.(string))
+		return nil
+	}
+	// The options storing responses are given before ServerCompression.
+	payments := httptransport.NewServer(endpoint, httptransport.NopRequestDecoder, encode,
+		httptransport.ServerIdempotency(httptransport.NewMemoryIdempotencyStore()),
+		httptransport.ServerCompression(httptransport.CompressionMinSize(100)),
+	)
+	items := httptransport.NewServer(endpoint, httptransport.NopRequestDecoder, encode,
+		httptransport.ServerCache(httptransport.NewLRUCacheStore(16), time.Minute),
+		httptransport.ServerCompression(httptransport.CompressionMinSize(100)),
+	)
+	r := gin.New()
+	r.POST("/payments", payments.ServeHTTP)
+	r.GET("/items", items.ServeHTTP)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	do := func(method, path, accept string) (*http.Response, string) {
+		req, _ := http.NewRequest(method, server.URL+path, nil)
+		req.Header.Set("Idempotency-Key", "k")
+		// Setting the header stops the transport from decoding the response.
+		req.Header.Set("Accept-Encoding", accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var reader io.Reader = resp.Body
+		if resp.Header.Get("Content-Encoding") == "gzip" {
+			if reader, err = gzip.NewReader(resp.Body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		b, _ := ioutil.ReadAll(reader)
+		return resp, string(b)
+	}
+
+	for _, path := range []struct{ method, path string }{
+		{http.MethodPost, "/payments"},
+		{http.MethodGet, "/items"},
+	} {
+		atomic.StoreInt32(&calls, 0)
+		for _, tt := range []struct{ accept, encoding string }{
+			{"gzip", "gzip"},
+			{"identity", ""},
+			{"gzip", "gzip"},
+		} {
+			resp, b := do(path.method, path.path, tt.accept)
+			if want, have := tt.encoding, resp.Header.Get("Content-Encoding"); want != have {
+				t.Errorf("%s %q: Content-Encoding: want %q, have %q", path.path, tt.accept, want, have)
+			}
+			if b != body {
+				t.Errorf("%s %q: want %d bytes of body, have %q", path.path, tt.accept, len(body), b)
+			}
+		}
+		if want, have := int32(1), atomic.LoadInt32(&calls); want != have {
+			t.Errorf("%s: calls: want %d, have %d", path.path, want, have)
+		}
+	}
+}
+
+func TestServerCompressionSkipsEncodedTypes(t *testing.T) {
+	handler := httptransport.NewServer(
+		func(context.Context, interface{}) (interface{}, error) { return nil, nil },
+		httptransport.NopRequestDecoder,
+		func(_ context.Context, gCtx *gin.Context, _ interface{}) error {
+			gCtx.Data(http.StatusOK, gCtx.Query("type"), bytes.Repeat([]byte{'x'}, 2048))
+			return nil
+		},
+		httptransport.ServerCompression(),
+	)
+	r := gin.New()
+	r.GET("/", handler.ServeHTTP)
+	r.HEAD("/", handler.ServeHTTP)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	for contentType, want := range map[string]string{
+		"image/png":              "",
+		"application/zip":        "",
+		"image/svg+xml":          "zstd",
+		"application/json":       "zstd",
+		"text/html;charset=utf8": "zstd",
+	} {
+		resp := getWithEncoding(t, http.MethodGet, server.URL+"/?type="+contentType)
+		if have := resp.Header.Get("Content-Encoding"); want != have {
+			t.Errorf("%s: want %q, have %q", contentType, want, have)
+		}
+	}
+	resp := getWithEncoding(t, http.MethodHead, server.URL+"/?type=text/plain")
+	if have := resp.Header.Get("Content-Encoding"); have != "" {
+		t.Errorf("HEAD: want no Content-Encoding, have %q", have)
+	}
+}
+
+func getWithEncoding(t *testing.T, method, url string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, nil)
+	req.Header.Set("Accept-Encoding", "zstd, gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestServerDecompression(t *testing.T) {
+	handler := httptransport.NewServer(
+		func(_ context.Context, request interface{}) (interface{}, error) { return request, nil },
+		func(_ context.Context, gCtx *gin.Context) (interface{}, error) {
+			return ioutil.ReadAll(gCtx.Request.Body)
+		},
+		func(_ context.Context, gCtx *gin.Context, response interface{}) error {
+			gCtx.Data(http.StatusOK, "text/plain", response.([]byte))
+			return nil
+		},
+		httptransport.ServerDecompression(1024),
+	)
+	r := gin.New()
+	r.POST("/", handler.ServeHTTP)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	gzipped := func(s string) []byte {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write([]byte(s))
+		w.Close()
+		return buf.Bytes()
+	}
+	zstded := func(s string) []byte {
+		w, _ := zstd.NewWriter(nil)
+		defer w.Close()
+		return w.EncodeAll([]byte(s), nil)
+	}
+	// Streamed frames declare their window rather than their size: set the
+	// window descriptor, after the magic number and the frame header
+	// descriptor, to 1<<(10+exponent) bytes.
+	zstdWindow := func(s string, exponent byte) []byte {
+		var buf bytes.Buffer
+		w, _ := zstd.NewWriter(&buf)
+		w.Write([]byte(s))
+		w.Close()
+		b := buf.Bytes()
+		b[5] = exponent << 3
+		return b
+	}
+	bomb := strings.Repeat("0", 1<<20)
+
+	for _, tt := range []struct {
+		name     string
+		encoding string
+		body     []byte
+		code     int
+		want     string
+	}{
+		{"plain", "", []byte("hello"), http.StatusOK, "hello"},
+		{"gzip", "gzip", gzipped("hello"), http.StatusOK, "hello"},
+		{"zstd", "zstd", zstded("hello"), http.StatusOK, "hello"},
+		{"gzip bomb", "gzip", gzipped(bomb), http.StatusRequestEntityTooLarge, ""},
+		{"zstd bomb", "zstd", zstded(bomb), http.StatusRequestEntityTooLarge, ""},
+		{"zstd small window", "zstd", zstdWindow("hello", 0), http.StatusOK, "hello"},
+		{"zstd large window", "zstd", zstdWindow("hello", 13), http.StatusRequestEntityTooLarge, ""},
+		{"invalid", "gzip", []byte("hello"), http.StatusBadRequest, ""},
+		{"unsupported", "br", []byte("hello"), http.StatusUnsupportedMediaType, ""},
+	} {
+		req, _ := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader(tt.body))
+		if tt.encoding != "" {
+			req.Header.Set("Content-Encoding", tt.encoding)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if want, have := tt.code, resp.StatusCode; want != have {
+			t.Errorf("%s: want %d, have %d", tt.name, want, have)
+		}
+		if tt.want != "" && tt.want != string(b) {
+			t.Errorf("%s: want %q, have %q", tt.name, tt.want, b)
+		}
+	}
+}
+
+func TestClientCompression(t *testing.T) {
+	handler := httptransport.NewServer(
+		func(_ context.Context, request interface{}) (interface{}, error) { return request, nil },
+		func(_ context.Context, gCtx *gin.Context) (interface{}, error) {
+			if want, have := "", gCtx.GetHeader("Content-Encoding"); want != have {
+				t.Errorf("Content-Encoding left after decoding: %q", have)
+			}
+			b, err := ioutil.ReadAll(gCtx.Request.Body)
+			return string(b), err
+		},
+		func(_ context.Context, gCtx *gin.Context, response interface{}) error {
+			gCtx.String(http.StatusOK, response.(string))
+			return nil
+		},
+		httptransport.ServerDecompression(1<<20),
+		httptransport.ServerBefore(func(ctx context.Context, gCtx *gin.Context) context.Context {
+			if want, have := "gzip", gCtx.GetHeader("X-Sent-Encoding"); want != have {
+				t.Errorf("X-Sent-Encoding: want %q, have %q", want, have)
+			}
+			return ctx
+		}),
+	)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Request.Header.Set("X-Sent-Encoding", c.GetHeader("Content-Encoding"))
+	})
+	r.POST("/", handler.ServeHTTP)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	client := httptransport.NewClient(resty.New(), httptransport.WithClientHost(server.URL), httptransport.WithClientCompression("gzip"))
+	var body string
+	e := client.Endpoint(httptransport.Req(http.MethodPost, "/"), httptransport.EncodeJSONRequest, httptransport.DecodeJSONResponse(&body))
+	if _, err := e(context.Background(), strings.Repeat("a", 4096)); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := strings.Repeat("a", 4096), body; want != have {
+		t.Errorf("want %d bytes, have %d", len(want), len(have))
+	}
+}
@@ -0,0 +1,227 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORSPolicy describes the cross-origin requests browsers may send.
+type CORSPolicy struct {
+	// AllowedOrigins are the origins allowed to send requests, such as
+	// "https://example.com". A pattern such as "https://*.example.com"
+	// allows every subdomain of example.com, but not example.com itself.
+	// "*" allows any origin, unless AllowCredentials is set: credentialed
+	// requests must be allowed by an explicit origin or pattern.
+	AllowedOrigins []string
+	// AllowedMethods are the methods allowed in requests. By default GET,
+	// HEAD and POST are allowed.
+	AllowedMethods []string
+	// AllowedHeaders are the headers allowed in requests, besides the
+	// CORS-safelisted ones. "*" allows any header.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers scripts may read, besides the
+	// CORS-safelisted ones.
+	ExposedHeaders []string
+	// AllowCredentials allows requests with cookies or HTTP authentication.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache the result of a preflight.
+	MaxAge time.Duration
+}
+
+// ServerCORS applies p to the requests of the Server, before any other
+// ServerBefore function, so that preflights are answered before credentials
+// are checked. Errors are encoded with the CORS headers of the request, so
+// that scripts can read them. Use CORSRoutes to route preflights to the
+// Server.
+func ServerCORS(p CORSPolicy) ServerOption {
+	return func(s *Server) {
+		s.cors = &p
+		s.before = append([]RequestFunc{CORS(p)}, s.before...)
+	}
+}
+
+// CORS returns a RequestFunc that applies p. Preflight requests are answered
+// with 204 and the methods and headers p allows, or aborted with a 403
+// StatusError if p does not allow them; mount the Server on OPTIONS as well
+// for preflights to reach it. Other requests from allowed origins are served
+// with an Access-Control-Allow-Origin header.
+func CORS(p CORSPolicy) RequestFunc {
+	if len(p.AllowedMethods) == 0 {
+		p.AllowedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+	return func(ctx context.Context, gCtx *gin.Context) context.Context {
+		origin := gCtx.GetHeader("Origin")
+		header := gCtx.Writer.Header()
+		header.Add("Vary", "Origin")
+		if origin == "" {
+			return ctx
+		}
+		allowed, wildcard := p.allowOrigin(origin)
+		if allowed {
+			if wildcard {
+				header.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				header.Set("Access-Control-Allow-Origin", origin)
+			}
+			if p.AllowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		method := gCtx.GetHeader("Access-Control-Request-Method")
+		if gCtx.Request.Method != http.MethodOptions || method == "" {
+			if allowed && len(p.ExposedHeaders) > 0 {
+				header.Set("Access-Control-Expose-Headers", strings.Join(p.ExposedHeaders, ", "))
+			}
+			return ctx
+		}
+
+		if !allowed {
+			Abort(gCtx, NewStatusError(http.StatusForbidden, "origin not allowed"))
+			return ctx
+		}
+		if !containsFold(p.AllowedMethods, method) {
+			Abort(gCtx, NewStatusError(http.StatusForbidden, "method not allowed"))
+			return ctx
+		}
+		var requested []string
+		for _, h := range strings.Split(gCtx.GetHeader("Access-Control-Request-Headers"), ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				requested = append(requested, h)
+			}
+		}
+		for _, h := range requested {
+			if !containsFold(p.AllowedHeaders, "*") && !containsFold(p.AllowedHeaders, h) {
+				Abort(gCtx, NewStatusError(http.StatusForbidden, "header "+h+" not allowed"))
+				return ctx
+			}
+		}
+
+		header.Set("Access-Control-Allow-Methods", strings.Join(p.AllowedMethods, ", "))
+		if containsFold(p.AllowedHeaders, "*") {
+			// A literal "*" is not honoured for credentialed requests, so the
+			// requested headers are allowed by name.
+			if len(requested) > 0 {
+				header.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+			}
+		} else if len(p.AllowedHeaders) > 0 {
+			header.Set("Access-Control-Allow-Headers", strings.Join(p.AllowedHeaders, ", "))
+		}
+		if p.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+		}
+		gCtx.Status(http.StatusNoContent)
+		gCtx.Writer.WriteHeaderNow()
+		gCtx.Abort()
+		return ctx
+	}
+}
+
+// allowOrigin reports whether origin is allowed, and whether it is allowed
+// only because any origin is.
+func (p CORSPolicy) allowOrigin(origin string) (allowed, wildcard bool) {
+	for _, pattern := range p.AllowedOrigins {
+		if pattern != "*" && matchOrigin(pattern, origin) {
+			return true, false
+		}
+	}
+	if !p.AllowCredentials && containsFold(p.AllowedOrigins, "*") {
+		return true, true
+	}
+	return false, false
+}
+
+// matchOrigin reports whether origin matches pattern, which may hold a "*"
+// standing for one or more subdomain labels.
+func matchOrigin(pattern, origin string) bool {
+	i := strings.Index(pattern, "*")
+	if i < 0 {
+		return strings.EqualFold(pattern, origin)
+	}
+	prefix, suffix := strings.ToLower(pattern[:i]), strings.ToLower(pattern[i+1:])
+	origin = strings.ToLower(origin)
+	if len(origin) <= len(prefix)+len(suffix) || !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+	sub := origin[len(prefix) : len(origin)-len(suffix)]
+	if strings.HasPrefix(sub, ".") || strings.HasSuffix(sub, ".") || strings.Contains(sub, "..") {
+		return false
+	}
+	for _, c := range sub {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(list []string, s string) bool {
+	for _, e := range list {
+		if strings.EqualFold(e, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// CORSRoutes registers Servers on a gin route group, and answers the OPTIONS
+// requests to their paths. A preflight is served by the Server registered for
+// the method it requests, so that each Server applies its own CORSPolicy.
+type CORSRoutes struct {
+	routes  gin.IRoutes
+	servers map[string]map[string]*Server
+}
+
+// NewCORSRoutes returns CORSRoutes registering routes on routes, such as a
+// *gin.RouterGroup.
+func NewCORSRoutes(routes gin.IRoutes) *CORSRoutes {
+	return &CORSRoutes{routes: routes, servers: make(map[string]map[string]*Server)}
+}
+
+// Handle registers s for requests with method to relativePath.
+func (r *CORSRoutes) Handle(method, relativePath string, s *Server) *CORSRoutes {
+	servers, ok := r.servers[relativePath]
+	if !ok {
+		servers = make(map[string]*Server)
+		r.servers[relativePath] = servers
+		r.routes.OPTIONS(relativePath, func(gCtx *gin.Context) { r.options(gCtx, servers) })
+	}
+	servers[method] = s
+	if method != http.MethodOptions {
+		r.routes.Handle(method, relativePath, s.ServeHTTP)
+	}
+	return r
+}
+
+func (r *CORSRoutes) options(gCtx *gin.Context, servers map[string]*Server) {
+	method := gCtx.GetHeader("Access-Control-Request-Method")
+	if method == "" || gCtx.GetHeader("Origin") == "" {
+		if s, ok := servers[http.MethodOptions]; ok {
+			s.ServeHTTP(gCtx)
+			return
+		}
+		allow := []string{http.MethodOptions}
+		for m := range servers {
+			if m != http.MethodOptions {
+				allow = append(allow, m)
+			}
+		}
+		sort.Strings(allow)
+		gCtx.Header("Allow", strings.Join(allow, ", "))
+		gCtx.Status(http.StatusNoContent)
+		return
+	}
+
+	s, ok := servers[method]
+	if !ok || s.cors == nil {
+		DefaultErrorEncoder(gCtx.Request.Context(), NewStatusError(http.StatusForbidden, "method not allowed"), gCtx)
+		return
+	}
+	s.ServeHTTP(gCtx)
+}
@@ -0,0 +1,214 @@
+package http_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/gin-gonic/gin"
+)
+
+func corsRequest(t *testing.T, method, url string, header http.Header) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, nil)
+	req.Header = header
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestCORS(t *testing.T) {
+	var called int
+	handler := httptransport.NewServer(
+		func(context.Context, interface{}) (interface{}, error) { called++; return struct{}{}, nil },
+		httptransport.NopRequestDecoder,
+		httptransport.EncodeJSONResponse,
+		httptransport.ServerBefore(httptransport.CORS(httptransport.CORSPolicy{
+			AllowedOrigins: []string{"https://app.example.com"},
+			AllowedMethods: []string{http.MethodGet, http.MethodPut},
+			AllowedHeaders: []string{"Content-Type", "X-Tenant"},
+			MaxAge:         10 * time.Minute,
+		})),
+	)
+	r := gin.New()
+	r.Handle(http.MethodOptions, "/", handler.ServeHTTP)
+	r.PUT("/", handler.ServeHTTP)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	resp := corsRequest(t, http.MethodOptions, server.URL, http.Header{
+		"Origin":                         {"https://app.example.com"},
+		"Access-Control-Request-Method":  {"PUT"},
+		"Access-Control-Request-Headers": {"content-type, x-tenant"},
+	})
+	if want, have := http.StatusNoContent, resp.StatusCode; want != have {
+		t.Errorf("preflight: want %d, have %d", want, have)
+	}
+	for k, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Methods":     "GET, PUT",
+		"Access-Control-Allow-Headers":     "Content-Type, X-Tenant",
+		"Access-Control-Max-Age":           "600",
+		"Access-Control-Allow-Credentials": "",
+		"Vary":                             "Origin",
+	} {
+		if have := resp.Header.Get(k); want != have {
+			t.Errorf("preflight: %s: want %q, have %q", k, want, have)
+		}
+	}
+	if called != 0 {
+		t.Errorf("preflight invoked the endpoint")
+	}
+
+	for _, header := range []http.Header{
+		{"Origin": {"https://evil.example.com"}, "Access-Control-Request-Method": {"PUT"}},
+		{"Origin": {"https://app.example.com"}, "Access-Control-Request-Method": {"DELETE"}},
+		{"Origin": {"https://app.example.com"}, "Access-Control-Request-Method": {"PUT"}, "Access-Control-Request-Headers": {"X-Admin"}},
+	} {
+		if resp := corsRequest(t, http.MethodOptions, server.URL, header); resp.StatusCode != http.StatusForbidden {
+			t.Errorf("%v: want %d, have %d", header, http.StatusForbidden, resp.StatusCode)
+		}
+	}
+
+	resp = corsRequest(t, http.MethodPut, server.URL, http.Header{"Origin": {"https://app.example.com"}})
+	if want, have := "https://app.example.com", resp.Header.Get("Access-Control-Allow-Origin"); want != have {
+		t.Errorf("actual request: want %q, have %q", want, have)
+	}
+	resp = corsRequest(t, http.MethodPut, server.URL, http.Header{"Origin": {"https://evil.example.com"}})
+	if have := resp.Header.Get("Access-Control-Allow-Origin"); have != "" {
+		t.Errorf("disallowed origin: want no header, have %q", have)
+	}
+	if want, have := 2, called; want != have {
+		t.Errorf("endpoint calls: want %d, have %d", want, have)
+	}
+}
+
+func TestCORSOrigins(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		policy      httptransport.CORSPolicy
+		origin      string
+		allowOrigin string
+	}{
+		{"any", httptransport.CORSPolicy{AllowedOrigins: []string{"*"}}, "https://a.test", "*"},
+		{"subdomain", httptransport.CORSPolicy{AllowedOrigins: []string{"https://*.example.com"}}, "https://a.b.example.com", "https://a.b.example.com"},
+		{"subdomain case", httptransport.CORSPolicy{AllowedOrigins: []string{"https://*.example.com"}}, "https://App.Example.com", "https://App.Example.com"},
+		{"apex", httptransport.CORSPolicy{AllowedOrigins: []string{"https://*.example.com"}}, "https://example.com", ""},
+		{"scheme", httptransport.CORSPolicy{AllowedOrigins: []string{"https://*.example.com"}}, "http://a.example.com", ""},
+		{"suffix", httptransport.CORSPolicy{AllowedOrigins: []string{"https://*.example.com"}}, "https://a.example.com.evil.test", ""},
+		{"lookalike", httptransport.CORSPolicy{AllowedOrigins: []string{"https://*.example.com"}}, "https://evilexample.com", ""},
+		{"port", httptransport.CORSPolicy{AllowedOrigins: []string{"https://*.example.com"}}, "https://a.example.com:8443", ""},
+		{"userinfo", httptransport.CORSPolicy{AllowedOrigins: []string{"https://*.example.com"}}, "https://x@a.example.com", ""},
+		{"credentialed any", httptransport.CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}, "https://a.test", ""},
+		{"credentialed null", httptransport.CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}, "null", ""},
+		{"credentialed subdomain", httptransport.CORSPolicy{AllowedOrigins: []string{"*", "https://*.example.com"}, AllowCredentials: true}, "https://a.example.com", "https://a.example.com"},
+	} {
+		handler := httptransport.NewServer(
+			func(context.Context, interface{}) (interface{}, error) { return struct{}{}, nil },
+			httptransport.NopRequestDecoder,
+			httptransport.EncodeJSONResponse,
+			httptransport.ServerCORS(tt.policy),
+		)
+		r := gin.New()
+		httptransport.NewCORSRoutes(r).Handle(http.MethodGet, "/", handler)
+		server := httptest.NewServer(r)
+
+		resp := corsRequest(t, http.MethodGet, server.URL, http.Header{"Origin": {tt.origin}})
+		if want, have := tt.allowOrigin, resp.Header.Get("Access-Control-Allow-Origin"); want != have {
+			t.Errorf("%s: Access-Control-Allow-Origin: want %q, have %q", tt.name, want, have)
+		}
+		credentials := tt.policy.AllowCredentials && tt.allowOrigin != ""
+		if want, have := credentials, resp.Header.Get("Access-Control-Allow-Credentials") == "true"; want != have {
+			t.Errorf("%s: Access-Control-Allow-Credentials: want %v, have %v", tt.name, want, have)
+		}
+
+		resp = corsRequest(t, http.MethodOptions, server.URL, http.Header{"Origin": {tt.origin}, "Access-Control-Request-Method": {"GET"}})
+		want := http.StatusNoContent
+		if tt.allowOrigin == "" {
+			want = http.StatusForbidden
+		}
+		if have := resp.StatusCode; want != have {
+			t.Errorf("%s: preflight: want %d, have %d", tt.name, want, have)
+		}
+		server.Close()
+	}
+}
+
+func TestCORSRoutes(t *testing.T) {
+	newServer := func(p httptransport.CORSPolicy, options ...httptransport.ServerOption) *httptransport.Server {
+		return httptransport.NewServer(
+			func(context.Context, interface{}) (interface{}, error) { return struct{}{}, nil },
+			httptransport.NopRequestDecoder,
+			httptransport.EncodeJSONResponse,
+			append(options, httptransport.ServerCORS(p))...,
+		)
+	}
+	public := newServer(httptransport.CORSPolicy{AllowedOrigins: []string{"*"}})
+	private := newServer(httptransport.CORSPolicy{
+		AllowedOrigins:   []string{"https://*.example.com"},
+		AllowedMethods:   []string{http.MethodPut},
+		AllowedHeaders:   []string{"*"},
+		ExposedHeaders:   []string{"X-Request-Id"},
+		AllowCredentials: true,
+	}, httptransport.ServerBefore(httptransport.APIKeyAuthenticator(map[string]httptransport.Principal{"k": {}})))
+
+	r := gin.New()
+	httptransport.NewCORSRoutes(r.Group("/api")).
+		Handle(http.MethodGet, "/items/:id", public).
+		Handle(http.MethodPut, "/items/:id", private)
+	server := httptest.NewServer(r)
+	defer server.Close()
+	url := server.URL + "/api/items/1"
+
+	// The preflight of PUT is answered by the private Server, although it
+	// carries no API key.
+	resp := corsRequest(t, http.MethodOptions, url, http.Header{
+		"Origin":                         {"https://app.example.com"},
+		"Access-Control-Request-Method":  {"PUT"},
+		"Access-Control-Request-Headers": {"X-Api-Key"},
+	})
+	if want, have := http.StatusNoContent, resp.StatusCode; want != have {
+		t.Errorf("PUT preflight: want %d, have %d", want, have)
+	}
+	for k, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "PUT",
+		"Access-Control-Allow-Headers":     "X-Api-Key",
+	} {
+		if have := resp.Header.Get(k); want != have {
+			t.Errorf("PUT preflight: %s: want %q, have %q", k, want, have)
+		}
+	}
+
+	resp = corsRequest(t, http.MethodOptions, url, http.Header{"Origin": {"https://a.test"}, "Access-Control-Request-Method": {"GET"}})
+	if want, have := "*", resp.Header.Get("Access-Control-Allow-Origin"); want != have {
+		t.Errorf("GET preflight: want %q, have %q", want, have)
+	}
+	resp = corsRequest(t, http.MethodOptions, url, http.Header{"Origin": {"https://a.test"}, "Access-Control-Request-Method": {"DELETE"}})
+	if want, have := http.StatusForbidden, resp.StatusCode; want != have {
+		t.Errorf("DELETE preflight: want %d, have %d", want, have)
+	}
+	resp = corsRequest(t, http.MethodOptions, url, nil)
+	if want, have := "GET, OPTIONS, PUT", resp.Header.Get("Allow"); want != have {
+		t.Errorf("OPTIONS: Allow: want %q, have %q", want, have)
+	}
+
+	// Errors carry the CORS headers, so that scripts can read them.
+	resp = corsRequest(t, http.MethodPut, url, http.Header{"Origin": {"https://app.example.com"}})
+	if want, have := http.StatusUnauthorized, resp.StatusCode; want != have {
+		t.Errorf("PUT: want %d, have %d", want, have)
+	}
+	if want, have := "https://app.example.com", resp.Header.Get("Access-Control-Allow-Origin"); want != have {
+		t.Errorf("PUT: Access-Control-Allow-Origin: want %q, have %q", want, have)
+	}
+	if want, have := "X-Request-Id", resp.Header.Get("Access-Control-Expose-Headers"); want != have {
+		t.Errorf("PUT: Access-Control-Expose-Headers: want %q, have %q", want, have)
+	}
+}
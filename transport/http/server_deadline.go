@@ -0,0 +1,82 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/kit/endpoint"
+)
+
+// ServerDeadline derives the context of requests from the deadline their
+// caller propagated in the TimeoutHeader, such as Clients with
+// WithClientDeadlinePropagation, so that calls cascading across services
+// give up together. The deadline is capped at max from the start of the
+// request, which is also used for requests without the header; a max of 0
+// leaves propagated deadlines uncapped and other requests without one.
+//
+// Requests whose deadline has already passed, including those propagating a
+// timeout of 0, are answered with ErrDeadlineExceeded without being decoded,
+// and endpoint errors caused by the deadline are replaced with it. The
+// context is derived after the ServerBefore functions, since its timer must
+// be released once the request is served; it applies to decoding, the
+// endpoint and encoding.
+func ServerDeadline(max time.Duration) ServerOption {
+	return func(s *Server) {
+		d := &deadline{server: s, max: max}
+		s.interceptors = append(s.interceptors, d.intercept)
+		s.e = deadlineMiddleware(s.e)
+	}
+}
+
+type deadline struct {
+	server *Server
+	max    time.Duration
+}
+
+func (d *deadline) intercept(next handlerFunc) handlerFunc {
+	return func(ctx context.Context, gCtx *gin.Context) context.Context {
+		timeout := d.max
+		if v := gCtx.GetHeader(TimeoutHeader); v != "" {
+			propagated, err := decodeTimeout(v)
+			switch {
+			case err != nil:
+				d.server.errorHandler.Handle(ctx, err)
+			case propagated <= 0:
+				// The caller has already given up.
+				return d.expired(ctx, gCtx)
+			case timeout <= 0 || propagated < timeout:
+				timeout = propagated
+			}
+		}
+		// Only requests without a propagated deadline, served with a max of
+		// 0, are served without a deadline.
+		if timeout <= 0 {
+			return next(ctx, gCtx)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		if ctx.Err() != nil {
+			return d.expired(ctx, gCtx)
+		}
+		return next(ctx, gCtx)
+	}
+}
+
+func (d *deadline) expired(ctx context.Context, gCtx *gin.Context) context.Context {
+	d.server.errorHandler.Handle(ctx, ErrDeadlineExceeded)
+	d.server.errorEncoder(ctx, ErrDeadlineExceeded, gCtx)
+	return ctx
+}
+
+func deadlineMiddleware(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		response, err := next(ctx, request)
+		if err != nil && errors.Is(err, context.DeadlineExceeded) && ctx.Err() == context.DeadlineExceeded {
+			return nil, ErrDeadlineExceeded
+		}
+		return response, err
+	}
+}
@@ -0,0 +1,186 @@
+package http_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/gin-gonic/gin"
+	"github.com/go-resty/resty/v2"
+)
+
+func TestServerDeadline(t *testing.T) {
+	var (
+		header    string
+		remaining time.Duration
+		hasDL     bool
+	)
+	newServer := func(max time.Duration) *httptransport.Server {
+		return httptransport.NewServer(
+			func(ctx context.Context, request interface{}) (interface{}, error) {
+				var deadline time.Time
+				deadline, hasDL = ctx.Deadline()
+				remaining = time.Until(deadline)
+				if request.(string) == "block" {
+					<-ctx.Done()
+					return nil, ctx.Err()
+				}
+				return struct{}{}, nil
+			},
+			func(_ context.Context, gCtx *gin.Context) (interface{}, error) {
+				header = gCtx.GetHeader(httptransport.TimeoutHeader)
+				return gCtx.Query("mode"), nil
+			},
+			httptransport.EncodeJSONResponse,
+			httptransport.ServerDeadline(max),
+		)
+	}
+	r := gin.New()
+	r.GET("/", newServer(0).ServeHTTP)
+	r.GET("/capped", newServer(100*time.Millisecond).ServeHTTP)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	call := func(path string, ctx context.Context, options ...httptransport.ClientOption) error {
+		client := httptransport.NewClient(resty.New(), append(options, httptransport.WithClientHost(server.URL), httptransport.WithClientDeadlinePropagation())...)
+		e := client.Endpoint(httptransport.Req(http.MethodGet, path), httptransport.EncodeJSONRequest, httptransport.DecodeJSONResponse(&struct{}{}))
+		_, err := e(ctx, nil)
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if err := call("/", ctx); err != nil {
+		t.Fatal(err)
+	}
+	if header == "" || !hasDL || remaining > 300*time.Millisecond || remaining < 200*time.Millisecond {
+		t.Errorf("propagated: header %q, deadline %v, remaining %s", header, hasDL, remaining)
+	}
+
+	if err := call("/capped", ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !hasDL || remaining > 100*time.Millisecond {
+		t.Errorf("capped: deadline %v, remaining %s", hasDL, remaining)
+	}
+
+	if err := call("/capped", context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if header != "" || !hasDL || remaining > 100*time.Millisecond {
+		t.Errorf("local policy: header %q, deadline %v, remaining %s", header, hasDL, remaining)
+	}
+
+	if err := call("/", context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if header != "" || hasDL {
+		t.Errorf("no deadline: header %q, deadline %v", header, hasDL)
+	}
+
+	// The timeout of the client bounds the deadline as well.
+	if err := call("/", context.Background(), httptransport.WithClientTimeout(5*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if !hasDL || remaining > 5*time.Second || remaining < 4*time.Second {
+		t.Errorf("client timeout: header %q, deadline %v, remaining %s", header, hasDL, remaining)
+	}
+
+	for _, tt := range []struct {
+		header string
+		code   int
+	}{
+		{"50m", http.StatusGatewayTimeout},
+		{"1n", http.StatusGatewayTimeout},
+		{"garbage", http.StatusOK},
+		{"123456789S", http.StatusOK},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/?mode=block", nil)
+		req.Header.Set(httptransport.TimeoutHeader, tt.header)
+		if tt.code == http.StatusOK {
+			req.URL.RawQuery = ""
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if want, have := tt.code, resp.StatusCode; want != have {
+			t.Errorf("%q: want %d, have %d", tt.header, want, have)
+		}
+	}
+}
+
+func TestClientDeadlinePropagationExpired(t *testing.T) {
+	var called bool
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true }))
+	defer server.Close()
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	client := httptransport.NewClient(resty.New(), httptransport.WithClientHost(server.URL), httptransport.WithClientDeadlinePropagation())
+	e := client.Endpoint(httptransport.Req(http.MethodGet, "/"), httptransport.EncodeJSONRequest, httptransport.DecodeJSONResponse(&struct{}{}))
+	if _, err := e(ctx, nil); err == nil {
+		t.Error("want error, have none")
+	}
+	if called {
+		t.Error("request with an expired deadline was sent")
+	}
+}
+
+func TestServerDeadlinePropagatedBelowMax(t *testing.T) {
+	var (
+		called    bool
+		remaining time.Duration
+	)
+	newServer := func(max time.Duration) *httptransport.Server {
+		return httptransport.NewServer(
+			func(ctx context.Context, _ interface{}) (interface{}, error) {
+				called = true
+				deadline, ok := ctx.Deadline()
+				if !ok {
+					t.Error("served without a deadline")
+				}
+				remaining = time.Until(deadline)
+				return struct{}{}, nil
+			},
+			httptransport.NopRequestDecoder,
+			httptransport.EncodeJSONResponse,
+			httptransport.ServerDeadline(max),
+		)
+	}
+	r := gin.New()
+	r.GET("/", newServer(0).ServeHTTP)
+	r.GET("/capped", newServer(time.Second).ServeHTTP)
+
+	for _, tt := range []struct {
+		path, header string
+		code         int
+		max          time.Duration
+	}{
+		// A timeout of 0 can not lift the deadline of the server.
+		{"/", "0n", http.StatusGatewayTimeout, 0},
+		{"/capped", "0n", http.StatusGatewayTimeout, 0},
+		{"/capped", "0S", http.StatusGatewayTimeout, 0},
+		{"/capped", "50m", http.StatusOK, 50 * time.Millisecond},
+		{"/capped", "5S", http.StatusOK, time.Second},
+	} {
+		called, remaining = false, 0
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set(httptransport.TimeoutHeader, tt.header)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if want, have := tt.code, rec.Code; want != have {
+			t.Errorf("%s %q: want %d, have %d", tt.path, tt.header, want, have)
+		}
+		if want := tt.code == http.StatusOK; want != called {
+			t.Errorf("%s %q: endpoint called %v", tt.path, tt.header, called)
+		}
+		if called && (remaining > tt.max || remaining < tt.max-50*time.Millisecond) {
+			t.Errorf("%s %q: want a deadline in %s, have %s", tt.path, tt.header, tt.max, remaining)
+		}
+	}
+}
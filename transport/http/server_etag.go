@@ -0,0 +1,195 @@
+package http
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/kit/endpoint"
+)
+
+// ETagger is checked by the encoder installed with ServerETag. If a response
+// implements ETagger, the returned entity tag is used instead of a hash of the
+// encoded body.
+type ETagger interface {
+	ETag() string
+}
+
+// LastModifier is checked by the encoder installed with ServerETag. If a
+// response implements LastModifier, the Last-Modified header is set and
+// If-Modified-Since requests are answered accordingly.
+type LastModifier interface {
+	LastModified() time.Time
+}
+
+// ServerETag wraps the response encoder so that successful GET and HEAD
+// responses carry an ETag header. The tag is taken from the response if it
+// implements ETagger, otherwise it is a hash of the encoded body. Requests
+// whose If-None-Match or If-Modified-Since header shows the client already
+// holds the current representation are answered with 304 Not Modified and an
+// empty body.
+func ServerETag() ServerOption {
+	return func(s *Server) { s.enc = conditionalEncoder(s.enc) }
+}
+
+// PreconditionFunc returns the current entity tag and modification time of the
+// resource targeted by a decoded request. Either may be left empty when the
+// resource does not track it; an empty tag means the resource does not exist.
+type PreconditionFunc func(ctx context.Context, request interface{}) (etag string, lastModified time.Time, err error)
+
+// ServerPrecondition evaluates If-Match and If-Unmodified-Since headers after
+// the request has been decoded and before the endpoint is invoked, which is
+// what mutating endpoints need to avoid lost updates. When a precondition
+// does not hold the endpoint is skipped and ErrPreconditionFailed is passed to
+// the error encoder, yielding 412 Precondition Failed with the default one.
+// The current state is only looked up for requests carrying either header.
+func ServerPrecondition(current PreconditionFunc) ServerOption {
+	return func(s *Server) {
+		s.before = append(s.before, populatePreconditions)
+		s.e = preconditionMiddleware(current)(s.e)
+	}
+}
+
+type preconditionsKey struct{}
+
+type preconditions struct {
+	ifMatch           string
+	ifUnmodifiedSince string
+}
+
+func populatePreconditions(ctx context.Context, gCtx *gin.Context) context.Context {
+	p := preconditions{
+		ifMatch:           gCtx.GetHeader("If-Match"),
+		ifUnmodifiedSince: gCtx.GetHeader("If-Unmodified-Since"),
+	}
+	if p.ifMatch == "" && p.ifUnmodifiedSince == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, preconditionsKey{}, p)
+}
+
+func preconditionMiddleware(current PreconditionFunc) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			p, ok := ctx.Value(preconditionsKey{}).(preconditions)
+			if !ok {
+				return next(ctx, request)
+			}
+
+			etag, lastModified, err := current(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+
+			switch {
+			case p.ifMatch != "":
+				if p.ifMatch == "*" && etag == "" || p.ifMatch != "*" && !etagMatch(p.ifMatch, quoteETag(etag), false) {
+					return nil, ErrPreconditionFailed
+				}
+			case p.ifUnmodifiedSince != "" && !lastModified.IsZero():
+				t, err := http.ParseTime(p.ifUnmodifiedSince)
+				if err == nil && lastModified.Truncate(time.Second).After(t) {
+					return nil, ErrPreconditionFailed
+				}
+			}
+
+			return next(ctx, request)
+		}
+	}
+}
+
+func conditionalEncoder(enc EncodeResponseFunc) EncodeResponseFunc {
+	return func(ctx context.Context, gCtx *gin.Context, response interface{}) error {
+		method := gCtx.Request.Method
+		if method != http.MethodGet && method != http.MethodHead {
+			return enc(ctx, gCtx, response)
+		}
+
+		bw := newBufferingWriter(gCtx.Writer)
+		gCtx.Writer = bw
+		err := enc(ctx, gCtx, response)
+		gCtx.Writer = bw.ResponseWriter
+		if err != nil {
+			return err
+		}
+		if bw.code != http.StatusOK {
+			return bw.flush()
+		}
+
+		var etag string
+		if e, ok := response.(ETagger); ok {
+			etag = e.ETag()
+		}
+		if etag == "" {
+			etag = fmt.Sprintf("%x", sha1.Sum(bw.buf.Bytes()))
+		}
+		etag = quoteETag(etag)
+		gCtx.Header("ETag", etag)
+
+		var lastModified time.Time
+		if lm, ok := response.(LastModifier); ok {
+			lastModified = lm.LastModified()
+			if !lastModified.IsZero() {
+				gCtx.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+			}
+		}
+
+		if !notModified(gCtx.Request, etag, lastModified) {
+			return bw.flush()
+		}
+
+		h := gCtx.Writer.Header()
+		h.Del("Content-Type")
+		h.Del("Content-Length")
+		gCtx.Writer.WriteHeader(http.StatusNotModified)
+		gCtx.Writer.WriteHeaderNow()
+		return nil
+	}
+}
+
+// notModified reports whether the conditional GET headers of r show that
+// the client holds the representation identified by etag and lastModified.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatch(inm, etag, true)
+	}
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || lastModified.IsZero() {
+		return false
+	}
+	t, err := http.ParseTime(ims)
+	return err == nil && !lastModified.Truncate(time.Second).After(t)
+}
+
+// etagMatch reports whether etag is one of the comma separated entity tags in
+// list, using the weak comparison function if weak is set and the strong one
+// otherwise.
+func etagMatch(list, etag string, weak bool) bool {
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if weak {
+			if strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+			continue
+		}
+		if tag == etag && !strings.HasPrefix(tag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+func quoteETag(etag string) string {
+	if etag == "" || strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
@@ -0,0 +1,161 @@
+package http_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/gin-gonic/gin"
+)
+
+type taggedResponse struct {
+	Foo string `json:"foo"`
+}
+
+func (taggedResponse) ETag() string { return "v1" }
+func (taggedResponse) LastModified() time.Time {
+	return time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+}
+
+func etagServer(response interface{}) *httptest.Server {
+	handler := httptransport.NewServer(
+		func(context.Context, interface{}) (interface{}, error) { return response, nil },
+		func(context.Context, *gin.Context) (interface{}, error) { return struct{}{}, nil },
+		httptransport.EncodeJSONResponse,
+		httptransport.ServerETag(),
+	)
+	r := gin.New()
+	r.GET("/", handler.ServeHTTP)
+	return httptest.NewServer(r)
+}
+
+func getWithHeader(t *testing.T, url, key, value string) (*http.Response, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if key != "" {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	buf, _ := ioutil.ReadAll(resp.Body)
+	return resp, string(buf)
+}
+
+func TestServerETagHash(t *testing.T) {
+	server := etagServer(enhancedResponse{Foo: "bar"})
+	defer server.Close()
+
+	// enhancedResponse encodes with 402, only 200 responses are conditional.
+	resp, _ := getWithHeader(t, server.URL, "", "")
+	if want, have := http.StatusPaymentRequired, resp.StatusCode; want != have {
+		t.Errorf("StatusCode: want %d, have %d", want, have)
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		t.Errorf("ETag: want none, have %q", etag)
+	}
+
+	server = etagServer(struct {
+		Foo string `json:"foo"`
+	}{"bar"})
+	defer server.Close()
+
+	resp, body := getWithHeader(t, server.URL, "", "")
+	etag := resp.Header.Get("ETag")
+	if etag == "" || body != `{"foo":"bar"}` {
+		t.Fatalf("want ETag and body, have %q %q", etag, body)
+	}
+
+	resp, body = getWithHeader(t, server.URL, "If-None-Match", `"other", `+etag)
+	if want, have := http.StatusNotModified, resp.StatusCode; want != have {
+		t.Errorf("StatusCode: want %d, have %d", want, have)
+	}
+	if body != "" {
+		t.Errorf("Body: want none, have %q", body)
+	}
+
+	resp, _ = getWithHeader(t, server.URL, "If-None-Match", `"other"`)
+	if want, have := http.StatusOK, resp.StatusCode; want != have {
+		t.Errorf("StatusCode: want %d, have %d", want, have)
+	}
+}
+
+func TestServerETagger(t *testing.T) {
+	server := etagServer(taggedResponse{Foo: "bar"})
+	defer server.Close()
+
+	resp, _ := getWithHeader(t, server.URL, "", "")
+	if want, have := `"v1"`, resp.Header.Get("ETag"); want != have {
+		t.Errorf("ETag: want %q, have %q", want, have)
+	}
+	if want, have := "Sun, 02 Jan 2022 03:04:05 GMT", resp.Header.Get("Last-Modified"); want != have {
+		t.Errorf("Last-Modified: want %q, have %q", want, have)
+	}
+
+	for _, tt := range []struct {
+		key, value string
+		code       int
+	}{
+		{"If-None-Match", `W/"v1"`, http.StatusNotModified},
+		{"If-None-Match", `"v0"`, http.StatusOK},
+		{"If-Modified-Since", "Sun, 02 Jan 2022 03:04:05 GMT", http.StatusNotModified},
+		{"If-Modified-Since", "Sun, 02 Jan 2022 03:04:04 GMT", http.StatusOK},
+	} {
+		resp, _ := getWithHeader(t, server.URL, tt.key, tt.value)
+		if want, have := tt.code, resp.StatusCode; want != have {
+			t.Errorf("%s %s: want %d, have %d", tt.key, tt.value, want, have)
+		}
+	}
+}
+
+func TestServerPrecondition(t *testing.T) {
+	var called bool
+	handler := httptransport.NewServer(
+		func(context.Context, interface{}) (interface{}, error) { called = true; return struct{}{}, nil },
+		func(context.Context, *gin.Context) (interface{}, error) { return struct{}{}, nil },
+		httptransport.EncodeJSONResponse,
+		httptransport.ServerPrecondition(func(context.Context, interface{}) (string, time.Time, error) {
+			return "v2", time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC), nil
+		}),
+	)
+	r := gin.New()
+	r.PUT("/", handler.ServeHTTP)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	for _, tt := range []struct {
+		key, value string
+		code       int
+	}{
+		{"", "", http.StatusOK},
+		{"If-Match", `"v1"`, http.StatusPreconditionFailed},
+		{"If-Match", `"v1", "v2"`, http.StatusOK},
+		{"If-Match", `W/"v2"`, http.StatusPreconditionFailed},
+		{"If-Match", "*", http.StatusOK},
+		{"If-Unmodified-Since", "Sun, 02 Jan 2022 03:04:04 GMT", http.StatusPreconditionFailed},
+		{"If-Unmodified-Since", "Sun, 02 Jan 2022 03:04:05 GMT", http.StatusOK},
+	} {
+		called = false
+		req, _ := http.NewRequest(http.MethodPut, server.URL, nil)
+		if tt.key != "" {
+			req.Header.Set(tt.key, tt.value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if want, have := tt.code, resp.StatusCode; want != have {
+			t.Errorf("%s %s: want %d, have %d", tt.key, tt.value, want, have)
+		}
+		if want, have := tt.code == http.StatusOK, called; want != have {
+			t.Errorf("%s %s: endpoint called: want %v, have %v", tt.key, tt.value, want, have)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/kit/endpoint"
+)
+
+// ServerMaxBodyBytes limits request bodies to n bytes. Requests announcing a
+// larger Content-Length are refused before the ServerBefore functions, and
+// reads of other bodies fail beyond n bytes, including reads made by
+// ServerBefore functions and options such as HMACAuthenticator and
+// ServerIdempotency. In both cases ErrRequestBodyTooLarge is passed to the
+// error encoder, even if the decoder wrapped the read error, and the
+// connection is closed after the response rather than drained.
+func ServerMaxBodyBytes(n int64) ServerOption {
+	return func(s *Server) {
+		s.before = append([]RequestFunc{limitBody(n)}, s.before...)
+		dec := s.dec
+		s.dec = func(ctx context.Context, gCtx *gin.Context) (interface{}, error) {
+			request, err := dec(ctx, gCtx)
+			if body, _ := ctx.Value(maxBodyKey{}).(*maxBody); err != nil && body != nil && body.n < 0 {
+				err = ErrRequestBodyTooLarge
+			}
+			return request, err
+		}
+	}
+}
+
+// maxBodyKey is the context key of the body limited by ServerMaxBodyBytes.
+type maxBodyKey struct{}
+
+func limitBody(n int64) RequestFunc {
+	return func(ctx context.Context, gCtx *gin.Context) context.Context {
+		r := gCtx.Request
+		if r.ContentLength > n {
+			gCtx.Header("Connection", "close")
+			Abort(gCtx, ErrRequestBodyTooLarge)
+			return ctx
+		}
+		if r.Body == nil || r.Body == http.NoBody {
+			return ctx
+		}
+		body := &maxBody{limitedBody: limitedBody{ReadCloser: r.Body, n: n}, gCtx: gCtx}
+		r.Body = body
+		return context.WithValue(ctx, maxBodyKey{}, body)
+	}
+}
+
+// maxBody is a limitedBody closing the connection after the response once
+// the limit is exceeded.
+type maxBody struct {
+	limitedBody
+	gCtx *gin.Context
+}
+
+func (b *maxBody) Read(p []byte) (int, error) {
+	n, err := b.limitedBody.Read(p)
+	if err == ErrRequestBodyTooLarge {
+		b.gCtx.Header("Connection", "close")
+	}
+	return n, err
+}
+
+// TimeoutOption sets an optional parameter for ServerTimeout.
+type TimeoutOption func(*timeoutConfig)
+
+type timeoutConfig struct {
+	code int
+}
+
+// TimeoutStatus sets the status code requests are answered with when the
+// endpoint times out, such as http.StatusGatewayTimeout for endpoints that
+// mostly wait on upstream services. By default it is
+// http.StatusServiceUnavailable.
+func TimeoutStatus(code int) TimeoutOption {
+	return func(c *timeoutConfig) { c.code = code }
+}
+
+// ServerTimeout cancels the context of the endpoint after d. The request is
+// then answered through the error encoder with ErrHandlerTimeout, or a
+// StatusError with the code set by TimeoutStatus, without waiting for the
+// endpoint to return. Its result is discarded, so endpoints should stop
+// their work once their context is done.
+//
+// The timeout does not apply to the decoding of requests: see
+// ServerSlowReadGuard for clients sending their body slowly.
+func ServerTimeout(d time.Duration, options ...TimeoutOption) ServerOption {
+	return func(s *Server) {
+		c := timeoutConfig{code: http.StatusServiceUnavailable}
+		for _, option := range options {
+			option(&c)
+		}
+		timeoutErr := ErrHandlerTimeout
+		if c.code != ErrHandlerTimeout.Code {
+			timeoutErr = NewStatusError(c.code, ErrHandlerTimeout.Message)
+		}
+		s.e = timeoutMiddleware(d, timeoutErr)(s.e)
+	}
+}
+
+func timeoutMiddleware(d time.Duration, timeoutErr error) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			type result struct {
+				response interface{}
+				err      error
+				panicked interface{}
+			}
+			done := make(chan result, 1)
+			go func() {
+				var r result
+				defer func() {
+					r.panicked = recover()
+					done <- r
+				}()
+				r.response, r.err = next(ctx, request)
+			}()
+
+			select {
+			case r := <-done:
+				if r.panicked != nil {
+					panic(r.panicked)
+				}
+				if r.err != nil && errors.Is(r.err, context.DeadlineExceeded) && ctx.Err() == context.DeadlineExceeded {
+					return nil, timeoutErr
+				}
+				return r.response, r.err
+			case <-ctx.Done():
+				if ctx.Err() == context.DeadlineExceeded {
+					return nil, timeoutErr
+				}
+				return nil, ctx.Err()
+			}
+		}
+	}
+}
+
+// ConnContext populates the connection of requests in their context, so that
+// ServerSlowReadGuard can set deadlines on it. Set it as the ConnContext of
+// the http.Server serving the engine.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, ContextKeyConnection, c)
+}
+
+// ServerSlowReadGuard fails the decoding of request bodies with
+// ErrRequestTimeout once they are read slower than minRate bytes per second,
+// allowing grace for the first bytes to arrive, so that clients trickling
+// their body can not hold a worker. The connection is closed after the
+// response.
+//
+// Without ConnContext, the rate is only checked when reads return, which
+// stops slow clients but not stalled ones. With it, read deadlines are set on
+// the connection, so that reads blocked on a stalled client are interrupted
+// as well.
+//
+// A minRate of 0 or less only allows grace for the whole body to arrive.
+func ServerSlowReadGuard(grace time.Duration, minRate int64) ServerOption {
+	return func(s *Server) {
+		dec := s.dec
+		s.dec = func(ctx context.Context, gCtx *gin.Context) (interface{}, error) {
+			r := gCtx.Request
+			if r.Body == nil || r.Body == http.NoBody {
+				return dec(ctx, gCtx)
+			}
+			body := &slowReadBody{
+				ReadCloser: r.Body,
+				start:      time.Now(),
+				grace:      grace,
+				minRate:    minRate,
+			}
+			body.conn, _ = r.Context().Value(ContextKeyConnection).(net.Conn)
+			r.Body = body
+			defer body.clearDeadline()
+
+			request, err := dec(ctx, gCtx)
+			if err != nil && body.err != nil {
+				gCtx.Header("Connection", "close")
+				err = body.err
+			}
+			return request, err
+		}
+	}
+}
+
+type slowReadBody struct {
+	io.ReadCloser
+	conn    net.Conn
+	start   time.Time
+	grace   time.Duration
+	minRate int64
+	read    int64
+	err     error
+}
+
+// deadline returns the time by which the bytes read so far, plus the next,
+// should have been read.
+func (b *slowReadBody) deadline() time.Time {
+	if b.minRate <= 0 {
+		return b.start.Add(b.grace)
+	}
+	return b.start.Add(b.grace + time.Duration(b.read)*time.Second/time.Duration(b.minRate))
+}
+
+func (b *slowReadBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.conn != nil {
+		b.conn.SetReadDeadline(b.deadline())
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err == io.EOF {
+		b.clearDeadline()
+		return n, err
+	}
+	var netErr net.Error
+	if (err != nil && errors.As(err, &netErr) && netErr.Timeout()) || time.Now().After(b.deadline()) {
+		b.err = ErrRequestTimeout
+		return n, b.err
+	}
+	return n, err
+}
+
+func (b *slowReadBody) clearDeadline() {
+	if b.conn != nil {
+		b.conn.SetReadDeadline(time.Time{})
+	}
+}
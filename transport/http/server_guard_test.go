@@ -0,0 +1,297 @@
+package http_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+func readBodyDecoder(_ context.Context, gCtx *gin.Context) (interface{}, error) {
+	b, err := ioutil.ReadAll(gCtx.Request.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "read body")
+	}
+	return string(b), nil
+}
+
+func encodeString(_ context.Context, gCtx *gin.Context, response interface{}) error {
+	gCtx.String(http.StatusOK, "%v", response)
+	return nil
+}
+
+func TestServerMaxBodyBytes(t *testing.T) {
+	handler := httptransport.NewServer(
+		func(_ context.Context, request interface{}) (interface{}, error) { return request, nil },
+		readBodyDecoder,
+		encodeString,
+		httptransport.ServerMaxBodyBytes(10),
+	)
+	r := gin.New()
+	r.POST("/", handler.ServeHTTP)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	for _, tt := range []struct {
+		name string
+		body io.Reader
+		code int
+	}{
+		{"small", strings.NewReader("0123456789"), http.StatusOK},
+		{"Content-Length", strings.NewReader("0123456789a"), http.StatusRequestEntityTooLarge},
+		// Without a length, the body is sent chunked and the limit is hit
+		// while reading.
+		{"chunked", ioutil.NopCloser(strings.NewReader(strings.Repeat("x", 100))), http.StatusRequestEntityTooLarge},
+		{"chunked small", ioutil.NopCloser(strings.NewReader("0123")), http.StatusOK},
+	} {
+		resp, err := http.Post(server.URL, "text/plain", tt.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if want, have := tt.code, resp.StatusCode; want != have {
+			t.Errorf("%s: want %d, have %d", tt.name, want, have)
+		}
+	}
+}
+
+func TestServerMaxBodyBytesBeforeReaders(t *testing.T) {
+	hmacKeys := func(context.Context, string) ([]byte, httptransport.Principal, error) {
+		return []byte("secret"), httptransport.Principal{}, nil
+	}
+	hmacHeader := func() string {
+		return fmt.Sprintf("HMAC-SHA256 KeyId=svc, Timestamp=%d, Nonce=n, Signature=x", time.Now().Unix())
+	}
+	// read counts the bytes of the body read, by the options or the decoder.
+	var read int64
+	count := httptransport.ServerBefore(func(ctx context.Context, gCtx *gin.Context) context.Context {
+		gCtx.Request.Body = &countingReader{ReadCloser: gCtx.Request.Body, n: &read}
+		return ctx
+	})
+	r := gin.New()
+	for path, option := range map[string]httptransport.ServerOption{
+		"/hmac":        httptransport.ServerBefore(httptransport.HMACAuthenticator(hmacKeys)),
+		"/idempotency": httptransport.ServerIdempotency(httptransport.NewMemoryIdempotencyStore()),
+	} {
+		// The limit is given last, and still applies to the body read by
+		// the options given before.
+		r.POST(path, httptransport.NewServer(
+			func(_ context.Context, request interface{}) (interface{}, error) { return request, nil },
+			readBodyDecoder,
+			encodeString,
+			count,
+			option,
+			httptransport.ServerMaxBodyBytes(10),
+		).ServeHTTP)
+	}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	for _, path := range []string{"/hmac", "/idempotency"} {
+		for _, tt := range []struct {
+			name string
+			body func() io.Reader
+		}{
+			{"Content-Length", func() io.Reader { return strings.NewReader(strings.Repeat("x", 100)) }},
+			{"chunked", func() io.Reader { return ioutil.NopCloser(strings.NewReader(strings.Repeat("x", 100))) }},
+		} {
+			read = 0
+			req, _ := http.NewRequest(http.MethodPost, server.URL+path, tt.body())
+			req.Header.Set("Authorization", hmacHeader())
+			req.Header.Set("Idempotency-Key", "k-"+tt.name)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if want, have := http.StatusRequestEntityTooLarge, resp.StatusCode; want != have {
+				t.Errorf("%s %s: want %d, have %d", path, tt.name, want, have)
+			}
+			if read > 11 {
+				t.Errorf("%s %s: %d bytes read past the limit", path, tt.name, read)
+			}
+		}
+	}
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	*r.n += int64(n)
+	return n, err
+}
+
+func TestServerTimeout(t *testing.T) {
+	canceled := make(chan error, 1)
+	newServer := func(options ...httptransport.TimeoutOption) *httptransport.Server {
+		return httptransport.NewServer(
+			func(ctx context.Context, request interface{}) (interface{}, error) {
+				d, _ := time.ParseDuration(request.(string))
+				select {
+				case <-time.After(d):
+					return "done", nil
+				case <-ctx.Done():
+					canceled <- ctx.Err()
+					return nil, ctx.Err()
+				}
+			},
+			func(_ context.Context, gCtx *gin.Context) (interface{}, error) { return gCtx.Query("sleep"), nil },
+			encodeString,
+			httptransport.ServerTimeout(50*time.Millisecond, options...),
+		)
+	}
+	r := gin.New()
+	r.GET("/", newServer().ServeHTTP)
+	r.GET("/gateway", newServer(httptransport.TimeoutStatus(http.StatusGatewayTimeout)).ServeHTTP)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	for _, tt := range []struct {
+		path string
+		code int
+	}{
+		{"/?sleep=1ms", http.StatusOK},
+		{"/?sleep=1s", http.StatusServiceUnavailable},
+		{"/gateway?sleep=1s", http.StatusGatewayTimeout},
+	} {
+		begin := time.Now()
+		resp, err := http.Get(server.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if want, have := tt.code, resp.StatusCode; want != have {
+			t.Errorf("%s: want %d, have %d", tt.path, want, have)
+		}
+		if elapsed := time.Since(begin); elapsed > 500*time.Millisecond {
+			t.Errorf("%s: answered after %s", tt.path, elapsed)
+		}
+		if tt.code == http.StatusOK {
+			continue
+		}
+		select {
+		case err := <-canceled:
+			if want, have := context.DeadlineExceeded, err; want != have {
+				t.Errorf("%s: endpoint context: want %v, have %v", tt.path, want, have)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("%s: endpoint context not canceled", tt.path)
+		}
+	}
+}
+
+func TestServerSlowReadGuard(t *testing.T) {
+	handler := httptransport.NewServer(
+		func(_ context.Context, request interface{}) (interface{}, error) { return request, nil },
+		readBodyDecoder,
+		encodeString,
+		httptransport.ServerSlowReadGuard(100*time.Millisecond, 1000),
+	)
+	r := gin.New()
+	r.POST("/", handler.ServeHTTP)
+
+	send := func(t *testing.T, addr string, write func(w io.Writer)) int {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		io.WriteString(conn, "POST / HTTP/1.1\r\nHost: test\r\nContent-Length: 1000\r\n\r\n")
+		write(conn)
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	t.Run("fast", func(t *testing.T) {
+		server := httptest.NewServer(r)
+		defer server.Close()
+		code := send(t, server.Listener.Addr().String(), func(w io.Writer) {
+			io.WriteString(w, strings.Repeat("x", 1000))
+		})
+		if want, have := http.StatusOK, code; want != have {
+			t.Errorf("want %d, have %d", want, have)
+		}
+	})
+
+	t.Run("trickle", func(t *testing.T) {
+		server := httptest.NewServer(r)
+		defer server.Close()
+		code := send(t, server.Listener.Addr().String(), func(w io.Writer) {
+			for i := 0; i < 10; i++ {
+				if _, err := io.WriteString(w, "x"); err != nil {
+					return
+				}
+				time.Sleep(30 * time.Millisecond)
+			}
+		})
+		if want, have := http.StatusRequestTimeout, code; want != have {
+			t.Errorf("want %d, have %d", want, have)
+		}
+	})
+
+	t.Run("stalled", func(t *testing.T) {
+		server := httptest.NewUnstartedServer(r)
+		server.Config.ConnContext = httptransport.ConnContext
+		server.Start()
+		defer server.Close()
+		begin := time.Now()
+		code := send(t, server.Listener.Addr().String(), func(w io.Writer) {
+			io.WriteString(w, "x")
+		})
+		if want, have := http.StatusRequestTimeout, code; want != have {
+			t.Errorf("want %d, have %d", want, have)
+		}
+		if elapsed := time.Since(begin); elapsed > time.Second {
+			t.Errorf("answered after %s", elapsed)
+		}
+	})
+
+	t.Run("grace only", func(t *testing.T) {
+		graceOnly := gin.New()
+		graceOnly.POST("/", httptransport.NewServer(
+			func(_ context.Context, request interface{}) (interface{}, error) { return request, nil },
+			readBodyDecoder,
+			encodeString,
+			httptransport.ServerSlowReadGuard(100*time.Millisecond, 0),
+		).ServeHTTP)
+		server := httptest.NewServer(graceOnly)
+		defer server.Close()
+		code := send(t, server.Listener.Addr().String(), func(w io.Writer) {
+			io.WriteString(w, strings.Repeat("x", 1000))
+		})
+		if want, have := http.StatusOK, code; want != have {
+			t.Errorf("fast: want %d, have %d", want, have)
+		}
+		code = send(t, server.Listener.Addr().String(), func(w io.Writer) {
+			for i := 0; i < 10; i++ {
+				if _, err := io.WriteString(w, "x"); err != nil {
+					return
+				}
+				time.Sleep(30 * time.Millisecond)
+			}
+		})
+		if want, have := http.StatusRequestTimeout, code; want != have {
+			t.Errorf("trickle: want %d, have %d", want, have)
+		}
+	})
+}
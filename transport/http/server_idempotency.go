@@ -0,0 +1,320 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// ErrIdempotencyConflict is returned when a request reuses the
+	// Idempotency-Key of a request that is still in progress.
+	ErrIdempotencyConflict = NewStatusError(http.StatusConflict, "a request with the same Idempotency-Key is in progress")
+
+	// ErrIdempotencyMismatch is returned when a request reuses the
+	// Idempotency-Key of a different request.
+	ErrIdempotencyMismatch = NewStatusError(http.StatusUnprocessableEntity, "Idempotency-Key was used for a different request")
+)
+
+// IdempotencyRecord is the state of an Idempotency-Key in an
+// IdempotencyStore. The response fields are set once Completed.
+type IdempotencyRecord struct {
+	// Fingerprint identifies the request that reserved the key.
+	Fingerprint string
+	Completed   bool
+
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// IdempotencyStore records the responses of requests sent with an
+// Idempotency-Key for ServerIdempotency. Implementations must make Reserve
+// atomic, so that only one of several concurrent requests owns a key.
+type IdempotencyStore interface {
+	// Reserve records that a request with the given fingerprint is in
+	// progress for key and returns nil, if key is not recorded yet.
+	// Otherwise it returns the record of key.
+	Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error)
+	// Complete stores the response of the request that reserved key.
+	Complete(ctx context.Context, key string, rec *IdempotencyRecord, ttl time.Duration) error
+	// Release forgets key, so that the request may be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyOption sets an optional parameter for ServerIdempotency.
+type IdempotencyOption func(*idempotency)
+
+// IdempotencyTTL sets how long keys and their responses are kept.
+// By default they are kept for 24 hours.
+func IdempotencyTTL(ttl time.Duration) IdempotencyOption {
+	return func(i *idempotency) { i.ttl = ttl }
+}
+
+// IdempotencyScope scopes keys by the values of the given gin keys, which
+// ServerBefore functions such as authenticators populate. With a scope of the
+// principal, users can not replay each other's requests.
+func IdempotencyScope(ginKeys ...string) IdempotencyOption {
+	return func(i *idempotency) { i.scope = append(i.scope, ginKeys...) }
+}
+
+// IdempotencyWait makes requests that reuse the key of a request in progress
+// wait up to timeout for its response, instead of failing straight away with
+// ErrIdempotencyConflict.
+func IdempotencyWait(timeout time.Duration) IdempotencyOption {
+	return func(i *idempotency) { i.wait = timeout }
+}
+
+// ServerIdempotency honours the Idempotency-Key header of requests with
+// methods other than GET, HEAD and OPTIONS. The status, headers and body of
+// the first request sent with a key are recorded in store, and later requests
+// with the same key are answered with them, marked by an Idempotent-Replayed
+// header, without invoking the endpoint. Keys are scoped by method and route.
+//
+// A request reusing the key of a request still in progress fails with
+// ErrIdempotencyConflict, and one reusing the key of a request with another
+// method, URL or body fails with ErrIdempotencyMismatch. Responses with a 5xx
+// status are not recorded, so the request can be retried with the same key.
+func ServerIdempotency(store IdempotencyStore, options ...IdempotencyOption) ServerOption {
+	return func(s *Server) {
+		i := &idempotency{
+			server: s,
+			store:  store,
+			ttl:    24 * time.Hour,
+		}
+		for _, option := range options {
+			option(i)
+		}
+		s.interceptors = append(s.interceptors, i.intercept)
+	}
+}
+
+type idempotency struct {
+	server *Server
+	store  IdempotencyStore
+	ttl    time.Duration
+	scope  []string
+	wait   time.Duration
+}
+
+func (i *idempotency) intercept(next handlerFunc) handlerFunc {
+	return func(ctx context.Context, gCtx *gin.Context) context.Context {
+		switch gCtx.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return next(ctx, gCtx)
+		}
+		key := gCtx.GetHeader("Idempotency-Key")
+		if key == "" {
+			return next(ctx, gCtx)
+		}
+
+		fingerprint, err := i.fingerprint(gCtx)
+		if err != nil {
+			i.fail(ctx, err, gCtx)
+			return ctx
+		}
+		key = i.key(gCtx, key)
+
+		rec, err := i.reserve(ctx, key, fingerprint)
+		if err != nil {
+			i.fail(ctx, err, gCtx)
+			return ctx
+		}
+		if rec != nil {
+			i.replay(gCtx, rec)
+			return ctx
+		}
+
+		rw := &recordingWriter{ResponseWriter: gCtx.Writer}
+		gCtx.Writer = rw
+		completed := false
+		defer func() {
+			gCtx.Writer = rw.ResponseWriter
+			if !completed {
+				i.store.Release(detachedContext{ctx}, key)
+			}
+		}()
+
+		ctx = next(ctx, gCtx)
+
+		code := rw.Status()
+		if code >= http.StatusInternalServerError {
+			return ctx
+		}
+		err = i.store.Complete(detachedContext{ctx}, key, &IdempotencyRecord{
+			Fingerprint: fingerprint,
+			Completed:   true,
+			StatusCode:  code,
+			Header:      rw.Header().Clone(),
+			Body:        rw.buf.Bytes(),
+		}, i.ttl)
+		if err != nil {
+			i.server.errorHandler.Handle(ctx, err)
+			return ctx
+		}
+		completed = true
+		return ctx
+	}
+}
+
+// reserve reserves key for the request, and returns nil once it owns the key.
+// Otherwise it returns the completed record to replay, waiting for it if the
+// request is configured to.
+func (i *idempotency) reserve(ctx context.Context, key, fingerprint string) (*IdempotencyRecord, error) {
+	deadline := time.Now().Add(i.wait)
+	for {
+		rec, err := i.store.Reserve(ctx, key, fingerprint, i.ttl)
+		if err != nil || rec == nil {
+			return nil, err
+		}
+		if rec.Fingerprint != fingerprint {
+			return nil, ErrIdempotencyMismatch
+		}
+		if rec.Completed {
+			return rec, nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, ErrIdempotencyConflict
+		}
+		if remaining > 25*time.Millisecond {
+			remaining = 25 * time.Millisecond
+		}
+		select {
+		case <-time.After(remaining):
+		case <-ctx.Done():
+			return nil, ErrIdempotencyConflict
+		}
+	}
+}
+
+func (i *idempotency) replay(gCtx *gin.Context, rec *IdempotencyRecord) {
+	h := gCtx.Writer.Header()
+	for k, v := range rec.Header {
+		if _, ok := h[k]; !ok {
+			h[k] = v
+		}
+	}
+	h.Set("Idempotent-Replayed", "true")
+	gCtx.Writer.WriteHeader(rec.StatusCode)
+	gCtx.Writer.WriteHeaderNow()
+	gCtx.Writer.Write(rec.Body)
+}
+
+func (i *idempotency) fail(ctx context.Context, err error, gCtx *gin.Context) {
+	i.server.errorHandler.Handle(ctx, err)
+	i.server.errorEncoder(ctx, err, gCtx)
+}
+
+// fingerprint hashes the method, URL and body of the request. The body is
+// read and replaced, so that it can still be decoded.
+func (i *idempotency) fingerprint(gCtx *gin.Context) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", gCtx.Request.Method, gCtx.Request.URL.RequestURI())
+	if gCtx.Request.Body != nil {
+		body, err := ioutil.ReadAll(gCtx.Request.Body)
+		if err != nil {
+			return "", err
+		}
+		gCtx.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		h.Write(body)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (i *idempotency) key(gCtx *gin.Context, key string) string {
+	route := gCtx.FullPath()
+	if route == "" {
+		route = gCtx.Request.URL.Path
+	}
+	parts := []string{gCtx.Request.Method, route}
+	for _, name := range i.scope {
+		v, _ := gCtx.Get(name)
+		parts = append(parts, fmt.Sprint(v))
+	}
+	return strings.Join(append(parts, key), " ")
+}
+
+// recordingWriter keeps a copy of the body written to the response.
+type recordingWriter struct {
+	gin.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.buf.Write(p[:n])
+	return n, err
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	w.buf.WriteString(s[:n])
+	return n, err
+}
+
+// NewMemoryIdempotencyStore returns an IdempotencyStore that keeps records in
+// memory. It is suitable for a single instance; services running several
+// replicas need a shared store.
+func NewMemoryIdempotencyStore() IdempotencyStore {
+	return &memoryIdempotencyStore{records: make(map[string]memoryIdempotencyRecord)}
+}
+
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]memoryIdempotencyRecord
+	sweep   time.Time
+}
+
+type memoryIdempotencyRecord struct {
+	rec     *IdempotencyRecord
+	expires time.Time
+}
+
+func (s *memoryIdempotencyStore) Reserve(_ context.Context, key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.After(s.sweep) {
+		for k, r := range s.records {
+			if now.After(r.expires) {
+				delete(s.records, k)
+			}
+		}
+		s.sweep = now.Add(time.Minute)
+	}
+
+	if r, ok := s.records[key]; ok && now.Before(r.expires) {
+		return r.rec, nil
+	}
+	s.records[key] = memoryIdempotencyRecord{
+		rec:     &IdempotencyRecord{Fingerprint: fingerprint},
+		expires: now.Add(ttl),
+	}
+	return nil, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(_ context.Context, key string, rec *IdempotencyRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = memoryIdempotencyRecord{rec: rec, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
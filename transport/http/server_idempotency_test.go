@@ -0,0 +1,144 @@
+package http_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/gin-gonic/gin"
+)
+
+func idempotencyServer(e func(context.Context, interface{}) (interface{}, error), options ...httptransport.IdempotencyOption) *httptest.Server {
+	handler := httptransport.NewServer(
+		e,
+		func(_ context.Context, gCtx *gin.Context) (interface{}, error) {
+			b, err := ioutil.ReadAll(gCtx.Request.Body)
+			return string(b), err
+		},
+		httptransport.EncodeJSONResponse,
+		httptransport.ServerBefore(func(ctx context.Context, gCtx *gin.Context) context.Context {
+			gCtx.Set("user", gCtx.GetHeader("X-User"))
+			return ctx
+		}),
+		httptransport.ServerIdempotency(httptransport.NewMemoryIdempotencyStore(), append(options, httptransport.IdempotencyScope("user"))...),
+	)
+	r := gin.New()
+	r.POST("/payments", handler.ServeHTTP)
+	return httptest.NewServer(r)
+}
+
+func postIdempotent(t *testing.T, url, key, user, body string) (*http.Response, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url+"/payments", strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", key)
+	req.Header.Set("X-User", user)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Error(err)
+		return &http.Response{Header: http.Header{}}, ""
+	}
+	defer resp.Body.Close()
+	buf, _ := ioutil.ReadAll(resp.Body)
+	return resp, string(buf)
+}
+
+func TestServerIdempotency(t *testing.T) {
+	var calls int32
+	server := idempotencyServer(func(_ context.Context, request interface{}) (interface{}, error) {
+		n := atomic.AddInt32(&calls, 1)
+		return map[string]interface{}{"n": n, "body": request}, nil
+	})
+	defer server.Close()
+
+	resp, first := postIdempotent(t, server.URL, "k1", "alice", "pay 1")
+	if resp.Header.Get("Idempotent-Replayed") != "" {
+		t.Error("first response was marked as replayed")
+	}
+	resp, replay := postIdempotent(t, server.URL, "k1", "alice", "pay 1")
+	if want, have := first, replay; want != have {
+		t.Errorf("replay: want %s, have %s", want, have)
+	}
+	if want, have := "true", resp.Header.Get("Idempotent-Replayed"); want != have {
+		t.Errorf("Idempotent-Replayed: want %q, have %q", want, have)
+	}
+	if want, have := int32(1), atomic.LoadInt32(&calls); want != have {
+		t.Errorf("calls: want %d, have %d", want, have)
+	}
+
+	resp, _ = postIdempotent(t, server.URL, "k1", "alice", "pay 2")
+	if want, have := http.StatusUnprocessableEntity, resp.StatusCode; want != have {
+		t.Errorf("mismatch: want %d, have %d", want, have)
+	}
+
+	_, other := postIdempotent(t, server.URL, "k1", "bob", "pay 1")
+	if want, have := `{"body":"pay 1","n":2}`, other; want != have {
+		t.Errorf("other scope: want %s, have %s", want, have)
+	}
+}
+
+func TestServerIdempotencyConcurrent(t *testing.T) {
+	var (
+		entered = make(chan struct{})
+		release = make(chan struct{})
+	)
+	e := func(context.Context, interface{}) (interface{}, error) {
+		close(entered)
+		<-release
+		return struct{}{}, nil
+	}
+
+	server := idempotencyServer(e)
+	defer server.Close()
+	done := make(chan struct{})
+	go func() { postIdempotent(t, server.URL, "k", "alice", ""); close(done) }()
+	<-entered
+	resp, _ := postIdempotent(t, server.URL, "k", "alice", "")
+	if want, have := http.StatusConflict, resp.StatusCode; want != have {
+		t.Errorf("concurrent: want %d, have %d", want, have)
+	}
+	close(release)
+	<-done
+
+	entered, release = make(chan struct{}), make(chan struct{})
+	server = idempotencyServer(e, httptransport.IdempotencyWait(time.Second))
+	defer server.Close()
+	go postIdempotent(t, server.URL, "k", "alice", "")
+	<-entered
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	resp, _ = postIdempotent(t, server.URL, "k", "alice", "")
+	if want, have := http.StatusOK, resp.StatusCode; want != have {
+		t.Errorf("waiting: want %d, have %d", want, have)
+	}
+	if want, have := "true", resp.Header.Get("Idempotent-Replayed"); want != have {
+		t.Errorf("Idempotent-Replayed: want %q, have %q", want, have)
+	}
+}
+
+func TestServerIdempotencyServerError(t *testing.T) {
+	var calls int32
+	server := idempotencyServer(func(context.Context, interface{}) (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return nil, httptransport.NewStatusError(http.StatusServiceUnavailable, "")
+		}
+		return struct{}{}, nil
+	})
+	defer server.Close()
+
+	resp, _ := postIdempotent(t, server.URL, "k", "alice", "")
+	if want, have := http.StatusServiceUnavailable, resp.StatusCode; want != have {
+		t.Errorf("first: want %d, have %d", want, have)
+	}
+	resp, _ = postIdempotent(t, server.URL, "k", "alice", "")
+	if want, have := http.StatusOK, resp.StatusCode; want != have {
+		t.Errorf("retry: want %d, have %d", want, have)
+	}
+	if resp.Header.Get("Idempotent-Replayed") != "" {
+		t.Error("retry after a server error was replayed")
+	}
+}
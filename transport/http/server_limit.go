@@ -0,0 +1,268 @@
+package http
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LimitInfo describes the state of a limit for the key of a request. It is
+// populated in the context by ServerRateLimit and ServerConcurrencyLimit, so
+// that finalizers can observe it.
+type LimitInfo struct {
+	Key       string
+	Limit     int
+	Remaining int
+	// Reset is the time until the limit is fully available again.
+	Reset time.Duration
+	// Rejected is set when the request was refused because of the limit.
+	Rejected bool
+}
+
+// LimitKeyFunc returns the key whose limit applies to a request. Requests with
+// the same key share a limit.
+type LimitKeyFunc func(ctx context.Context, gCtx *gin.Context) string
+
+// LimitKeyGlobal is a LimitKeyFunc that puts every request under one limit.
+func LimitKeyGlobal(context.Context, *gin.Context) string {
+	return ""
+}
+
+// LimitKeyRemoteAddr is a LimitKeyFunc that limits requests by the IP address
+// of the connection, taken from the KeyRequestRemoteAddr gin key if it has
+// been populated.
+func LimitKeyRemoteAddr(_ context.Context, gCtx *gin.Context) string {
+	addr := gCtx.GetString(KeyRequestRemoteAddr)
+	if addr == "" {
+		addr = gCtx.Request.RemoteAddr
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// LimitKeyClientIP is a LimitKeyFunc that limits requests by the first address
+// of their X-Forwarded-For header, falling back to LimitKeyRemoteAddr. The
+// header is set by clients at will, so only use it behind a proxy that
+// overwrites it.
+func LimitKeyClientIP(ctx context.Context, gCtx *gin.Context) string {
+	xff := gCtx.GetString(KeyRequestXForwardedFor)
+	if xff == "" {
+		xff = gCtx.GetHeader("X-Forwarded-For")
+	}
+	if ip := strings.TrimSpace(strings.Split(xff, ",")[0]); ip != "" {
+		return ip
+	}
+	return LimitKeyRemoteAddr(ctx, gCtx)
+}
+
+// LimitOption sets an optional parameter for ServerRateLimit and
+// ServerConcurrencyLimit.
+type LimitOption func(*limitConfig)
+
+type limitConfig struct {
+	key LimitKeyFunc
+}
+
+// LimitKey sets the function requests are keyed by. By default all requests
+// share a single limit.
+func LimitKey(f LimitKeyFunc) LimitOption {
+	return func(c *limitConfig) { c.key = f }
+}
+
+func newLimitConfig(options []LimitOption) limitConfig {
+	c := limitConfig{key: LimitKeyGlobal}
+	for _, option := range options {
+		option(&c)
+	}
+	return c
+}
+
+// ServerRateLimit admits requests through a token bucket per key, refilled
+// with rate tokens per second and holding at most burst tokens. Requests are
+// checked after the ServerBefore functions, so keys may depend on the gin keys
+// they populate. Admitted responses carry RateLimit-Limit, RateLimit-Remaining
+// and RateLimit-Reset headers; refused requests are not decoded, and a 429
+// StatusError with the same headers and Retry-After is passed to the error
+// encoder. The LimitInfo of every request is populated in the context under
+// ContextKeyRateLimit.
+func ServerRateLimit(rate float64, burst int, options ...LimitOption) ServerOption {
+	return func(s *Server) {
+		l := &rateLimiter{
+			server:  s,
+			config:  newLimitConfig(options),
+			rate:    rate,
+			burst:   float64(burst),
+			buckets: make(map[string]*tokenBucket),
+		}
+		s.interceptors = append(s.interceptors, l.intercept)
+	}
+}
+
+type rateLimiter struct {
+	server *Server
+	config limitConfig
+	rate   float64
+	burst  float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	sweep   time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (l *rateLimiter) intercept(next handlerFunc) handlerFunc {
+	return func(ctx context.Context, gCtx *gin.Context) context.Context {
+		info, retryAfter := l.take(l.config.key(ctx, gCtx), time.Now())
+		ctx = context.WithValue(ctx, ContextKeyRateLimit, info)
+
+		header := http.Header{}
+		header.Set("RateLimit-Limit", strconv.Itoa(info.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(info.Remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(info.Reset)))
+
+		if info.Rejected {
+			header.Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+			err := &StatusError{Code: http.StatusTooManyRequests, Message: "rate limit exceeded", Header: header}
+			l.server.errorHandler.Handle(ctx, err)
+			l.server.errorEncoder(ctx, err, gCtx)
+			return ctx
+		}
+
+		for k, v := range header {
+			gCtx.Writer.Header()[k] = v
+		}
+		return next(ctx, gCtx)
+	}
+}
+
+// take takes a token from the bucket of key. If none is left, the request is
+// rejected and the time until a token is available is returned.
+func (l *rateLimiter) take(key string, now time.Time) (LimitInfo, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.After(l.sweep) {
+		for k, b := range l.buckets {
+			if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+				delete(l.buckets, k)
+			}
+		}
+		l.sweep = now.Add(time.Minute)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	info := LimitInfo{Key: key, Limit: int(l.burst)}
+	var retryAfter time.Duration
+	if b.tokens >= 1 {
+		b.tokens--
+	} else {
+		info.Rejected = true
+		retryAfter = l.duration(1 - b.tokens)
+	}
+	info.Remaining = int(b.tokens)
+	info.Reset = l.duration(l.burst - b.tokens)
+	return info, retryAfter
+}
+
+func (l *rateLimiter) duration(tokens float64) time.Duration {
+	if l.rate <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// ServerConcurrencyLimit admits at most max requests per key to be served at
+// the same time. Requests beyond it are not decoded, and a 429 StatusError
+// with a Retry-After header is passed to the error encoder. The LimitInfo of
+// every request is populated in the context under ContextKeyConcurrencyLimit.
+func ServerConcurrencyLimit(max int, options ...LimitOption) ServerOption {
+	return func(s *Server) {
+		l := &concurrencyLimiter{
+			server:   s,
+			config:   newLimitConfig(options),
+			max:      max,
+			inFlight: make(map[string]int),
+		}
+		s.interceptors = append(s.interceptors, l.intercept)
+	}
+}
+
+type concurrencyLimiter struct {
+	server *Server
+	config limitConfig
+	max    int
+
+	mu       sync.Mutex
+	inFlight map[string]int
+}
+
+func (l *concurrencyLimiter) intercept(next handlerFunc) handlerFunc {
+	return func(ctx context.Context, gCtx *gin.Context) context.Context {
+		key := l.config.key(ctx, gCtx)
+		info := l.acquire(key)
+		ctx = context.WithValue(ctx, ContextKeyConcurrencyLimit, info)
+
+		if info.Rejected {
+			err := &StatusError{
+				Code:    http.StatusTooManyRequests,
+				Message: "too many concurrent requests",
+				Header:  http.Header{"Retry-After": []string{"1"}},
+			}
+			l.server.errorHandler.Handle(ctx, err)
+			l.server.errorEncoder(ctx, err, gCtx)
+			return ctx
+		}
+
+		defer l.release(key)
+		return next(ctx, gCtx)
+	}
+}
+
+func (l *concurrencyLimiter) acquire(key string) LimitInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	info := LimitInfo{Key: key, Limit: l.max}
+	n := l.inFlight[key]
+	if n >= l.max {
+		info.Rejected = true
+		return info
+	}
+	l.inFlight[key] = n + 1
+	info.Remaining = l.max - n - 1
+	return info
+}
+
+func (l *concurrencyLimiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[key] <= 1 {
+		delete(l.inFlight, key)
+		return
+	}
+	l.inFlight[key]--
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,108 @@
+package http_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/gin-gonic/gin"
+)
+
+func TestServerRateLimit(t *testing.T) {
+	var infos []httptransport.LimitInfo
+	handler := httptransport.NewServer(
+		func(context.Context, interface{}) (interface{}, error) { return struct{}{}, nil },
+		func(context.Context, *gin.Context) (interface{}, error) { return struct{}{}, nil },
+		httptransport.EncodeJSONResponse,
+		httptransport.ServerRateLimit(0.001, 2, httptransport.LimitKey(func(_ context.Context, gCtx *gin.Context) string {
+			return gCtx.GetHeader("X-Tenant")
+		})),
+		httptransport.ServerFinalizer(func(ctx context.Context, code int, _ *gin.Context) {
+			infos = append(infos, ctx.Value(httptransport.ContextKeyRateLimit).(httptransport.LimitInfo))
+		}),
+	)
+	r := gin.New()
+	r.GET("/", handler.ServeHTTP)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	for i, tt := range []struct {
+		tenant, remaining string
+		code              int
+	}{
+		{"a", "1", http.StatusOK},
+		{"a", "0", http.StatusOK},
+		{"a", "0", http.StatusTooManyRequests},
+		{"b", "1", http.StatusOK},
+	} {
+		resp, _ := getWithHeader(t, server.URL, "X-Tenant", tt.tenant)
+		if want, have := tt.code, resp.StatusCode; want != have {
+			t.Errorf("%d: StatusCode: want %d, have %d", i, want, have)
+		}
+		if want, have := "2", resp.Header.Get("RateLimit-Limit"); want != have {
+			t.Errorf("%d: RateLimit-Limit: want %q, have %q", i, want, have)
+		}
+		if want, have := tt.remaining, resp.Header.Get("RateLimit-Remaining"); want != have {
+			t.Errorf("%d: RateLimit-Remaining: want %q, have %q", i, want, have)
+		}
+		if retryAfter := resp.Header.Get("Retry-After"); (tt.code == http.StatusTooManyRequests) != (retryAfter != "") {
+			t.Errorf("%d: unexpected Retry-After %q", i, retryAfter)
+		}
+	}
+
+	if want, have := 4, len(infos); want != have {
+		t.Fatalf("finalizer calls: want %d, have %d", want, have)
+	}
+	if info := infos[2]; !info.Rejected || info.Key != "a" || info.Limit != 2 {
+		t.Errorf("finalizer: unexpected %+v", info)
+	}
+}
+
+func TestServerConcurrencyLimit(t *testing.T) {
+	var (
+		once    sync.Once
+		entered = make(chan struct{})
+		release = make(chan struct{})
+	)
+	handler := httptransport.NewServer(
+		func(context.Context, interface{}) (interface{}, error) {
+			once.Do(func() { close(entered) })
+			<-release
+			return struct{}{}, nil
+		},
+		func(context.Context, *gin.Context) (interface{}, error) { return struct{}{}, nil },
+		httptransport.EncodeJSONResponse,
+		httptransport.ServerConcurrencyLimit(1, httptransport.LimitKey(httptransport.LimitKeyClientIP)),
+	)
+	r := gin.New()
+	r.GET("/", handler.ServeHTTP)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	done := make(chan int)
+	go func() {
+		resp, _ := getWithHeader(t, server.URL, "X-Forwarded-For", "10.0.0.1, 10.0.0.2")
+		done <- resp.StatusCode
+	}()
+	<-entered
+
+	resp, _ := getWithHeader(t, server.URL, "X-Forwarded-For", "10.0.0.1")
+	if want, have := http.StatusTooManyRequests, resp.StatusCode; want != have {
+		t.Errorf("same client: want %d, have %d", want, have)
+	}
+	if want, have := "1", resp.Header.Get("Retry-After"); want != have {
+		t.Errorf("Retry-After: want %q, have %q", want, have)
+	}
+
+	close(release)
+	if want, have := http.StatusOK, <-done; want != have {
+		t.Errorf("first: want %d, have %d", want, have)
+	}
+	resp, _ = getWithHeader(t, server.URL, "X-Forwarded-For", "10.0.0.1")
+	if want, have := http.StatusOK, resp.StatusCode; want != have {
+		t.Errorf("after release: want %d, have %d", want, have)
+	}
+}
@@ -0,0 +1,81 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServerMetrics records every request with m: the number of requests being
+// served, and once the response is written, its status code, latency and
+// the sizes of the request and response bodies. Requests are labelled by
+// their method and route.
+//
+// Requests are counted before the other ServerBefore functions are executed,
+// so that requests they reject are recorded as well.
+func ServerMetrics(m Metrics) ServerOption {
+	return func(s *Server) {
+		start := func(ctx context.Context, gCtx *gin.Context) context.Context {
+			r := gCtx.Request
+			st := &metricsState{begin: time.Now(), method: r.Method, route: gCtx.FullPath(), size: r.ContentLength}
+			if st.size < 0 && r.Body != nil && r.Body != http.NoBody {
+				st.body = &countingBody{ReadCloser: r.Body}
+				r.Body = st.body
+			}
+			m.ServerInFlight(st.method, st.route, 1)
+			return context.WithValue(ctx, metricsStateKey{}, st)
+		}
+		s.before = append([]RequestFunc{start}, s.before...)
+
+		s.finalizer = append(s.finalizer, func(ctx context.Context, code int, gCtx *gin.Context) {
+			st, ok := ctx.Value(metricsStateKey{}).(*metricsState)
+			if !ok {
+				return
+			}
+			m.ServerInFlight(st.method, st.route, -1)
+
+			o := ServerObservation{
+				Method:      st.method,
+				Route:       st.route,
+				Code:        code,
+				Latency:     time.Since(st.begin),
+				RequestSize: st.size,
+			}
+			if st.body != nil {
+				o.RequestSize = st.body.n
+			}
+			if o.RequestSize < 0 {
+				o.RequestSize = 0
+			}
+			o.ResponseSize, _ = ctx.Value(ContextKeyResponseSize).(int64)
+			m.ObserveServer(o)
+		})
+	}
+}
+
+type metricsStateKey struct{}
+
+// metricsState holds what ServerMetrics records of a request before it is
+// served.
+type metricsState struct {
+	begin  time.Time
+	method string
+	route  string
+	size   int64
+	body   *countingBody
+}
+
+// countingBody counts the bytes read from a body.
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
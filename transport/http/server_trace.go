@@ -0,0 +1,157 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name of the spans of this package.
+const tracerName = "github.com/fitan/gink/transport/http"
+
+// TraceOption sets an optional parameter for ServerTrace.
+type TraceOption func(*traceConfig)
+
+type traceConfig struct {
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+	serverName string
+}
+
+// TraceProvider sets the provider of the tracer spans are started with. By
+// default it is the global provider at the time of the request.
+func TraceProvider(provider trace.TracerProvider) TraceOption {
+	return func(c *traceConfig) { c.provider = provider }
+}
+
+// TracePropagator sets the propagator span contexts are extracted from
+// requests with. By default the W3C trace context and baggage are extracted.
+func TracePropagator(propagator propagation.TextMapPropagator) TraceOption {
+	return func(c *traceConfig) { c.propagator = propagator }
+}
+
+// TraceServerName sets the http.server_name attribute of spans.
+func TraceServerName(name string) TraceOption {
+	return func(c *traceConfig) { c.serverName = name }
+}
+
+func (c traceConfig) tracer() trace.Tracer {
+	provider := c.provider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+// ServerTrace starts a server span for every request, as a child of the span
+// context propagated by the caller, and named after the route of the request.
+// The span is in the context of the ServerBefore functions added after it, of
+// the decoder, endpoint and encoder, and of the finalizers, so that they can
+// add attributes to it or start child spans.
+//
+// Decoding, the endpoint and encoding are recorded as events carrying their
+// duration, and their errors are recorded on the span. The span ends with the
+// status code of the response, and with an error status for 5xx responses.
+func ServerTrace(options ...TraceOption) ServerOption {
+	return func(s *Server) {
+		c := traceConfig{
+			propagator: propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+		}
+		for _, option := range options {
+			option(&c)
+		}
+
+		s.before = append(s.before, c.start)
+		s.finalizer = append(s.finalizer, endServerSpan)
+
+		dec, e, enc := s.dec, s.e, s.enc
+		s.dec = func(ctx context.Context, gCtx *gin.Context) (request interface{}, err error) {
+			defer traceEvent(ctx, "decode", time.Now(), &err)
+			return dec(ctx, gCtx)
+		}
+		s.e = func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			defer traceEvent(ctx, "endpoint", time.Now(), &err)
+			return e(ctx, request)
+		}
+		s.enc = func(ctx context.Context, gCtx *gin.Context, response interface{}) (err error) {
+			defer traceEvent(ctx, "encode", time.Now(), &err)
+			return enc(ctx, gCtx, response)
+		}
+	}
+}
+
+type traceStateKey struct{}
+
+// traceState holds the server span of a request, and the last error recorded
+// on it for its status.
+type traceState struct {
+	span trace.Span
+	err  error
+}
+
+func (c traceConfig) start(ctx context.Context, gCtx *gin.Context) context.Context {
+	r := gCtx.Request
+	ctx = c.propagator.Extract(ctx, propagation.HeaderCarrier(r.Header))
+
+	name := gCtx.FullPath()
+	if name == "" {
+		name = "HTTP " + r.Method
+	}
+	attributes := semconv.HTTPServerAttributesFromHTTPRequest(c.serverName, gCtx.FullPath(), r)
+	attributes = append(attributes, semconv.NetAttributesFromHTTPRequest("tcp", r)...)
+	attributes = append(attributes, semconv.EndUserAttributesFromHTTPRequest(r)...)
+	ctx, span := c.tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attributes...),
+	)
+	return context.WithValue(ctx, traceStateKey{}, &traceState{span: span})
+}
+
+// traceEvent records a step of the request on its server span.
+func traceEvent(ctx context.Context, name string, begin time.Time, err *error) {
+	st, ok := ctx.Value(traceStateKey{}).(*traceState)
+	if !ok {
+		return
+	}
+	st.span.AddEvent(name, trace.WithAttributes(
+		attribute.Float64("duration_ms", float64(time.Since(begin))/float64(time.Millisecond)),
+	))
+	if *err != nil {
+		st.span.RecordError(*err)
+		st.err = *err
+	}
+}
+
+func endServerSpan(ctx context.Context, code int, gCtx *gin.Context) {
+	st, ok := ctx.Value(traceStateKey{}).(*traceState)
+	if !ok {
+		// The request was aborted before the span was started.
+		return
+	}
+	span := st.span
+	span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(code)...)
+	if size, ok := ctx.Value(ContextKeyResponseSize).(int64); ok {
+		span.SetAttributes(semconv.HTTPResponseContentLengthKey.Int64(size))
+	}
+	if last := gCtx.Errors.Last(); last != nil {
+		// The request was aborted by a ServerBefore function.
+		span.RecordError(last.Err)
+	}
+
+	if code >= http.StatusInternalServerError {
+		message := http.StatusText(code)
+		if st.err != nil {
+			message = st.err.Error()
+		}
+		span.SetStatus(codes.Error, message)
+	}
+	span.End()
+}
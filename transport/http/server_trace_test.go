@@ -0,0 +1,141 @@
+package http_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	httptransport "github.com/fitan/gink/transport/http"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func spanAttribute(span *sdktrace.SpanSnapshot, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func spanEvents(span *sdktrace.SpanSnapshot) []string {
+	var names []string
+	for _, e := range span.MessageEvents {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+func TestServerTrace(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	var endpointSpan trace.SpanContext
+	handler := httptransport.NewServer(
+		func(ctx context.Context, request interface{}) (interface{}, error) {
+			endpointSpan = trace.SpanContextFromContext(ctx)
+			if request.(string) == "fail" {
+				return nil, errors.New("database unavailable")
+			}
+			return struct{}{}, nil
+		},
+		func(_ context.Context, gCtx *gin.Context) (interface{}, error) { return gCtx.Param("id"), nil },
+		httptransport.EncodeJSONResponse,
+		httptransport.ServerTrace(httptransport.TraceProvider(provider), httptransport.TraceServerName("items")),
+		httptransport.ServerBefore(httptransport.APIKeyAuthenticator(map[string]httptransport.Principal{"k": {}})),
+	)
+	r := gin.New()
+	r.GET("/items/:id", handler.ServeHTTP)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	get := func(path string, header http.Header) *sdktrace.SpanSnapshot {
+		exporter.Reset()
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		req.Header = header
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		spans := exporter.GetSpans()
+		if len(spans) != 1 {
+			t.Fatalf("%s: want 1 span, have %d", path, len(spans))
+		}
+		return spans[0]
+	}
+
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	span := get("/items/1", http.Header{
+		"Traceparent": {"00-" + traceID + "-" + spanID + "-01"},
+		"X-Api-Key":   {"k"},
+	})
+	if want, have := "/items/:id", span.Name; want != have {
+		t.Errorf("name: want %q, have %q", want, have)
+	}
+	if want, have := trace.SpanKindServer, span.SpanKind; want != have {
+		t.Errorf("kind: want %v, have %v", want, have)
+	}
+	if want, have := traceID, span.SpanContext.TraceID().String(); want != have {
+		t.Errorf("trace ID: want %s, have %s", want, have)
+	}
+	if want, have := spanID, span.Parent.SpanID().String(); want != have || !span.Parent.IsRemote() {
+		t.Errorf("parent: want remote %s, have %s", want, have)
+	}
+	if want, have := span.SpanContext.SpanID(), endpointSpan.SpanID(); want != have {
+		t.Errorf("endpoint context: want span %s, have %s", want, have)
+	}
+	for key, want := range map[attribute.Key]attribute.Value{
+		"http.route":       attribute.StringValue("/items/:id"),
+		"http.server_name": attribute.StringValue("items"),
+		"http.method":      attribute.StringValue("GET"),
+		"http.status_code": attribute.IntValue(200),
+	} {
+		if have := spanAttribute(span, key); want != have {
+			t.Errorf("%s: want %v, have %v", key, want.Emit(), have.Emit())
+		}
+	}
+	if want, have := "[decode endpoint encode]", fmt.Sprint(spanEvents(span)); want != have {
+		t.Errorf("events: want %s, have %s", want, have)
+	}
+	if want, have := codes.Unset, span.StatusCode; want != have {
+		t.Errorf("status: want %v, have %v", want, have)
+	}
+
+	span = get("/items/fail", http.Header{"X-Api-Key": {"k"}})
+	if span.Parent.IsValid() {
+		t.Errorf("parent without traceparent: %s", span.Parent.SpanID())
+	}
+	if want, have := codes.Error, span.StatusCode; want != have {
+		t.Errorf("failed: status: want %v, have %v", want, have)
+	}
+	if want, have := "database unavailable", span.StatusMessage; want != have {
+		t.Errorf("failed: status message: want %q, have %q", want, have)
+	}
+	if want, have := "[decode endpoint exception]", fmt.Sprint(spanEvents(span)); want != have {
+		t.Errorf("failed: events: want %s, have %s", want, have)
+	}
+
+	// Rejected requests are traced too, without an error status.
+	span = get("/items/1", nil)
+	if want, have := attribute.IntValue(401), spanAttribute(span, "http.status_code"); want != have {
+		t.Errorf("rejected: status code: want %v, have %v", want.Emit(), have.Emit())
+	}
+	if want, have := codes.Unset, span.StatusCode; want != have {
+		t.Errorf("rejected: status: want %v, have %v", want, have)
+	}
+	if want, have := "[exception]", fmt.Sprint(spanEvents(span)); want != have {
+		t.Errorf("rejected: events: want %s, have %s", want, have)
+	}
+}